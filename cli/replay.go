@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/offense"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/onebot"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/phash"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/review"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/server"
+)
+
+// maxRecordLine 是录制文件单行的最大长度,合并转发等事件可能很长
+const maxRecordLine = 16 * 1024 * 1024
+
+// replayResult 是一条消息事件回放后会执行的动作
+type replayResult struct {
+	ReceivedAt time.Time     `json:"received_at"`
+	SelfID     string        `json:"self_id"`
+	GroupID    int64         `json:"group_id"`
+	UserID     int64         `json:"user_id"`
+	MessageID  int64         `json:"message_id"`
+	Message    string        `json:"message"`
+	Actions    []onebot.Call `json:"actions"`
+}
+
+// stateFiles 是运行目录中会被事件处理修改的状态文件
+var stateFiles = []string{"groups.json", "config.ini", "phash.json", "review.json", "offense.json"}
+
+// Replay 把record_events录制的事件重新交给事件处理逻辑,动作只记录不发送,输出每条消息会触发的撤回、提示和踢人
+// 图片和视频会按事件中的链接重新下载检测,群设置、广告图库等状态读取当前目录中文件的副本,回放不会修改原文件
+func Replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configPath := flags.String("yml", "config.yml", "配置文件路径,不存在时使用默认配置")
+	groupID := flags.Int64("group", 0, "只回放该群的消息")
+	jsonOutput := flags.Bool("json", false, "每条消息输出一行JSON")
+	verbose := flags.Bool("v", false, "在标准错误中输出处理过程的日志")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "用法: %s replay [选项] <录制文件...>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flags.Output(), "有消息会被撤回时退出码为%d,读取失败时为%d\n", exitHit, exitError)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	out, restore := quiet(*verbose)
+	defer restore()
+
+	err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置文件失败: %v\n", err)
+		return exitError
+	}
+
+	paths := make([]string, flags.NArg())
+	for i, path := range flags.Args() {
+		if paths[i], err = filepath.Abs(path); err != nil {
+			fmt.Fprintf(os.Stderr, "无效的录制文件路径%s: %v\n", path, err)
+			return exitError
+		}
+	}
+	leave, err := enterSandbox()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建回放目录失败: %v\n", err)
+		return exitError
+	}
+	defer leave()
+
+	recorder := &onebot.Recorder{}
+	pipeline.Init(recorder.Transport)
+	server.SetTransportResolver(recorder.Transport)
+	defer server.SetTransportResolver(server.GetTransport)
+
+	var messages, withdrawn, failed int
+	for _, path := range paths {
+		err := readRecords(path, func(event server.RecordedEvent) {
+			result, ok := replayEvent(recorder, event, *groupID)
+			if !ok {
+				return
+			}
+			messages++
+			for _, call := range result.Actions {
+				if call.Action == "delete_msg" {
+					withdrawn++
+					break
+				}
+			}
+			if *jsonOutput {
+				data, _ := json.Marshal(result)
+				fmt.Fprintln(out, string(data))
+			} else {
+				fmt.Fprint(out, formatReplay(result))
+			}
+		}, func(line int, err error) {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, line, err)
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "读取%s失败: %v\n", path, err)
+		}
+	}
+
+	if !*jsonOutput {
+		fmt.Fprintf(out, "共%d条消息: 撤回%d 无法解析%d\n", messages, withdrawn, failed)
+	}
+	switch {
+	case withdrawn > 0:
+		return exitHit
+	case failed > 0:
+		return exitError
+	}
+	return exitClean
+}
+
+// enterSandbox 把状态文件复制到临时目录并切换过去,回放中的违规记录、复核队列、群设置、下载的媒体和日志都写在临时目录
+// 返回的函数切换回原目录并删除临时目录
+func enterSandbox() (func(), error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "replay-*")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stateFiles {
+		data, err := os.ReadFile(filepath.Join(wd, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, name), data, 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	openStores()
+	return func() {
+		if err := os.Chdir(wd); err != nil {
+			fmt.Fprintf(os.Stderr, "切换回%s失败: %v\n", wd, err)
+		}
+		os.RemoveAll(dir)
+		openStores()
+	}, nil
+}
+
+// openStores 从当前目录重新加载全局状态,之前已加载的内容不会带入回放
+func openStores() {
+	groupconfig.Open("groups.json")
+	phash.Open("phash.json")
+	review.Open("review.json")
+	offense.Open("offense.json")
+}
+
+// readRecords 逐行读取录制文件,解析失败的行交给onError后继续
+func readRecords(path string, onEvent func(server.RecordedEvent), onError func(int, error)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var event server.RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			onError(line, err)
+			continue
+		}
+		onEvent(event)
+	}
+	return scanner.Err()
+}
+
+// replayEvent 回放一条事件,不是消息事件或不属于指定群时返回false
+func replayEvent(recorder *onebot.Recorder, event server.RecordedEvent, groupID int64) (replayResult, bool) {
+	var message struct {
+		PostType   string `json:"post_type"`
+		GroupID    int64  `json:"group_id"`
+		UserID     int64  `json:"user_id"`
+		MessageID  int64  `json:"message_id"`
+		RawMessage string `json:"raw_message"`
+	}
+	if err := json.Unmarshal(event.Raw, &message); err != nil || message.PostType != "message" {
+		return replayResult{}, false
+	}
+	if groupID != 0 && message.GroupID != groupID {
+		return replayResult{}, false
+	}
+
+	recorder.Take()
+	server.ReplayEvent(event.Raw)
+	return replayResult{
+		ReceivedAt: event.ReceivedAt,
+		SelfID:     event.SelfID,
+		GroupID:    message.GroupID,
+		UserID:     message.UserID,
+		MessageID:  message.MessageID,
+		Message:    message.RawMessage,
+		Actions:    recorder.Take(),
+	}, true
+}
+
+// formatReplay 输出 时间 群 发送者 消息,下面每行一个会执行的动作
+func formatReplay(r replayResult) string {
+	text := []rune(r.Message)
+	if len(text) > 60 {
+		text = append(text[:60], []rune("...")...)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 群%d 用户%d 消息%d: %s\n", r.ReceivedAt.Local().Format("2006-01-02 15:04:05"), r.GroupID, r.UserID, r.MessageID, string(text))
+	if len(r.Actions) == 0 {
+		b.WriteString("  无动作\n")
+	}
+	for _, call := range r.Actions {
+		b.WriteString("  " + describeCall(call) + "\n")
+	}
+	return b.String()
+}
+
+// describeCall 把action调用写成一句说明
+func describeCall(call onebot.Call) string {
+	p := call.Params
+	switch call.Action {
+	case "delete_msg":
+		return fmt.Sprintf("撤回消息 %v", p["message_id"])
+	case "send_group_msg":
+		return fmt.Sprintf("发送群消息: %v", p["message"])
+	case "send_private_msg":
+		return fmt.Sprintf("发送私聊 %v: %v", p["user_id"], p["message"])
+	case "set_group_kick":
+		if reject, _ := p["reject_add_request"].(bool); reject {
+			return fmt.Sprintf("踢出 %v 并拒绝再次加群", p["user_id"])
+		}
+		return fmt.Sprintf("踢出 %v", p["user_id"])
+	case "set_group_ban":
+		if fmt.Sprint(p["duration"]) == "0" {
+			return fmt.Sprintf("解除禁言 %v", p["user_id"])
+		}
+		return fmt.Sprintf("禁言 %v %v秒", p["user_id"], p["duration"])
+	case "set_group_whole_ban":
+		if enable, _ := p["enable"].(bool); enable {
+			return "开启全员禁言"
+		}
+		return "解除全员禁言"
+	}
+	params, _ := json.Marshal(p)
+	return fmt.Sprintf("%s %s", call.Action, params)
+}
@@ -0,0 +1,419 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
+)
+
+// groupMessage 生成一条群消息事件的原始帧
+func groupMessage(groupID, userID, messageID int64, text string) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"post_type":    "message",
+		"message_type": "group",
+		"self_id":      10000,
+		"group_id":     groupID,
+		"user_id":      userID,
+		"message_id":   messageID,
+		"raw_message":  text,
+		"message":      text,
+		"sender":       map[string]interface{}{"user_id": userID, "role": "member"},
+	})
+	return string(data)
+}
+
+// adminMessage 生成一条群管理员发送的群消息事件
+func adminMessage(groupID, userID, messageID int64, text string) string {
+	return strings.Replace(groupMessage(groupID, userID, messageID, text), `"role":"member"`, `"role":"admin"`, 1)
+}
+
+// setupReplay 在临时目录中写入配置和录制文件,并切换到该目录,群开关等状态文件写在当前目录
+// edit 可以修改配置内容,返回配置文件和录制文件的路径
+func setupReplay(t *testing.T, edit func(string) string) (string, string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	configPath := filepath.Join(dir, "config.yml")
+	config := strings.Replace(template.ConfigTemplate, `withdraw_words : [""]`, `withdraw_words : ["免费资料"]`, 1)
+	if edit != nil {
+		config = edit(config)
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recordPath := filepath.Join(dir, "events.jsonl")
+	writeRecord(t, recordPath,
+		`{"post_type":"meta_event","meta_event_type":"heartbeat","self_id":10000}`,
+		groupMessage(100, 1, 11, "加群领取免费资料"),
+		groupMessage(100, 2, 12, "今天天气不错"),
+		groupMessage(200, 3, 13, "免费资料看这里"),
+		"not json",
+	)
+	return configPath, recordPath
+}
+
+// writeRecord 把原始帧写成录制文件,不是json的帧原样写入
+func writeRecord(t *testing.T, path string, frames ...string) {
+	t.Helper()
+	var lines []string
+	for _, frame := range frames {
+		if !json.Valid([]byte(frame)) {
+			lines = append(lines, frame)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(`{"received_at":"2024-01-02T03:04:05Z","self_id":"10000","raw":%s}`, frame))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replayActions 以-json运行replay,返回退出码和每条消息触发的action,action后附上发送目标群
+func replayActions(t *testing.T, args ...string) (int, map[int64]string) {
+	t.Helper()
+	code, out := capture(t, func() int { return Replay(append([]string{"-json"}, args...)) })
+	actions := map[int64]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var r replayResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		var names []string
+		for _, call := range r.Actions {
+			name := call.Action
+			if group, ok := call.Params["group_id"]; ok {
+				name += fmt.Sprintf("@%v", group)
+			}
+			names = append(names, name)
+		}
+		actions[r.MessageID] = strings.Join(names, " ")
+	}
+	return code, actions
+}
+
+func checkActions(t *testing.T, got, want map[int64]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("replayed %d messages, want %d: %v", len(got), len(want), got)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("message %d: actions %q, want %q", id, got[id], w)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	configPath, recordPath := setupReplay(t, nil)
+
+	code, actions := replayActions(t, "-yml", configPath, recordPath)
+	if code != exitHit {
+		t.Errorf("exit code = %d, want %d", code, exitHit)
+	}
+	checkActions(t, actions, map[int64]string{
+		11: "delete_msg send_group_msg@100",
+		12: "",
+		13: "delete_msg send_group_msg@200",
+	})
+
+	code, out := capture(t, func() int { return Replay([]string{"-group", "100", "-yml", configPath, recordPath}) })
+	if code != exitHit {
+		t.Errorf("exit code with -group = %d, want %d", code, exitHit)
+	}
+	if !strings.Contains(out, "撤回消息 11") || strings.Contains(out, "消息13") {
+		t.Errorf("unexpected output with -group 100:\n%s", out)
+	}
+}
+
+func TestReplayShadow(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		config = strings.Replace(config, `shadow_groups : []`, `shadow_groups : ["100"]`, 1)
+		return strings.Replace(config, `shadow_report_group : ""`, `shadow_report_group : "999"`, 1)
+	})
+
+	// 影子模式的群只把判定发到管理群,其它群照常撤回
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		11: "send_group_msg@999",
+		12: "",
+		13: "delete_msg send_group_msg@200",
+	})
+}
+
+func TestReplayReview(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		// 撤回阈值高于完整解码的得分,二维码只会进入复核
+		config = strings.Replace(config, `qr_withdraw_threshold : 0.6`, `qr_withdraw_threshold : 1.5`, 1)
+		return strings.Replace(config, `review_group : ""`, `review_group : "999"`, 1)
+	})
+	dir := filepath.Dir(recordPath)
+	for _, c := range corpus.Images() {
+		if c.Name == "qr_center" {
+			if _, err := c.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+	if err := groupconfig.Set("100", "image_check", "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	image := fmt.Sprintf("[CQ:image,file=qr.png,url=%s/qr_center.png]", ts.URL)
+	writeRecord(t, recordPath,
+		groupMessage(100, 1, 21, image),
+		groupMessage(999, 5, 22, "通过 1"),
+		adminMessage(999, 6, 23, "通过 1 abc"),
+		adminMessage(999, 6, 24, "通过 1"),
+		adminMessage(999, 6, 25, "驳回 1"),
+		groupMessage(999, 5, 26, "通过了吗"),
+	)
+
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		// 转发到管理群,普通成员无权复核
+		21: "send_group_msg@999",
+		22: "send_group_msg@999",
+		// 含有非数字编号时整条不处理,#1仍待复核
+		23: "",
+		// 批准后撤回并提示,再回复管理员
+		24: "delete_msg send_group_msg@100 send_group_msg@999",
+		25: "send_group_msg@999",
+		26: "",
+	})
+}
+
+func TestReplayPunish(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		return strings.Replace(config, `punish_ladder : []`, `punish_ladder : ["warn", "ban:10", "kick"]`, 1)
+	})
+	writeRecord(t, recordPath,
+		groupMessage(100, 7, 31, "免费资料"),
+		groupMessage(100, 7, 32, "免费资料"),
+		groupMessage(200, 7, 33, "免费资料"),
+		groupMessage(100, 7, 34, "免费资料"),
+		groupMessage(100, 7, 35, "免费资料"),
+	)
+
+	// 违规次数按群分别计算,超出阶梯后保持最后一级
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		31: "delete_msg send_group_msg@100",
+		32: "delete_msg send_group_msg@100 set_group_ban@100",
+		33: "delete_msg send_group_msg@200",
+		34: "delete_msg send_group_msg@100 set_group_kick@100",
+		35: "delete_msg send_group_msg@100 set_group_kick@100",
+	})
+}
+
+func TestReplayRuleAction(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		config = strings.Replace(config, `withdraw_words : ["免费资料"]`, `withdraw_words : ["免费资料", "加我微信 => ban:30", "代刷 => kick", "引流 => mute"]`, 1)
+		return strings.Replace(config, `punish_ladder : []`, `punish_ladder : ["warn", "warn", "kick"]`, 1)
+	})
+	writeRecord(t, recordPath,
+		groupMessage(100, 8, 41, "免费资料"),
+		groupMessage(100, 8, 42, "加我微信"),
+		groupMessage(100, 8, 43, "免费资料"),
+		groupMessage(100, 9, 44, "代刷"),
+		groupMessage(100, 10, 45, "引流"),
+	)
+
+	// 规则指定的处罚代替违规阶梯,违规次数照常累计,无法识别的处罚按阶梯处理
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		41: "delete_msg send_group_msg@100",
+		42: "delete_msg send_group_msg@100 set_group_ban@100",
+		43: "delete_msg send_group_msg@100 set_group_kick@100",
+		44: "delete_msg send_group_msg@100 set_group_kick@100",
+		45: "delete_msg send_group_msg@100",
+	})
+}
+
+func TestReplayRaid(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		return strings.Replace(config, `raid_threshold : 0`, `raid_threshold : 2`, 1)
+	})
+	writeRecord(t, recordPath,
+		groupMessage(300, 8, 41, "免费资料"),
+		groupMessage(300, 9, 42, "免费资料"),
+		groupMessage(300, 8, 43, "解除禁言"),
+		adminMessage(300, 5, 44, "解除禁言"),
+		adminMessage(300, 5, 45, "解除禁言 [CQ:at,qq=10008] 10009"),
+		adminMessage(300, 5, 46, "解除禁言了吗"),
+	)
+
+	// 第二条广告触发全员禁言,之后只有管理员可以解除
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		41: "delete_msg send_group_msg@300",
+		42: "delete_msg send_group_msg@300 set_group_whole_ban@300 send_group_msg@300",
+		43: "send_group_msg@300",
+		44: "set_group_whole_ban@300 send_group_msg@300",
+		45: "set_group_ban@300 set_group_ban@300 send_group_msg@300",
+		46: "",
+	})
+}
+
+func TestReplayCommands(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		config = strings.Replace(config, `command_prefix : ""`, `command_prefix : "/"`, 1)
+		return strings.Replace(config, `super_users : []`, `super_users : ["6"]`, 1)
+	})
+	writeRecord(t, recordPath,
+		groupMessage(400, 5, 51, "/视频广告撤回on"),
+		adminMessage(400, 5, 52, "视频广告撤回on"),
+		adminMessage(400, 5, 53, "/视频广告撤回on"),
+		adminMessage(400, 5, 54, "/视频广告撤回on"),
+		groupMessage(400, 6, 55, "/图片广告撤回on"),
+		groupMessage(400, 6, 56, "/图片广告撤回off"),
+		groupMessage(400, 7, 57, "/检测状态"),
+		groupMessage(400, 7, 58, "/帮助"),
+		groupMessage(400, 7, 59, "/帮助一下"),
+	)
+
+	// 普通成员不能开关检测,重复开启不会反转开关,超级用户不是管理员也可以开关
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		51: "send_group_msg@400",
+		52: "",
+		53: "send_group_msg@400",
+		54: "send_group_msg@400",
+		55: "send_group_msg@400",
+		56: "send_group_msg@400",
+		57: "send_group_msg@400",
+		58: "send_group_msg@400",
+		59: "",
+	})
+	_, out := capture(t, func() int { return Replay([]string{"-yml", configPath, recordPath}) })
+	for _, reply := range []string{"只有群主或管理员可以使用该指令", "视频二维码检测已经是开启状态", "图片二维码检测已关闭", "可用指令:"} {
+		if !strings.Contains(out, reply) {
+			t.Errorf("replay output has no %q:\n%s", reply, out)
+		}
+	}
+}
+
+func TestReplaySetCommand(t *testing.T) {
+	configPath, recordPath := setupReplay(t, nil)
+	writeRecord(t, recordPath,
+		groupMessage(600, 5, 61, "设置 qr_limit 2"),
+		adminMessage(600, 5, 62, "设置 qr_limit 2"),
+		adminMessage(600, 5, 63, "设置 qr_limit abc"),
+		adminMessage(600, 5, 64, "设置好了吗"),
+		adminMessage(600, 5, 65, "设置 withdraw_words 加群送礼"),
+		groupMessage(600, 8, 66, "加群送礼"),
+		adminMessage(600, 5, 67, "恢复设置 withdraw_words"),
+		groupMessage(600, 8, 68, "加群送礼"),
+	)
+
+	// 只有管理员可以修改,不是设置项的消息当作普通聊天,无效的值不会保存
+	_, actions := replayActions(t, "-yml", configPath, recordPath)
+	checkActions(t, actions, map[int64]string{
+		61: "send_group_msg@600",
+		62: "send_group_msg@600",
+		63: "send_group_msg@600",
+		64: "",
+		65: "send_group_msg@600",
+		66: "delete_msg send_group_msg@600",
+		67: "send_group_msg@600",
+		68: "",
+	})
+	_, out := capture(t, func() int { return Replay([]string{"-yml", configPath, recordPath}) })
+	for _, reply := range []string{"只有群主或管理员可以使用该指令", "(qr_limit)已设置为 2", "is not a positive integer", "(withdraw_words)已恢复为配置文件中的值 免费资料"} {
+		if !strings.Contains(out, reply) {
+			t.Errorf("replay output has no %q:\n%s", reply, out)
+		}
+	}
+}
+
+// TestReplayKeepsState 检查回放不会修改运行目录中的违规记录、复核队列、广告图库和群设置
+func TestReplayKeepsState(t *testing.T) {
+	configPath, recordPath := setupReplay(t, func(config string) string {
+		config = strings.Replace(config, `punish_ladder : []`, `punish_ladder : ["warn", "kick"]`, 1)
+		return strings.Replace(config, `review_group : ""`, `review_group : "999"`, 1)
+	})
+	dir := filepath.Dir(recordPath)
+	for _, c := range corpus.Images() {
+		if c.Name == "qr_center" {
+			if _, err := c.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+
+	if err := groupconfig.Set("500", "image_check", "true"); err != nil {
+		t.Fatal(err)
+	}
+	state := map[string]string{
+		"offense.json": "{}",
+		"review.json":  `{"next_id": 1, "items": []}`,
+		"phash.json":   "[]",
+	}
+	for name, content := range state {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groups, err := os.ReadFile(filepath.Join(dir, "groups.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state["groups.json"] = string(groups)
+
+	image := fmt.Sprintf("[CQ:image,file=qr.png,url=%s/qr_center.png]", ts.URL)
+	writeRecord(t, recordPath,
+		groupMessage(500, 9, 61, "免费资料"),
+		groupMessage(500, 9, 62, image),
+		adminMessage(500, 5, 63, "视频广告撤回on"),
+	)
+	// 阈值调高后二维码图片进入复核队列,默认配置下会被撤回并记入广告图库
+	reviewConfig := filepath.Join(dir, "review.yml")
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = []byte(strings.Replace(string(content), `qr_withdraw_threshold : 0.6`, `qr_withdraw_threshold : 1.5`, 1))
+	if err := os.WriteFile(reviewConfig, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, yml := range []string{reviewConfig, configPath} {
+		if code, _ := replayActions(t, "-yml", yml, recordPath); code != exitHit {
+			t.Errorf("replay with %s: exit code %d, want %d", filepath.Base(yml), code, exitHit)
+		}
+	}
+
+	for name, want := range state {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s changed by replay:\n%s", name, got)
+		}
+	}
+	if wd, _ := os.Getwd(); wd != dir {
+		t.Errorf("working directory after replay = %s, want %s", wd, dir)
+	}
+}
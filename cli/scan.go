@@ -0,0 +1,274 @@
+// Package cli 实现不启动机器人的命令行子命令
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
+)
+
+// 退出码
+const (
+	exitClean = 0
+	// exitHit 表示至少有一个文件命中
+	exitHit = 1
+	// exitError 表示没有命中,但有文件检测失败或参数错误
+	exitError = 2
+)
+
+// maxTextSize 是文本文件最多读取的字节数
+const maxTextSize = 1024 * 1024
+
+// scanResult 是单个文件的检测结果
+type scanResult struct {
+	Path     string                 `json:"path"`
+	Kind     pipeline.Kind          `json:"kind"`
+	Verdict  string                 `json:"verdict"`
+	Detector string                 `json:"detector,omitempty"`
+	Reason   string                 `json:"reason,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Seconds  float64                `json:"seconds"`
+}
+
+// Scan 用与机器人相同的检测器链检查本地的图片、视频和文本文件,不执行撤回
+// 目录会被递归遍历,.txt按文本检查关键词,其余文件按文件头识别为图片或视频
+func Scan(args []string) int {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	configPath := flags.String("yml", "config.yml", "配置文件路径,不存在时使用默认配置")
+	groupID := flags.String("group", "", "按该群的二维码规则判定")
+	jsonOutput := flags.Bool("json", false, "每个文件输出一行JSON")
+	verbose := flags.Bool("v", false, "在标准错误中输出检测过程的日志")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "用法: %s scan [选项] <文件或目录...>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flags.Output(), "有文件命中时退出码为%d,检测失败时为%d\n", exitHit, exitError)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	out, restore := quiet(*verbose)
+	defer restore()
+
+	if err := loadConfig(*configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置文件失败: %v\n", err)
+		return exitError
+	}
+
+	p := pipeline.New(nil)
+	counts := map[string]int{}
+	for _, path := range collectFiles(flags.Args()) {
+		result := scanFile(p, path, *groupID)
+		if result.Kind == "" {
+			if !*jsonOutput {
+				fmt.Fprintf(os.Stderr, "跳过无法识别的文件 %s\n", path)
+			}
+			continue
+		}
+		counts[result.Verdict]++
+		if *jsonOutput {
+			data, _ := json.Marshal(result)
+			fmt.Fprintln(out, string(data))
+		} else {
+			fmt.Fprintln(out, formatResult(result))
+		}
+	}
+
+	if !*jsonOutput {
+		fmt.Fprintf(out, "共%d个文件: 命中%d 待复核%d 通过%d 失败%d\n",
+			counts["hit"]+counts["review"]+counts["pass"]+counts["error"], counts["hit"], counts["review"], counts["pass"], counts["error"])
+	}
+	switch {
+	case counts["hit"] > 0:
+		return exitHit
+	case counts["error"] > 0:
+		return exitError
+	}
+	return exitClean
+}
+
+// quiet 检测器会在标准输出打印过程信息,运行期间改写到标准错误或丢弃,标准输出只留给结果
+// 返回原来的标准输出和恢复函数,恢复函数同时恢复标准输出和log的输出
+func quiet(verbose bool) (*os.File, func()) {
+	out := os.Stdout
+	if verbose {
+		os.Stdout = os.Stderr
+		return out, func() { os.Stdout = out }
+	}
+	logOut := log.Writer()
+	log.SetOutput(io.Discard)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return out, func() { log.SetOutput(logOut) }
+	}
+	os.Stdout = devNull
+	return out, func() {
+		os.Stdout = out
+		log.SetOutput(logOut)
+		devNull.Close()
+	}
+}
+
+// loadConfig 加载配置文件,文件不存在时使用配置模板中的默认值,不像启动机器人时那样生成配置文件
+func loadConfig(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "未找到配置文件%s,使用默认配置\n", path)
+		tmp, err := os.CreateTemp("", "config-*.yml")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.WriteString(template.ConfigTemplate); err != nil {
+			tmp.Close()
+			return err
+		}
+		tmp.Close()
+		path = tmp.Name()
+	}
+	_, err := config.LoadConfig(path)
+	return err
+}
+
+// collectFiles 展开参数中的目录,按路径顺序返回所有文件
+func collectFiles(paths []string) []string {
+	var files []string
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil || !stat.IsDir() {
+			// 不存在的文件也保留,由scanFile报告错误
+			files = append(files, path)
+			continue
+		}
+		filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				files = append(files, file)
+				return nil
+			}
+			if entry.Type().IsRegular() {
+				files = append(files, file)
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// scanFile 按文件类型生成任务并运行检测器链,无法识别的文件返回的Kind为空
+func scanFile(p *pipeline.Pipeline, path, groupID string) (result scanResult) {
+	result.Path = path
+	start := time.Now()
+	defer func() { result.Seconds = time.Since(start).Seconds() }()
+
+	job := &pipeline.Job{GroupID: groupID, LocalPath: path}
+	if strings.EqualFold(filepath.Ext(path), ".txt") {
+		data, err := readText(path)
+		if err != nil {
+			result.Kind, result.Verdict, result.Error = pipeline.KindText, "error", err.Error()
+			return result
+		}
+		job.Kind = pipeline.KindText
+		job.RawMessage = data
+	} else if _, err := os.Stat(path); err != nil {
+		result.Kind, result.Verdict, result.Error = "file", "error", err.Error()
+		return result
+	} else if t, ok := media.SniffFile(path); !ok {
+		return result
+	} else if t == media.TypeImage {
+		job.Kind = pipeline.KindImage
+	} else {
+		job.Kind = pipeline.KindVideo
+		// 抽帧会在视频旁边创建同名目录,复制到临时目录中检测,不在样本目录中留下文件
+		tmpDir, err := os.MkdirTemp("", "scan")
+		if err != nil {
+			result.Kind, result.Verdict, result.Error = job.Kind, "error", err.Error()
+			return result
+		}
+		defer os.RemoveAll(tmpDir)
+		job.LocalPath = filepath.Join(tmpDir, "video"+filepath.Ext(path))
+		if err := copyFile(path, job.LocalPath); err != nil {
+			result.Kind, result.Verdict, result.Error = job.Kind, "error", err.Error()
+			return result
+		}
+	}
+	result.Kind = job.Kind
+
+	evaluated := p.Evaluate(job)
+	if evaluated.Err != nil {
+		result.Verdict, result.Error = "error", evaluated.Err.Error()
+		return result
+	}
+	verdict := evaluated.Verdict
+	result.Verdict = verdict.Decision.String()
+	if verdict.Decision == pipeline.DecisionContinue {
+		// 检测器链走完仍没有结论,视为通过
+		result.Verdict = pipeline.DecisionPass.String()
+	}
+	result.Detector, result.Reason, result.Details = verdict.Detector, verdict.Reason, evaluated.Details
+	return result
+}
+
+func readText(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxTextSize))
+	return string(data), err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// formatResult 输出 结论 路径 检测器: 原因 耗时,通过的文件附上时长、置信度等关键信息
+func formatResult(r scanResult) string {
+	line := fmt.Sprintf("%-7s %s", strings.ToUpper(r.Verdict), r.Path)
+	switch {
+	case r.Error != "":
+		line += "  " + r.Error
+	case r.Reason != "":
+		line += fmt.Sprintf("  %s: %s", r.Detector, r.Reason)
+	}
+	var facts []string
+	if duration, ok := r.Details["duration"].(float64); ok {
+		facts = append(facts, fmt.Sprintf("时长%.1fs", duration))
+	}
+	if score, ok := r.Details["qr_score"].(float64); ok {
+		facts = append(facts, fmt.Sprintf("置信度%.2f", score))
+	}
+	if len(facts) > 0 {
+		line += "  [" + strings.Join(facts, " ") + "]"
+	}
+	return line + fmt.Sprintf("  %.2fs", r.Seconds)
+}
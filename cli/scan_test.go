@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
+)
+
+// capture 运行子命令,返回退出码和写到标准输出的内容
+func capture(t *testing.T, run func() int) (int, string) {
+	t.Helper()
+	outPath := filepath.Join(t.TempDir(), "stdout")
+	file, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = file
+	code := run()
+	os.Stdout = stdout
+	file.Close()
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(data)
+}
+
+// runScan 运行scan子命令,返回退出码和标准输出中的结果
+func runScan(t *testing.T, args ...string) (int, []scanResult) {
+	t.Helper()
+	code, data := capture(t, func() int { return Scan(append([]string{"-json"}, args...)) })
+	var results []scanResult
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var r scanResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		results = append(results, r)
+	}
+	return code, results
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range corpus.Images() {
+		if c.Name == "qr_center" || c.Name == "gradient" {
+			if _, err := c.Write(dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	files := map[string]string{
+		"ad.txt":    "加群领取免费资料",
+		"clean.txt": "今天天气不错",
+		"notes.md":  "不是图片也不是视频",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	config := strings.Replace(template.ConfigTemplate, `withdraw_words : [""]`, `withdraw_words : ["免费资料"]`, 1)
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, results := runScan(t, "-yml", configPath, dir)
+	if code != exitHit {
+		t.Errorf("exit code = %d, want %d", code, exitHit)
+	}
+	want := map[string]string{
+		"ad.txt":        "hit",
+		"clean.txt":     "pass",
+		"gradient.png":  "pass",
+		"qr_center.png": "hit",
+	}
+	if len(results) != len(want) {
+		t.Errorf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for _, r := range results {
+		if verdict := want[filepath.Base(r.Path)]; r.Verdict != verdict {
+			t.Errorf("%s: verdict %q (%s), want %q", r.Path, r.Verdict, r.Reason, verdict)
+		}
+	}
+
+	code, _ = runScan(t, "-yml", configPath, filepath.Join(dir, "clean.txt"))
+	if code != exitClean {
+		t.Errorf("exit code for a clean file = %d, want %d", code, exitClean)
+	}
+	code, _ = runScan(t, "-yml", configPath, filepath.Join(dir, "missing.png"))
+	if code != exitError {
+		t.Errorf("exit code for a missing file = %d, want %d", code, exitError)
+	}
+}
+
+func TestQuietRestoresLog(t *testing.T) {
+	previous := log.Writer()
+	defer log.SetOutput(previous)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	_, restore := quiet(false)
+	log.Print("discarded")
+	restore()
+	log.Print("kept")
+
+	if log.Writer() != &buf {
+		t.Fatalf("log output was not restored")
+	}
+	if got := buf.String(); strings.Contains(got, "discarded") || !strings.Contains(got, "kept") {
+		t.Errorf("log output = %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
@@ -178,3 +179,623 @@ func GetKickAndRejectAddRequest() bool {
 	}
 	return false
 }
+
+// GetReverseWs 获取需要主动连接的onebot ws地址列表
+func GetReverseWs() []structs.ReverseWsTarget {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.ReverseWs
+	}
+	return nil
+}
+
+// GetReconnectInterval 获取断线重连的初始间隔(秒)
+func GetReconnectInterval() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ReconnectInterval > 0 {
+		return instance.Settings.ReconnectInterval
+	}
+	return 3
+}
+
+// GetReconnectMaxInterval 获取断线重连的最大间隔(秒)
+func GetReconnectMaxInterval() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ReconnectMaxInterval > 0 {
+		return instance.Settings.ReconnectMaxInterval
+	}
+	return 60
+}
+
+// GetActionTimeout 获取等待onebot action响应的超时时间(秒)
+func GetActionTimeout() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ActionTimeout > 0 {
+		return instance.Settings.ActionTimeout
+	}
+	return 10
+}
+
+// GetVideoWorkers 获取同时处理视频任务的协程数
+func GetVideoWorkers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.VideoWorkers > 0 {
+		return instance.Settings.VideoWorkers
+	}
+	return 2
+}
+
+// GetVideoQueueSize 获取视频任务队列长度
+func GetVideoQueueSize() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.VideoQueueSize > 0 {
+		return instance.Settings.VideoQueueSize
+	}
+	return 32
+}
+
+// GetImageWorkers 获取同时处理图片任务的协程数
+func GetImageWorkers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ImageWorkers > 0 {
+		return instance.Settings.ImageWorkers
+	}
+	return 4
+}
+
+// GetImageQueueSize 获取图片任务队列长度
+func GetImageQueueSize() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ImageQueueSize > 0 {
+		return instance.Settings.ImageQueueSize
+	}
+	return 64
+}
+
+// GetEventWorkers 获取同时处理onebot事件的协程数
+func GetEventWorkers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.EventWorkers > 0 {
+		return instance.Settings.EventWorkers
+	}
+	return 16
+}
+
+// GetEventQueueSize 获取等待处理的事件队列长度
+func GetEventQueueSize() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.EventQueueSize > 0 {
+		return instance.Settings.EventQueueSize
+	}
+	return 256
+}
+
+// GetQueueFullPolicy 获取队列满时的处理策略
+func GetQueueFullPolicy() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		switch instance.Settings.QueueFullPolicy {
+		case "drop_newest", "drop_oldest", "block":
+			return instance.Settings.QueueFullPolicy
+		}
+	}
+	return "drop_newest"
+}
+
+// GetPhashEnabled 获取是否启用已知广告图哈希黑名单
+func GetPhashEnabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.PhashEnabled
+	}
+	return false
+}
+
+// GetPhashThreshold 获取判定为同一张图的最大汉明距离
+func GetPhashThreshold() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.PhashThreshold > 0 {
+		return instance.Settings.PhashThreshold
+	}
+	return 6
+}
+
+// GetPhashAddCommand 获取添加广告图哈希的指令
+func GetPhashAddCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.PhashAddCommand
+	}
+	return ""
+}
+
+// GetPhashRemoveCommand 获取删除广告图哈希的指令
+func GetPhashRemoveCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.PhashRemoveCommand
+	}
+	return ""
+}
+
+// GetQRPolicies 按匹配顺序返回指定群的二维码内容规则,群规则在前,全局规则在后
+// 群规则先于全局规则匹配,因此群可以撤回全局放行的内容,也可以放行全局撤回的内容
+func GetQRPolicies(groupID string) []structs.QRPolicy {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance == nil {
+		return []structs.QRPolicy{{}}
+	}
+	if group, ok := instance.Settings.QRPolicyGroups[groupID]; ok {
+		return []structs.QRPolicy{group, instance.Settings.QRPolicy}
+	}
+	return []structs.QRPolicy{instance.Settings.QRPolicy}
+}
+
+// GetBarcodeFormats 获取启用检测的条码格式,未配置时只检测二维码
+func GetBarcodeFormats() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && len(instance.Settings.BarcodeFormats) > 0 {
+		return instance.Settings.BarcodeFormats
+	}
+	return []string{"qr_code"}
+}
+
+// GetSunCodeEnabled 获取是否检测小程序码
+func GetSunCodeEnabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.SunCodeEnabled
+	}
+	return false
+}
+
+// GetSunCodeThreshold 获取判定为小程序码的置信度阈值(0-1)
+func GetSunCodeThreshold() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.SunCodeThreshold > 0 {
+		return instance.Settings.SunCodeThreshold
+	}
+	return 0.75
+}
+
+// GetQRWithdrawThreshold 获取二维码置信度达到多少时撤回(0-1)
+func GetQRWithdrawThreshold() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.QRWithdrawThreshold > 0 {
+		return instance.Settings.QRWithdrawThreshold
+	}
+	return 0.6
+}
+
+// GetQRReviewThreshold 获取二维码置信度达到多少时进入人工复核(0-1),未配置时为0.4,返回0表示关闭复核
+func GetQRReviewThreshold() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.QRReviewThreshold != nil {
+		if threshold := *instance.Settings.QRReviewThreshold; threshold > 0 {
+			return threshold
+		}
+		return 0
+	}
+	return 0.4
+}
+
+// GetMaxVideoSizeMB 获取允许下载的视频最大体积(MB)
+func GetMaxVideoSizeMB() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.MaxVideoSizeMB > 0 {
+		return instance.Settings.MaxVideoSizeMB
+	}
+	return 64
+}
+
+// GetMaxImageSizeMB 获取允许下载的图片最大体积(MB)
+func GetMaxImageSizeMB() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.MaxImageSizeMB > 0 {
+		return instance.Settings.MaxImageSizeMB
+	}
+	return 10
+}
+
+// GetDownloadTimeout 获取下载单个媒体文件的超时时间(秒)
+func GetDownloadTimeout() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.DownloadTimeout > 0 {
+		return instance.Settings.DownloadTimeout
+	}
+	return 60
+}
+
+// GetFFmpegPath 获取ffmpeg可执行文件路径,为空时自动查找
+func GetFFmpegPath() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.FFmpegPath
+	}
+	return ""
+}
+
+// GetWithdrawWithoutFrames 获取无法抽帧时是否按视频长度直接撤回短视频
+func GetWithdrawWithoutFrames() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.WithdrawWithoutFrames
+	}
+	return false
+}
+
+// GetFrameSampling 获取视频抽帧策略 fps scene edges count adaptive
+func GetFrameSampling() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameSampling != "" {
+		return instance.Settings.FrameSampling
+	}
+	return "fps"
+}
+
+// GetFrameFPS 获取fps和edges策略每秒抽取的帧数
+func GetFrameFPS() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameFPS > 0 {
+		return instance.Settings.FrameFPS
+	}
+	return 1
+}
+
+// GetFrameSceneThreshold 获取scene策略的画面变化阈值(0-1)
+func GetFrameSceneThreshold() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameSceneThreshold > 0 {
+		return instance.Settings.FrameSceneThreshold
+	}
+	return 0.3
+}
+
+// GetFrameEdgeSeconds 获取edges策略检查开头和结尾的秒数
+func GetFrameEdgeSeconds() float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameEdgeSeconds > 0 {
+		return instance.Settings.FrameEdgeSeconds
+	}
+	return 3
+}
+
+// GetFrameCount 获取count策略在整个视频中均匀抽取的帧数
+func GetFrameCount() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameCount > 0 {
+		return instance.Settings.FrameCount
+	}
+	return 8
+}
+
+// GetFrameMax 获取单个视频最多检查的帧数
+func GetFrameMax() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.FrameMax > 0 {
+		return instance.Settings.FrameMax
+	}
+	return 60
+}
+
+// GetScanWorkers 获取单个视频同时检测的帧数
+func GetScanWorkers() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ScanWorkers > 0 {
+		return instance.Settings.ScanWorkers
+	}
+	return 2
+}
+
+// GetVideoScanTimeout 获取单个视频逐帧检测的时间上限(秒)
+func GetVideoScanTimeout() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.VideoScanTimeout > 0 {
+		return instance.Settings.VideoScanTimeout
+	}
+	return 30
+}
+
+// GetInconclusiveAction 获取视频检测超时未得出结论时的处理方式 pass withdraw review
+func GetInconclusiveAction() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.InconclusiveAction != "" {
+		return instance.Settings.InconclusiveAction
+	}
+	return "review"
+}
+
+// GetQRSearchProfile 获取图片二维码搜索档位 fast balanced thorough
+func GetQRSearchProfile() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.QRSearchProfile != "" {
+		return instance.Settings.QRSearchProfile
+	}
+	return "balanced"
+}
+
+// GetRecordEvents 获取录制onebot事件的文件路径,为空时不录制
+func GetRecordEvents() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.RecordEvents
+	}
+	return ""
+}
+
+// GetShadowMode 获取指定群是否处于影子模式,全局开启或群在shadow_groups中时为true
+func GetShadowMode(groupID string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance == nil {
+		return false
+	}
+	if instance.Settings.ShadowMode {
+		return true
+	}
+	for _, id := range instance.Settings.ShadowGroups {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetShadowReportGroup 获取接收影子模式判定的群号,为空时不发送
+func GetShadowReportGroup() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.ShadowReportGroup
+	}
+	return ""
+}
+
+// GetReviewGroup 获取接收待复核消息的管理群
+func GetReviewGroup() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.ReviewGroup
+	}
+	return ""
+}
+
+// GetReviewUsers 获取私聊接收待复核消息的管理员
+func GetReviewUsers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.ReviewUsers
+	}
+	return nil
+}
+
+// GetReviewApproveCommand 获取批准撤回待复核消息的指令
+func GetReviewApproveCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ReviewApproveCommand != "" {
+		return instance.Settings.ReviewApproveCommand
+	}
+	return "通过"
+}
+
+// GetReviewRejectCommand 获取放行待复核消息的指令
+func GetReviewRejectCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ReviewRejectCommand != "" {
+		return instance.Settings.ReviewRejectCommand
+	}
+	return "驳回"
+}
+
+// GetReviewExpireMinutes 获取待复核消息的有效期(分钟)
+func GetReviewExpireMinutes() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.ReviewExpireMinutes > 0 {
+		return instance.Settings.ReviewExpireMinutes
+	}
+	return 60
+}
+
+// GetPunishLadder 获取违规阶梯处罚,为空时按set_group_kick处理
+func GetPunishLadder() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.PunishLadder
+	}
+	return nil
+}
+
+// GetPunishDecayHours 获取违规次数衰减的周期(小时)
+func GetPunishDecayHours() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.PunishDecayHours > 0 {
+		return instance.Settings.PunishDecayHours
+	}
+	return 72
+}
+
+// GetRaidThreshold 获取触发全员禁言的撤回条数,0为关闭
+func GetRaidThreshold() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.RaidThreshold
+	}
+	return 0
+}
+
+// GetRaidWindowSeconds 获取统计刷屏的时间窗口(秒)
+func GetRaidWindowSeconds() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.RaidWindowSeconds > 0 {
+		return instance.Settings.RaidWindowSeconds
+	}
+	return 60
+}
+
+// GetRaidMuteMinutes 获取刷屏时全员禁言的分钟数
+func GetRaidMuteMinutes() int {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.RaidMuteMinutes > 0 {
+		return instance.Settings.RaidMuteMinutes
+	}
+	return 10
+}
+
+// GetUnmuteCommand 获取解除禁言的指令
+func GetUnmuteCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.UnmuteCommand != "" {
+		return instance.Settings.UnmuteCommand
+	}
+	return "解除禁言"
+}
+
+// GetAdminToken 获取禁言等管理接口的token,为空时这些接口不可用
+func GetAdminToken() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.AdminToken
+	}
+	return ""
+}
+
+// GetVideoCheck 获取各群默认是否检测视频
+func GetVideoCheck() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.VideoCheck
+	}
+	return false
+}
+
+// GetImageCheck 获取各群默认是否检测图片
+func GetImageCheck() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.ImageCheck
+	}
+	return false
+}
+
+// GetCommandPrefix 获取群内指令的前缀
+func GetCommandPrefix() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.CommandPrefix
+	}
+	return ""
+}
+
+// GetSuperUsers 获取在所有群都可以使用管理指令的QQ
+func GetSuperUsers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil {
+		return instance.Settings.SuperUsers
+	}
+	return nil
+}
+
+// GetStatusCommand 获取查看本群检测设置的指令
+func GetStatusCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.StatusCommand != "" {
+		return instance.Settings.StatusCommand
+	}
+	return "检测状态"
+}
+
+// GetHelpCommand 获取列出群内指令的指令
+func GetHelpCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.HelpCommand != "" {
+		return instance.Settings.HelpCommand
+	}
+	return "帮助"
+}
+
+// GetSetCommand 获取按群修改设置的指令
+func GetSetCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.SetCommand != "" {
+		return instance.Settings.SetCommand
+	}
+	return "设置"
+}
+
+// GetUnsetCommand 获取恢复群设置为config.yml中的值的指令
+func GetUnsetCommand() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if instance != nil && instance.Settings.UnsetCommand != "" {
+		return instance.Settings.UnsetCommand
+	}
+	return "恢复设置"
+}
+
+// RuleActionSeparator 分隔撤回规则和命中后的处罚
+const RuleActionSeparator = "=>"
+
+// SplitRuleAction 拆分 "规则 => 处罚" 形式的撤回规则,没有指定处罚时action为空
+func SplitRuleAction(entry string) (rule, action string) {
+	i := strings.LastIndex(entry, RuleActionSeparator)
+	if i < 0 {
+		return entry, ""
+	}
+	return strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+len(RuleActionSeparator):])
+}
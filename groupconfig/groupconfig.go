@@ -0,0 +1,323 @@
+// Package groupconfig 按群覆盖配置文件中的设置,未覆盖的设置继承config.yml
+package groupconfig
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/jsonfile"
+)
+
+// ErrInvalid 表示设置项不存在或值无法解析,与保存失败区分
+var ErrInvalid = errors.New("invalid group setting")
+
+// Settings 是一个群最终生效的设置
+type Settings struct {
+	VideoCheck              bool
+	ImageCheck              bool
+	VideoSecondLimit        int
+	CheckVideoQRCode        bool
+	QRLimit                 int
+	WithdrawNotice          string
+	WithdrawWords           []string
+	SetGroupKick            bool
+	KickAndRejectAddRequest bool
+	ShadowMode              bool
+}
+
+// Overrides 是一个群覆盖的设置,为nil的项继承config.yml
+type Overrides struct {
+	VideoCheck              *bool     `json:"video_check,omitempty"`
+	ImageCheck              *bool     `json:"image_check,omitempty"`
+	VideoSecondLimit        *int      `json:"video_second_limit,omitempty"`
+	CheckVideoQRCode        *bool     `json:"check_video_qrcode,omitempty"`
+	QRLimit                 *int      `json:"qr_limit,omitempty"`
+	WithdrawNotice          *string   `json:"withdraw_notice,omitempty"`
+	WithdrawWords           *[]string `json:"withdraw_words,omitempty"`
+	SetGroupKick            *bool     `json:"set_group_kick,omitempty"`
+	KickAndRejectAddRequest *bool     `json:"kick_and_reject_add_request,omitempty"`
+	ShadowMode              *bool     `json:"shadow_mode,omitempty"`
+}
+
+// Key 描述一项可以按群覆盖的设置,名称与config.yml中的配置项相同
+type Key struct {
+	Name        string
+	Description string
+	parse       func(o *Overrides, value string) error
+	clear       func(o *Overrides)
+	apply       func(s *Settings, o *Overrides)
+	isSet       func(o *Overrides) bool
+	format      func(s *Settings) string
+}
+
+// Value 返回该设置在s中的值
+func (k Key) Value(s Settings) string {
+	return k.format(&s)
+}
+
+func newKey[T any](name, description string, parse func(string) (T, error), override func(*Overrides) **T, setting func(*Settings) *T) Key {
+	return Key{
+		Name:        name,
+		Description: description,
+		parse: func(o *Overrides, value string) error {
+			v, err := parse(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*override(o) = &v
+			return nil
+		},
+		clear: func(o *Overrides) { *override(o) = nil },
+		apply: func(s *Settings, o *Overrides) {
+			if v := *override(o); v != nil {
+				*setting(s) = *v
+			}
+		},
+		isSet: func(o *Overrides) bool { return *override(o) != nil },
+		format: func(s *Settings) string {
+			if words, ok := any(*setting(s)).([]string); ok {
+				return strings.Join(words, ",")
+			}
+			return fmt.Sprint(*setting(s))
+		},
+	}
+}
+
+// Keys 是所有可以按群覆盖的设置
+var Keys = []Key{
+	newKey("video_check", "检测视频", parseBool,
+		func(o *Overrides) **bool { return &o.VideoCheck }, func(s *Settings) *bool { return &s.VideoCheck }),
+	newKey("image_check", "检测图片", parseBool,
+		func(o *Overrides) **bool { return &o.ImageCheck }, func(s *Settings) *bool { return &s.ImageCheck }),
+	newKey("video_second_limit", "撤回短于该秒数的视频", parsePositiveInt,
+		func(o *Overrides) **int { return &o.VideoSecondLimit }, func(s *Settings) *int { return &s.VideoSecondLimit }),
+	newKey("check_video_qrcode", "逐帧检查视频中的二维码", parseBool,
+		func(o *Overrides) **bool { return &o.CheckVideoQRCode }, func(s *Settings) *bool { return &s.CheckVideoQRCode }),
+	newKey("qr_limit", "包含二维码的帧数达到该值时撤回", parsePositiveInt,
+		func(o *Overrides) **int { return &o.QRLimit }, func(s *Settings) *int { return &s.QRLimit }),
+	newKey("withdraw_notice", "撤回时的提示", parseNonEmpty,
+		func(o *Overrides) **string { return &o.WithdrawNotice }, func(s *Settings) *string { return &s.WithdrawNotice }),
+	newKey("withdraw_words", "撤回关键词,用逗号分隔", parseWords,
+		func(o *Overrides) **[]string { return &o.WithdrawWords }, func(s *Settings) *[]string { return &s.WithdrawWords }),
+	newKey("set_group_kick", "撤回后踢出发送者", parseBool,
+		func(o *Overrides) **bool { return &o.SetGroupKick }, func(s *Settings) *bool { return &s.SetGroupKick }),
+	newKey("kick_and_reject_add_request", "踢出后拒绝再次加群", parseBool,
+		func(o *Overrides) **bool { return &o.KickAndRejectAddRequest }, func(s *Settings) *bool { return &s.KickAndRejectAddRequest }),
+	newKey("shadow_mode", "影子模式,只记录不撤回", parseBool,
+		func(o *Overrides) **bool { return &o.ShadowMode }, func(s *Settings) *bool { return &s.ShadowMode }),
+}
+
+// Lookup 按名称查找设置项
+func Lookup(name string) (Key, bool) {
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "on", "1", "yes", "开", "开启":
+		return true, nil
+	case "false", "off", "0", "no", "关", "关闭":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean, use true or false", value)
+}
+
+func parsePositiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive integer", value)
+	}
+	return n, nil
+}
+
+func parseNonEmpty(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", fmt.Errorf("value must not be empty")
+	}
+	return value, nil
+}
+
+func parseWords(value string) ([]string, error) {
+	words := []string{}
+	for _, word := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '，' }) {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words, nil
+}
+
+// defaults 返回config.yml中的设置
+func defaults(groupID string) Settings {
+	return Settings{
+		VideoCheck:              config.GetVideoCheck(),
+		ImageCheck:              config.GetImageCheck(),
+		VideoSecondLimit:        config.GetVideoSecondLimit(),
+		CheckVideoQRCode:        config.GetCheckVideoQRCode(),
+		QRLimit:                 config.GetQRLimit(),
+		WithdrawNotice:          config.GetWithdrawNotice(),
+		WithdrawWords:           config.GetWithdrawWords(),
+		SetGroupKick:            config.GetSetGroupKick(),
+		KickAndRejectAddRequest: config.GetKickAndRejectAddRequest(),
+		ShadowMode:              config.GetShadowMode(groupID),
+	}
+}
+
+// Store 持久化保存各群覆盖的设置
+type Store struct {
+	filePath string
+	groups   map[string]*Overrides
+	mu       sync.RWMutex
+}
+
+var global = jsonfile.NewGlobal("groups.json", load)
+
+// GetInstance 返回全局群设置,首次调用时从文件加载,文件不存在时从旧的config.ini迁移
+func GetInstance() *Store {
+	return global.Get()
+}
+
+// Open 从filePath重新加载全局群设置,需要在处理事件之前调用
+func Open(filePath string) *Store {
+	return global.Open(filePath)
+}
+
+// load 加载filePath,文件不存在时从同一目录中旧的config.ini迁移
+func load(filePath string) *Store {
+	s := New(filePath)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if err := s.migrate(filepath.Join(filepath.Dir(filePath), "config.ini")); err != nil {
+			log.Printf("Failed to migrate config.ini: %v", err)
+		}
+	}
+	return s
+}
+
+// New 从filePath加载群设置,文件不存在时为空
+func New(filePath string) *Store {
+	s := &Store{filePath: filePath, groups: map[string]*Overrides{}}
+	found, err := jsonfile.Load(filePath, &s.groups)
+	if err != nil {
+		log.Printf("Failed to load group settings: %v", err)
+		s.groups = map[string]*Overrides{}
+		return s
+	}
+	if !found {
+		return s
+	}
+	fmt.Printf("成功加载 %d 个群的设置\n", len(s.groups))
+	return s
+}
+
+// save 保存群设置,调用者需持有写锁
+func (s *Store) save() error {
+	return jsonfile.Save(s.filePath, s.groups)
+}
+
+// Get 返回群最终生效的设置
+func (s *Store) Get(groupID string) Settings {
+	settings := defaults(groupID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if o, ok := s.groups[groupID]; ok {
+		for _, k := range Keys {
+			k.apply(&settings, o)
+		}
+	}
+	return settings
+}
+
+// Overridden 返回群覆盖了的设置项名称,按Keys的顺序
+func (s *Store) Overridden(groupID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.groups[groupID]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, k := range Keys {
+		if k.isSet(o) {
+			names = append(names, k.Name)
+		}
+	}
+	return names
+}
+
+// Set 校验并覆盖群的一项设置,设置项不存在或值无效时返回的错误包含ErrInvalid
+func (s *Store) Set(groupID, name, value string) error {
+	k, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: unknown group setting %q", ErrInvalid, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.groups[groupID]
+	if !ok {
+		o = &Overrides{}
+	}
+	if err := k.parse(o, value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	s.groups[groupID] = o
+	return s.save()
+}
+
+// Unset 取消群对一项设置的覆盖,恢复继承config.yml
+func (s *Store) Unset(groupID, name string) error {
+	k, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: unknown group setting %q", ErrInvalid, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.groups[groupID]
+	if !ok {
+		return nil
+	}
+	k.clear(o)
+	if *o == (Overrides{}) {
+		delete(s.groups, groupID)
+	}
+	return s.save()
+}
+
+// Groups 返回覆盖了设置的群号
+func (s *Store) Groups() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]string, 0, len(s.groups))
+	for id := range s.groups {
+		groups = append(groups, id)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Get 返回群最终生效的设置
+func Get(groupID string) Settings {
+	return GetInstance().Get(groupID)
+}
+
+// Set 校验并覆盖群的一项设置
+func Set(groupID, name, value string) error {
+	return GetInstance().Set(groupID, name, value)
+}
+
+// Unset 取消群对一项设置的覆盖
+func Unset(groupID, name string) error {
+	return GetInstance().Unset(groupID, name)
+}
@@ -0,0 +1,104 @@
+package groupconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
+)
+
+func loadConfig(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := strings.Replace(template.ConfigTemplate, `withdraw_words : [""]`, `withdraw_words : ["免费资料"]`, 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	loadConfig(t)
+	path := filepath.Join(t.TempDir(), "groups.json")
+	s := New(path)
+
+	base := s.Get("100")
+	if base.VideoSecondLimit != 5 || base.VideoCheck || !reflect.DeepEqual(base.WithdrawWords, []string{"免费资料"}) {
+		t.Fatalf("defaults = %+v, want the values from config.yml", base)
+	}
+
+	for _, c := range []struct{ name, value string }{
+		{"video_check", "on"},
+		{"video_second_limit", "8"},
+		{"withdraw_words", "加群, 引流，代理"},
+	} {
+		if err := s.Set("100", c.name, c.value); err != nil {
+			t.Fatalf("Set(%s, %q) = %v", c.name, c.value, err)
+		}
+	}
+	for _, c := range []struct{ name, value string }{
+		{"video_second_limit", "0"},
+		{"qr_limit", "many"},
+		{"set_group_kick", "maybe"},
+		{"withdraw_notice", " "},
+		{"port", "8080"},
+	} {
+		if err := s.Set("100", c.name, c.value); err == nil {
+			t.Errorf("Set(%s, %q) accepted an invalid value", c.name, c.value)
+		}
+	}
+
+	// 重新加载后覆盖仍然有效,其它群不受影响
+	s = New(path)
+	got := s.Get("100")
+	want := base
+	want.VideoCheck = true
+	want.VideoSecondLimit = 8
+	want.WithdrawWords = []string{"加群", "引流", "代理"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get after reload = %+v, want %+v", got, want)
+	}
+	if other := s.Get("200"); !reflect.DeepEqual(other, base) {
+		t.Errorf("another group = %+v, want defaults", other)
+	}
+	if names := s.Overridden("100"); !reflect.DeepEqual(names, []string{"video_check", "video_second_limit", "withdraw_words"}) {
+		t.Errorf("Overridden = %v", names)
+	}
+
+	for _, name := range []string{"video_check", "video_second_limit", "withdraw_words"} {
+		if err := s.Unset("100", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if groups := New(path).Groups(); len(groups) != 0 {
+		t.Errorf("groups left after unsetting every override: %v", groups)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	loadConfig(t)
+	dir := t.TempDir()
+	iniPath := filepath.Join(dir, "config.ini")
+	legacy := "[100]\nhandleVideoMessage = true\nhandleImageMessage = false\n\n[200]\nhandleImageMessage = true\n"
+	if err := os.WriteFile(iniPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(filepath.Join(dir, "groups.json"))
+	if err := s.migrate(iniPath); err != nil {
+		t.Fatal(err)
+	}
+	s = New(filepath.Join(dir, "groups.json"))
+	if g := s.Get("100"); !g.VideoCheck || g.ImageCheck {
+		t.Errorf("group 100 = video %v image %v, want true false", g.VideoCheck, g.ImageCheck)
+	}
+	if g := s.Get("200"); g.VideoCheck || !g.ImageCheck {
+		t.Errorf("group 200 = video %v image %v, want false true", g.VideoCheck, g.ImageCheck)
+	}
+}
@@ -0,0 +1,56 @@
+package groupconfig
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/ini.v1"
+)
+
+// legacyKeys 是旧版config.ini中每个群的开关与新设置项的对应关系
+var legacyKeys = map[string]string{
+	"handleVideoMessage": "video_check",
+	"handleImageMessage": "image_check",
+}
+
+// migrate 把旧版config.ini中按群保存的"true"/"false"开关导入,config.ini保留不动
+func (s *Store) migrate(iniPath string) error {
+	if _, err := os.Stat(iniPath); os.IsNotExist(err) {
+		return nil
+	}
+	file, err := ini.Load(iniPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	migrated := 0
+	for _, section := range file.Sections() {
+		if section.Name() == ini.DefaultSection {
+			continue
+		}
+		o := &Overrides{}
+		for legacy, name := range legacyKeys {
+			if !section.HasKey(legacy) {
+				continue
+			}
+			k, _ := Lookup(name)
+			if err := k.parse(o, section.Key(legacy).String()); err != nil {
+				return fmt.Errorf("group %s: %w", section.Name(), err)
+			}
+		}
+		if *o != (Overrides{}) {
+			s.groups[section.Name()] = o
+			migrated++
+		}
+	}
+	if migrated == 0 {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	fmt.Printf("已从%s迁移%d个群的检测开关到%s\n", iniPath, migrated, s.filePath)
+	return nil
+}
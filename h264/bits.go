@@ -0,0 +1,101 @@
+package h264
+
+import "errors"
+
+// errTruncated 表示码流在语法元素中途结束
+var errTruncated = errors.New("h264: truncated bitstream")
+
+// unescapeRBSP 去掉NAL单元中的防竞争字节(00 00 03)
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// bitReader 按位读取RBSP,读过末尾时记录错误并返回0,由调用方在合适的位置检查err
+type bitReader struct {
+	data []byte
+	pos  int // 位偏移
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (r *bitReader) bit() uint32 {
+	if r.pos >= len(r.data)*8 {
+		r.err = errTruncated
+		return 0
+	}
+	b := uint32(r.data[r.pos>>3]>>(7-uint(r.pos&7))) & 1
+	r.pos++
+	return b
+}
+
+func (r *bitReader) flag() bool { return r.bit() == 1 }
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | r.bit()
+	}
+	return v
+}
+
+// ue 读取无符号指数哥伦布码
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.bit() == 0 {
+		if r.err != nil || zeros >= 31 {
+			r.err = errTruncated
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.u(zeros)
+}
+
+// se 读取有符号指数哥伦布码
+func (r *bitReader) se() int32 {
+	k := r.ue()
+	if k&1 == 1 {
+		return int32((k + 1) / 2)
+	}
+	return -int32(k / 2)
+}
+
+func (r *bitReader) byteAligned() bool { return r.pos&7 == 0 }
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// moreRBSPData 报告rbsp_trailing_bits之前是否还有数据
+func (r *bitReader) moreRBSPData() bool {
+	last := len(r.data) - 1
+	for last >= 0 && r.data[last] == 0 {
+		last--
+	}
+	if last < 0 {
+		return false
+	}
+	// 最后一个为1的位是rbsp_stop_one_bit
+	stop := last*8 + 7
+	for b := r.data[last]; b&1 == 0; b >>= 1 {
+		stop--
+	}
+	return r.pos < stop
+}
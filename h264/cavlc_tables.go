@@ -0,0 +1,215 @@
+package h264
+
+// 以下是CAVLC的变长码表,按(码长, 码字)给出,下标含义见各表注释
+
+// coeffTokenLen/coeffTokenBits 按nC范围分为4张表,下标为TotalCoeff*4+TrailingOnes
+var coeffTokenLen = [4][4 * 17]uint8{
+	{
+		1, 0, 0, 0,
+		6, 2, 0, 0, 8, 6, 3, 0, 9, 8, 7, 5, 10, 9, 8, 6,
+		11, 10, 9, 7, 13, 11, 10, 8, 13, 13, 11, 9, 13, 13, 13, 10,
+		14, 14, 13, 11, 14, 14, 14, 13, 15, 15, 14, 14, 15, 15, 15, 14,
+		16, 15, 15, 15, 16, 16, 16, 15, 16, 16, 16, 16, 16, 16, 16, 16,
+	},
+	{
+		2, 0, 0, 0,
+		6, 2, 0, 0, 6, 5, 3, 0, 7, 6, 6, 4, 8, 6, 6, 4,
+		8, 7, 7, 5, 9, 8, 8, 6, 11, 9, 9, 6, 11, 11, 11, 7,
+		12, 11, 11, 9, 12, 12, 12, 11, 12, 12, 12, 11, 13, 13, 13, 12,
+		13, 13, 13, 13, 13, 14, 13, 13, 14, 14, 14, 13, 14, 14, 14, 14,
+	},
+	{
+		4, 0, 0, 0,
+		6, 4, 0, 0, 6, 5, 4, 0, 6, 5, 5, 4, 7, 5, 5, 4,
+		7, 5, 5, 4, 7, 6, 6, 4, 7, 6, 6, 4, 8, 7, 7, 5,
+		8, 8, 7, 6, 9, 8, 8, 7, 9, 9, 8, 8, 9, 9, 9, 8,
+		10, 9, 9, 9, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10,
+	},
+	{
+		6, 0, 0, 0,
+		6, 6, 0, 0, 6, 6, 6, 0, 6, 6, 6, 6, 6, 6, 6, 6,
+		6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+		6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+		6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+	},
+}
+
+var coeffTokenBits = [4][4 * 17]uint8{
+	{
+		1, 0, 0, 0,
+		5, 1, 0, 0, 7, 4, 1, 0, 7, 6, 5, 3, 7, 6, 5, 3,
+		7, 6, 5, 4, 15, 6, 5, 4, 11, 14, 5, 4, 8, 10, 13, 4,
+		15, 14, 9, 4, 11, 10, 13, 12, 15, 14, 9, 12, 11, 10, 13, 8,
+		15, 1, 9, 12, 11, 14, 13, 8, 7, 10, 9, 12, 4, 6, 5, 8,
+	},
+	{
+		3, 0, 0, 0,
+		11, 2, 0, 0, 7, 7, 3, 0, 7, 10, 9, 5, 7, 6, 5, 4,
+		4, 6, 5, 6, 7, 6, 5, 8, 15, 6, 5, 4, 11, 14, 13, 4,
+		15, 10, 9, 4, 11, 14, 13, 12, 8, 10, 9, 8, 15, 14, 13, 12,
+		11, 10, 9, 12, 7, 11, 6, 8, 9, 8, 10, 1, 7, 6, 5, 4,
+	},
+	{
+		15, 0, 0, 0,
+		15, 14, 0, 0, 11, 15, 13, 0, 8, 12, 14, 12, 15, 10, 11, 11,
+		11, 8, 9, 10, 9, 14, 13, 9, 8, 10, 9, 8, 15, 14, 13, 13,
+		11, 14, 10, 12, 15, 10, 13, 12, 11, 14, 9, 12, 8, 10, 13, 8,
+		13, 7, 9, 12, 9, 12, 11, 10, 5, 8, 7, 6, 1, 4, 3, 2,
+	},
+	{
+		3, 0, 0, 0,
+		0, 1, 0, 0, 4, 5, 6, 0, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+		32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47,
+		48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63,
+	},
+}
+
+// chromaDCCoeffTokenLen/Bits 是4:2:0色度DC(nC == -1)的coeff_token表
+var chromaDCCoeffTokenLen = [4 * 5]uint8{
+	2, 0, 0, 0,
+	6, 1, 0, 0,
+	6, 6, 3, 0,
+	6, 7, 7, 6,
+	6, 8, 8, 7,
+}
+
+var chromaDCCoeffTokenBits = [4 * 5]uint8{
+	1, 0, 0, 0,
+	7, 1, 0, 0,
+	4, 6, 1, 0,
+	3, 3, 2, 5,
+	2, 3, 2, 0,
+}
+
+// totalZerosLen/Bits 的下标为[TotalCoeff-1][total_zeros]
+var totalZerosLen = [15][16]uint8{
+	{1, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 9},
+	{3, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 6, 6, 6, 6},
+	{4, 3, 3, 3, 4, 4, 3, 3, 4, 5, 5, 6, 5, 6},
+	{5, 3, 4, 4, 3, 3, 3, 4, 3, 4, 5, 5, 5},
+	{4, 4, 4, 3, 3, 3, 3, 3, 4, 5, 4, 5},
+	{6, 5, 3, 3, 3, 3, 3, 3, 4, 3, 6},
+	{6, 5, 3, 3, 3, 2, 3, 4, 3, 6},
+	{6, 4, 5, 3, 2, 2, 3, 3, 6},
+	{6, 6, 4, 2, 2, 3, 2, 5},
+	{5, 5, 3, 2, 2, 2, 4},
+	{4, 4, 3, 3, 1, 3},
+	{4, 4, 2, 1, 3},
+	{3, 3, 1, 2},
+	{2, 2, 1},
+	{1, 1},
+}
+
+var totalZerosBits = [15][16]uint8{
+	{1, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 1},
+	{7, 6, 5, 4, 3, 5, 4, 3, 2, 3, 2, 3, 2, 1, 0},
+	{5, 7, 6, 5, 4, 3, 4, 3, 2, 3, 2, 1, 1, 0},
+	{3, 7, 5, 4, 6, 5, 4, 3, 3, 2, 2, 1, 0},
+	{5, 4, 3, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+	{1, 1, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+	{1, 1, 5, 4, 3, 3, 2, 1, 1, 0},
+	{1, 1, 1, 3, 3, 2, 2, 1, 0},
+	{1, 0, 1, 3, 2, 1, 1, 1},
+	{1, 0, 1, 3, 2, 1, 1},
+	{0, 1, 1, 2, 1, 3},
+	{0, 1, 1, 1, 1},
+	{0, 1, 1, 1},
+	{0, 1, 1},
+	{0, 1},
+}
+
+// chromaDCTotalZerosLen/Bits 是4:2:0色度DC的total_zeros表
+var chromaDCTotalZerosLen = [3][4]uint8{
+	{1, 2, 3, 3},
+	{1, 2, 2},
+	{1, 1},
+}
+
+var chromaDCTotalZerosBits = [3][4]uint8{
+	{1, 1, 1, 0},
+	{1, 1, 0},
+	{1, 0},
+}
+
+// runBeforeLen/Bits 的下标为[min(zerosLeft, 7)-1][run_before]
+var runBeforeLen = [7][15]uint8{
+	{1, 1},
+	{1, 2, 2},
+	{2, 2, 2, 2},
+	{2, 2, 2, 3, 3},
+	{2, 2, 3, 3, 3, 3},
+	{2, 3, 3, 3, 3, 3, 3},
+	{3, 3, 3, 3, 3, 3, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+}
+
+var runBeforeBits = [7][15]uint8{
+	{1, 0},
+	{1, 1, 0},
+	{3, 2, 1, 0},
+	{3, 2, 1, 1, 0},
+	{3, 2, 3, 2, 1, 0},
+	{3, 0, 1, 3, 2, 5, 4},
+	{7, 6, 5, 4, 3, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+}
+
+// intraCBP 把I宏块coded_block_pattern的codeNum映射为CBP(ChromaArrayType为1或2)
+var intraCBP = [48]uint8{
+	47, 31, 15, 0, 23, 27, 29, 30, 7, 11, 13, 14, 39, 43, 45, 46,
+	16, 3, 5, 10, 12, 19, 21, 26, 28, 35, 37, 42, 44, 1, 2, 4,
+	8, 17, 18, 20, 24, 6, 9, 22, 25, 32, 33, 34, 36, 40, 38, 41,
+}
+
+// vlc 是按(码长, 码字)查找的变长码表
+type vlc map[uint32]int
+
+func vlcKey(length, code uint32) uint32 { return length<<16 | code }
+
+// newVLC 由码长和码字表建立查找表,码长为0的项不存在
+func newVLC(lengths, codes []uint8) vlc {
+	v := vlc{}
+	for i, l := range lengths {
+		if l > 0 {
+			v[vlcKey(uint32(l), uint32(codes[i]))] = i
+		}
+	}
+	return v
+}
+
+// read 逐位读取直到匹配到码字,返回表中的下标
+func (v vlc) read(r *bitReader, maxLen int) (int, bool) {
+	var code uint32
+	for l := uint32(1); l <= uint32(maxLen); l++ {
+		code = code<<1 | r.bit()
+		if r.err != nil {
+			return 0, false
+		}
+		if i, ok := v[vlcKey(l, code)]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+var (
+	coeffTokenVLC         [4]vlc
+	chromaDCCoeffTokenVLC = newVLC(chromaDCCoeffTokenLen[:], chromaDCCoeffTokenBits[:])
+	totalZerosVLC         [15]vlc
+	chromaDCTotalZerosVLC [3]vlc
+	runBeforeVLC          [7]vlc
+)
+
+func init() {
+	for i := range coeffTokenVLC {
+		coeffTokenVLC[i] = newVLC(coeffTokenLen[i][:], coeffTokenBits[i][:])
+	}
+	for i := range totalZerosVLC {
+		totalZerosVLC[i] = newVLC(totalZerosLen[i][:], totalZerosBits[i][:])
+	}
+	for i := range chromaDCTotalZerosVLC {
+		chromaDCTotalZerosVLC[i] = newVLC(chromaDCTotalZerosLen[i][:], chromaDCTotalZerosBits[i][:])
+	}
+	for i := range runBeforeVLC {
+		runBeforeVLC[i] = newVLC(runBeforeLen[i][:], runBeforeBits[i][:])
+	}
+}
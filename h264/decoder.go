@@ -0,0 +1,282 @@
+// Package h264 是一个只解码I帧亮度的纯Go H.264解码器,供没有ffmpeg时从视频中抽帧检测二维码
+//
+// 支持8位4:2:0的逐行码流,包括Baseline、Main和High档次的I条带(CAVLC和CABAC、4x4/8x8变换、量化矩阵、I_PCM)
+// 不做去块滤波,输出的灰度图在块边界处略有方块感,不影响二维码识别
+// 不支持隔行(场编码/MBAFF)、FMO、4:2:2/4:4:4和高位深码流
+package h264
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrNotIntra 表示样本不是完整的I帧,无法单独解码
+var ErrNotIntra = errors.New("h264: not an intra picture")
+
+// NAL单元类型
+const (
+	nalSlice    = 1
+	nalSliceIDR = 5
+	nalSPS      = 7
+	nalPPS      = 8
+)
+
+// Decoder 解码MP4中AVC轨道的样本
+type Decoder struct {
+	// MaxPixels 大于0时,宽高乘积超过该值的图像返回ErrUnsupported,不分配内存
+	MaxPixels  int
+	lengthSize int
+	sps        map[uint32]*sps
+	pps        map[uint32]*pps
+}
+
+// NewDecoder 用avcC box的内容创建解码器,序列不受支持时返回ErrUnsupported
+func NewDecoder(avcC []byte) (*Decoder, error) {
+	lengthSize, spsList, ppsList, err := parseAVCConfig(avcC)
+	if err != nil {
+		return nil, err
+	}
+	d := &Decoder{lengthSize: lengthSize, sps: map[uint32]*sps{}, pps: map[uint32]*pps{}}
+	for _, nal := range append(spsList, ppsList...) {
+		if err := d.parameterSet(nal); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.sps) == 0 || len(d.pps) == 0 {
+		return nil, fmt.Errorf("h264: avcC has no parameter sets")
+	}
+	for _, s := range d.sps {
+		if err := s.check(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// parameterSet 解析SPS或PPS,其它NAL单元忽略
+func (d *Decoder) parameterSet(nal []byte) error {
+	if len(nal) < 2 {
+		return nil
+	}
+	switch nal[0] & 0x1F {
+	case nalSPS:
+		s, err := parseSPS(unescapeRBSP(nal[1:]))
+		if err != nil {
+			return err
+		}
+		d.sps[s.id] = s
+	case nalPPS:
+		p, err := parsePPS(unescapeRBSP(nal[1:]), d.sps)
+		if err != nil {
+			return err
+		}
+		d.pps[p.id] = p
+	}
+	return nil
+}
+
+// Decode 解码一个样本(一帧),返回裁剪后的亮度图像
+// 样本中含有P/B条带时返回ErrNotIntra
+func (d *Decoder) Decode(sample []byte) (*image.Gray, error) {
+	var pic *picture
+	for len(sample) > 0 {
+		if len(sample) < d.lengthSize {
+			return nil, errTruncated
+		}
+		var size uint32
+		for _, b := range sample[:d.lengthSize] {
+			size = size<<8 | uint32(b)
+		}
+		sample = sample[d.lengthSize:]
+		if uint64(size) > uint64(len(sample)) {
+			return nil, errTruncated
+		}
+		nal := sample[:size]
+		sample = sample[size:]
+		if len(nal) < 1 {
+			continue
+		}
+
+		switch nal[0] & 0x1F {
+		case nalSPS, nalPPS:
+			if err := d.parameterSet(nal); err != nil {
+				return nil, err
+			}
+		case nalSlice, nalSliceIDR:
+			var err error
+			if pic, err = d.decodeSlice(pic, nal); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pic == nil {
+		return nil, ErrNotIntra
+	}
+	return pic.image()
+}
+
+// sliceHeader 是I条带头中解码需要的字段
+type sliceHeader struct {
+	firstMB         int
+	sliceType       uint32
+	pps             *pps
+	sps             *sps
+	qp              int32
+	redundantPicCnt uint32
+}
+
+// parseSliceHeader 解析条带头,不是I条带时返回ErrNotIntra
+func (d *Decoder) parseSliceHeader(r *bitReader, nalType, nalRefIdc byte) (*sliceHeader, error) {
+	h := &sliceHeader{}
+	h.firstMB = int(r.ue())
+	h.sliceType = r.ue() % 5
+	if h.sliceType != 2 {
+		return nil, ErrNotIntra
+	}
+	ppsID := r.ue()
+	h.pps = d.pps[ppsID]
+	if h.pps == nil {
+		return nil, fmt.Errorf("h264: slice refers to unknown pps %d", ppsID)
+	}
+	h.sps = d.sps[h.pps.spsID]
+	if h.sps == nil {
+		return nil, fmt.Errorf("h264: slice refers to unknown sps %d", h.pps.spsID)
+	}
+	if err := h.sps.check(); err != nil {
+		return nil, err
+	}
+	s := h.sps
+	r.u(int(s.log2MaxFrameNum)) // frame_num
+	if !s.frameMbsOnly && r.flag() {
+		return nil, unsupported("field pictures")
+	}
+	if nalType == nalSliceIDR {
+		r.ue() // idr_pic_id
+	}
+	switch s.pocType {
+	case 0:
+		r.u(int(s.log2MaxPocLsb))
+		if h.pps.bottomFieldPocPresent {
+			r.se()
+		}
+	case 1:
+		if !s.deltaPicOrderZero {
+			r.se()
+			if h.pps.bottomFieldPocPresent {
+				r.se()
+			}
+		}
+	}
+	if h.pps.redundantPicCntPresent {
+		h.redundantPicCnt = r.ue()
+	}
+	if nalRefIdc != 0 {
+		// dec_ref_pic_marking
+		if nalType == nalSliceIDR {
+			r.flag() // no_output_of_prior_pics_flag
+			r.flag() // long_term_reference_flag
+		} else if r.flag() {
+			for i := 0; ; i++ {
+				op := r.ue()
+				if op == 0 {
+					break
+				}
+				if r.err != nil || i > 64 || op > 6 {
+					return nil, fmt.Errorf("h264: invalid memory management control operation")
+				}
+				if op == 1 || op == 3 {
+					r.ue() // difference_of_pic_nums_minus1
+				}
+				if op == 2 {
+					r.ue() // long_term_pic_num
+				}
+				if op == 3 || op == 6 {
+					r.ue() // long_term_frame_idx
+				}
+				if op == 4 {
+					r.ue() // max_long_term_frame_idx_plus1
+				}
+			}
+		}
+	}
+	h.qp = h.pps.picInitQP + r.se()
+	if h.qp < 0 || h.qp > 51 {
+		return nil, fmt.Errorf("h264: invalid slice qp %d", h.qp)
+	}
+	if h.pps.deblockingControl {
+		if r.ue() != 1 {
+			r.se() // slice_alpha_c0_offset_div2
+			r.se() // slice_beta_offset_div2
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return h, nil
+}
+
+// decodeSlice 解码一个条带,pic为nil时按条带引用的参数集创建新的图像
+func (d *Decoder) decodeSlice(pic *picture, nal []byte) (*picture, error) {
+	if len(nal) < 2 {
+		return nil, errTruncated
+	}
+	r := newBitReader(unescapeRBSP(nal[1:]))
+	h, err := d.parseSliceHeader(r, nal[0]&0x1F, nal[0]>>5&3)
+	if err != nil {
+		return nil, err
+	}
+	if h.redundantPicCnt > 0 {
+		return pic, nil
+	}
+	if pic == nil {
+		if pixels := h.sps.widthMbs * 16 * h.sps.heightMbs * 16; d.MaxPixels > 0 && pixels > d.MaxPixels {
+			return nil, unsupported("picture too large (%d pixels, limit %d)", pixels, d.MaxPixels)
+		}
+		pic = newPicture(h.sps)
+	} else if pic.sps != h.sps {
+		return nil, fmt.Errorf("h264: slices of one picture refer to different sequences")
+	}
+	pic.slices++
+	s := &sliceDecoder{pic: pic, r: r, slice: pic.slices, qp: h.qp, pps: h.pps}
+	s.scale = newLevelScale(h.pps.scaling4x4[0], h.pps.scaling8x8[0])
+	if err := s.decode(h.firstMB); err != nil {
+		return nil, err
+	}
+	return pic, nil
+}
+
+// picture 是正在解码的一帧
+type picture struct {
+	sps      *sps
+	widthMbs int
+	luma     []byte
+	stride   int
+	mbs      []macroblock
+	slices   int
+}
+
+func newPicture(s *sps) *picture {
+	return &picture{
+		sps:      s,
+		widthMbs: s.widthMbs,
+		luma:     make([]byte, s.widthMbs*16*s.heightMbs*16),
+		stride:   s.widthMbs * 16,
+		mbs:      make([]macroblock, s.widthMbs*s.heightMbs),
+	}
+}
+
+// image 返回裁剪后的亮度平面,所有宏块都解码后才算完整
+func (pic *picture) image() (*image.Gray, error) {
+	for i := range pic.mbs {
+		if pic.mbs[i].slice == 0 {
+			return nil, fmt.Errorf("h264: picture is missing macroblock %d", i)
+		}
+	}
+	x0, y0, x1, y1 := pic.sps.crop()
+	img := image.NewGray(image.Rect(0, 0, x1-x0, y1-y0))
+	for y := y0; y < y1; y++ {
+		copy(img.Pix[(y-y0)*img.Stride:], pic.luma[y*pic.stride+x0:y*pic.stride+x1])
+	}
+	return img, nil
+}
@@ -0,0 +1,684 @@
+package h264
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+)
+
+// testEncoder 是测试用的CAVLC帧内编码器,覆盖I_PCM、Intra16x16的4种模式、Intra4x4的9种模式、
+// 色度残差、mb_qp_delta和多条带。重建复用解码器的预测和反变换,解码结果必须与编码端的重建逐像素相同
+type testEncoder struct {
+	w   corpus.BitWriter
+	s   *sliceDecoder
+	src *image.Gray // 按宏块边界补齐的原图
+	rng *rand.Rand
+}
+
+// encodeTestPicture 把img编码为slices个条带,返回avcC、样本和编码端的重建图像
+func encodeTestPicture(t testing.TB, img *image.Gray, qp int32, slices int) (config, sample []byte, recon *image.Gray) {
+	t.Helper()
+	spsNAL, ppsNAL := corpus.H264SPS(img.Rect.Dx(), img.Rect.Dy()), corpus.H264PPS()
+	d, err := NewDecoder(corpus.AVCConfig(spsNAL, ppsNAL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pic := newPicture(d.sps[0])
+	src := image.NewGray(image.Rect(0, 0, pic.stride, len(pic.luma)/pic.stride))
+	for y := 0; y < src.Rect.Dy(); y++ {
+		for x := 0; x < src.Rect.Dx(); x++ {
+			src.Pix[y*src.Stride+x] = img.GrayAt(minInt(x, img.Rect.Dx()-1), minInt(y, img.Rect.Dy()-1)).Y
+		}
+	}
+
+	var nals [][]byte
+	total := len(pic.mbs)
+	for i := 0; i < slices; i++ {
+		first, last := i*total/slices, (i+1)*total/slices
+		e := &testEncoder{src: src, rng: rand.New(rand.NewSource(int64(i)))}
+		e.s = &sliceDecoder{pic: pic, pps: d.pps[0], slice: i + 1, qp: qp}
+		e.s.scale = newLevelScale(e.s.pps.scaling4x4[0], e.s.pps.scaling8x8[0])
+		corpus.H264SliceHeader(&e.w, first, qp-26)
+		for addr := first; addr < last; addr++ {
+			e.macroblock(addr)
+		}
+		nals = append(nals, corpus.NAL(0x65, e.w.Trailing()))
+	}
+	recon, err = pic.image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return corpus.AVCConfig(spsNAL, ppsNAL), corpus.AVCSample(nals...), recon
+}
+
+func (e *testEncoder) macroblock(addr int) {
+	s := e.s
+	m := &s.pic.mbs[addr]
+	*m = macroblock{slice: s.slice}
+	for i := range m.predModes {
+		m.predModes[i] = -1
+	}
+	switch addr % 7 {
+	case 2:
+		e.pcm(addr, m)
+	case 1, 4, 5:
+		e.intra16x16(addr, m)
+	default:
+		e.intra4x4(addr, m)
+	}
+}
+
+func (e *testEncoder) pcm(addr int, m *macroblock) {
+	s := e.s
+	m.kind = mbPCM
+	m.cbpLuma, m.cbpChroma = 15, 2
+	m.lumaDC = true
+	m.chromaDC = [2]bool{true, true}
+	for i := range m.coeffs {
+		m.coeffs[i] = 16
+	}
+	for c := range m.chromaCoeffs {
+		for i := range m.chromaCoeffs[c] {
+			m.chromaCoeffs[c][i] = 16
+		}
+	}
+	e.w.UE(25)
+	e.w.Align()
+	x0, y0 := s.mbOrigin(addr)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			v := e.src.Pix[(y0+y)*e.src.Stride+x0+x]
+			s.pic.luma[(y0+y)*s.pic.stride+x0+x] = v
+			e.w.U(8, uint32(v))
+		}
+	}
+	for i := 0; i < 2*8*8; i++ {
+		e.w.U(8, uint32(e.rng.Intn(256)))
+	}
+}
+
+// qpDelta 随机调整QP,返回mb_qp_delta
+func (e *testEncoder) qpDelta() int32 {
+	delta := []int32{0, 0, 3, -2, 5, -4}[e.rng.Intn(6)]
+	if q := e.s.qp + delta; q < 12 || q > 36 {
+		delta = 0
+	}
+	e.s.qp += delta
+	return delta
+}
+
+func (e *testEncoder) intra16x16(addr int, m *macroblock) {
+	s := e.s
+	m.kind = mbI16x16
+	m.chromaPredMode = uint8(e.rng.Intn(4))
+	m.cbpChroma = uint8(e.rng.Intn(3))
+	delta := e.qpDelta()
+
+	edges := s.edges(addr, 0, 0, 16, 0)
+	mode := 2
+	for k := 0; k < 4; k++ {
+		candidate := (addr + k) % 4
+		if valid := []bool{edges.hasTop, edges.hasLeft, true, edges.hasTop && edges.hasLeft && edges.hasCorner}; valid[candidate] {
+			mode = candidate
+			break
+		}
+	}
+	var pred [256]int32
+	predict16x16(&edges, mode, pred[:])
+
+	var dc [16]int32
+	for raster := 0; raster < 16; raster++ {
+		bx, by := raster%4, raster/4
+		var res [16]int32
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				res[y*4+x] = e.sample(addr, bx*4+x, by*4+y) - pred[(by*4+y)*16+bx*4+x]
+			}
+		}
+		coef := forward4x4(&res)
+		dc[raster] = coef[0]
+		levels := quantize(&coef, s.qp)
+		s.luma[raster] = [16]int32{}
+		for k := 1; k < 16; k++ {
+			s.luma[raster][k] = levels[zigzag4x4[k]]
+			if levels[zigzag4x4[k]] != 0 {
+				m.cbpLuma = 15
+			}
+		}
+	}
+	dcLevels := quantizeDC(hadamard(&dc), s.qp)
+	for k := range s.dc {
+		s.dc[k] = dcLevels[zigzag4x4[k]]
+	}
+
+	mbType := 1 + mode + 4*int(m.cbpChroma)
+	if m.cbpLuma != 0 {
+		mbType += 12
+	}
+	e.w.UE(uint32(mbType))
+	e.w.UE(uint32(m.chromaPredMode))
+	e.w.SE(delta)
+	m.lumaDC = e.block(s.dc[:], s.totalCoeffPrediction(catLumaDC, addr, 0, 0)) > 0
+	if m.cbpLuma != 0 {
+		for blk := 0; blk < 16; blk++ {
+			raster := blockPos[blk][1]*4 + blockPos[blk][0]
+			m.coeffs[raster] = uint8(e.block(s.luma[raster][1:], s.totalCoeffPrediction(catLumaAC, addr, raster, 0)))
+		}
+	}
+	e.chroma(addr, m)
+	s.reconstruct(addr, m, mbType)
+}
+
+func (e *testEncoder) intra4x4(addr int, m *macroblock) {
+	s := e.s
+	m.kind = mbI4x4
+	m.chromaPredMode = uint8(e.rng.Intn(4))
+	m.cbpChroma = uint8(e.rng.Intn(3))
+	oldQP := s.qp
+	delta := e.qpDelta()
+
+	for blk := 0; blk < 16; blk++ {
+		bx, by := blockPos[blk][0], blockPos[blk][1]
+		raster := by*4 + bx
+		edges := s.edges(addr, bx*4, by*4, 4, blk)
+		valid := func(mode int) bool {
+			switch mode {
+			case 0, 3, 7:
+				return edges.hasTop
+			case 1, 8:
+				return edges.hasLeft
+			case 4, 5, 6:
+				return edges.hasTop && edges.hasLeft && edges.hasCorner
+			}
+			return true
+		}
+		// 轮流使用各种模式,而不是挑误差最小的,保证每种模式都被覆盖
+		mode := 2
+		for k := 0; k < 9; k++ {
+			if candidate := (addr*16 + blk + k) % 9; valid(candidate) {
+				mode = candidate
+				break
+			}
+		}
+		m.predModes[raster] = int8(mode)
+
+		var pred, res [16]int32
+		predictDirectional(&edges, int8(mode), 4, pred[:])
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				res[y*4+x] = e.sample(addr, bx*4+x, by*4+y) - pred[y*4+x]
+			}
+		}
+		coef := forward4x4(&res)
+		levels := quantize(&coef, s.qp)
+		s.luma[raster] = [16]int32{}
+		for k := range levels {
+			s.luma[raster][k] = levels[zigzag4x4[k]]
+			if levels[zigzag4x4[k]] != 0 {
+				m.coeffs[raster]++
+				m.cbpLuma |= 1 << uint(blk/4)
+			}
+		}
+		res = [16]int32{}
+		if m.coeffs[raster] > 0 {
+			s.scale.dequant4x4(&s.luma[raster], s.qp, false, &res)
+			idct4x4(&res)
+		}
+		s.store(addr, bx*4, by*4, 4, pred[:], res[:])
+	}
+
+	e.w.UE(0)
+	for blk := 0; blk < 16; blk++ {
+		bx, by := blockPos[blk][0], blockPos[blk][1]
+		mode, predicted := m.predModes[by*4+bx], s.predictedMode(addr, bx, by)
+		switch {
+		case mode == predicted:
+			e.w.Bit(1)
+		case mode < predicted:
+			e.w.Bit(0)
+			e.w.U(3, uint32(mode))
+		default:
+			e.w.Bit(0)
+			e.w.U(3, uint32(mode-1))
+		}
+	}
+	e.w.UE(uint32(m.chromaPredMode))
+	cbp := m.cbpChroma<<4 | m.cbpLuma
+	for code, v := range intraCBP {
+		if v == cbp {
+			e.w.UE(uint32(code))
+			break
+		}
+	}
+	if cbp == 0 {
+		// 没有残差时不传mb_qp_delta,量化结果全为0,QP保持不变
+		s.qp = oldQP
+	} else {
+		e.w.SE(delta)
+	}
+	for blk := 0; blk < 16; blk++ {
+		if m.cbpLuma>>uint(blk/4)&1 == 0 {
+			continue
+		}
+		raster := blockPos[blk][1]*4 + blockPos[blk][0]
+		e.block(s.luma[raster][:], s.totalCoeffPrediction(catLuma4x4, addr, raster, 0))
+	}
+	e.chroma(addr, m)
+}
+
+// chroma 写入随机的色度残差,解码器只解析不重建
+func (e *testEncoder) chroma(addr int, m *macroblock) {
+	random := func(levels []int32) {
+		for i := range levels {
+			if e.rng.Intn(3) == 0 {
+				levels[i] = []int32{1, -1, 2, -3, 7, -20}[e.rng.Intn(6)]
+			}
+		}
+	}
+	if m.cbpChroma != 0 {
+		for c := 0; c < 2; c++ {
+			var levels [4]int32
+			random(levels[:])
+			m.chromaDC[c] = e.block(levels[:], -1) > 0
+		}
+	}
+	if m.cbpChroma == 2 {
+		for c := 0; c < 2; c++ {
+			for blk := 0; blk < 4; blk++ {
+				var levels [15]int32
+				random(levels[:])
+				m.chromaCoeffs[c][blk] = uint8(e.block(levels[:], e.s.totalCoeffPrediction(catChromaAC, addr, blk, c)))
+			}
+		}
+	}
+}
+
+// sample 返回原图中宏块内(x, y)处的像素
+func (e *testEncoder) sample(addr, x, y int) int32 {
+	x0, y0 := e.s.mbOrigin(addr)
+	return int32(e.src.Pix[(y0+y)*e.src.Stride+x0+x])
+}
+
+// block 用CAVLC写入扫描顺序的残差块,nC为-1表示色度DC,返回非零系数个数
+func (e *testEncoder) block(levels []int32, nC int) int {
+	w := &e.w
+	var level [16]int32
+	var pos [16]int
+	total := 0
+	for i := len(levels) - 1; i >= 0; i-- {
+		if levels[i] != 0 {
+			level[total], pos[total] = levels[i], i
+			total++
+		}
+	}
+	ones := 0
+	for ones < total && ones < 3 && abs32(level[ones]) == 1 {
+		ones++
+	}
+
+	token := total*4 + ones
+	var lengths, codes []uint8
+	switch {
+	case nC == -1:
+		lengths, codes = chromaDCCoeffTokenLen[:], chromaDCCoeffTokenBits[:]
+	case nC < 2:
+		lengths, codes = coeffTokenLen[0][:], coeffTokenBits[0][:]
+	case nC < 4:
+		lengths, codes = coeffTokenLen[1][:], coeffTokenBits[1][:]
+	case nC < 8:
+		lengths, codes = coeffTokenLen[2][:], coeffTokenBits[2][:]
+	default:
+		lengths, codes = coeffTokenLen[3][:], coeffTokenBits[3][:]
+	}
+	w.U(int(lengths[token]), uint32(codes[token]))
+	if total == 0 {
+		return 0
+	}
+
+	suffixLength := 0
+	if total > 10 && ones < 3 {
+		suffixLength = 1
+	}
+	for i := 0; i < total; i++ {
+		if i < ones {
+			if level[i] < 0 {
+				w.Bit(1)
+			} else {
+				w.Bit(0)
+			}
+			continue
+		}
+		code := int(2*level[i] - 2)
+		if level[i] < 0 {
+			code = int(-2*level[i] - 1)
+		}
+		if i == ones && ones < 3 {
+			code -= 2
+		}
+		switch {
+		case suffixLength == 0 && code < 14:
+			w.U(code+1, 1)
+		case suffixLength == 0 && code < 30:
+			w.U(15, 1)
+			w.U(4, uint32(code-14))
+		case suffixLength == 0:
+			w.U(16, 1)
+			w.U(12, uint32(code-30))
+		case code < 15<<uint(suffixLength):
+			w.U(code>>uint(suffixLength)+1, 1)
+			w.U(suffixLength, uint32(code))
+		default:
+			w.U(16, 1)
+			w.U(12, uint32(code-15<<uint(suffixLength)))
+		}
+		if suffixLength == 0 {
+			suffixLength = 1
+		}
+		if abs32(level[i]) > 3<<uint(suffixLength-1) && suffixLength < 6 {
+			suffixLength++
+		}
+	}
+
+	zeros := pos[0] + 1 - total
+	if total < len(levels) {
+		if nC == -1 {
+			w.U(int(chromaDCTotalZerosLen[total-1][zeros]), uint32(chromaDCTotalZerosBits[total-1][zeros]))
+		} else {
+			w.U(int(totalZerosLen[total-1][zeros]), uint32(totalZerosBits[total-1][zeros]))
+		}
+	}
+	for i := 0; i < total-1 && zeros > 0; i++ {
+		run := pos[i] - pos[i+1] - 1
+		table := minInt(zeros, 7) - 1
+		w.U(int(runBeforeLen[table][run]), uint32(runBeforeBits[table][run]))
+		zeros -= run
+	}
+	return total
+}
+
+// forward4x4 是4x4整数正变换,输入输出都是光栅顺序
+func forward4x4(x *[16]int32) (y [16]int32) {
+	var t [16]int32
+	for i := 0; i < 4; i++ {
+		a, b, c, d := x[i*4], x[i*4+1], x[i*4+2], x[i*4+3]
+		t[i*4], t[i*4+1], t[i*4+2], t[i*4+3] = a+b+c+d, 2*a+b-c-2*d, a-b-c+d, a-2*b+2*c-d
+	}
+	for j := 0; j < 4; j++ {
+		a, b, c, d := t[j], t[4+j], t[8+j], t[12+j]
+		y[j], y[4+j], y[8+j], y[12+j] = a+b+c+d, 2*a+b-c-2*d, a-b-c+d, a-2*b+2*c-d
+	}
+	return y
+}
+
+// hadamard 是Intra16x16 DC系数的正变换
+func hadamard(x *[16]int32) (y [16]int32) {
+	var t [16]int32
+	for i := 0; i < 4; i++ {
+		a, b, c, d := x[i*4], x[i*4+1], x[i*4+2], x[i*4+3]
+		t[i*4], t[i*4+1], t[i*4+2], t[i*4+3] = a+b+c+d, a+b-c-d, a-b-c+d, a-b+c-d
+	}
+	for j := 0; j < 4; j++ {
+		a, b, c, d := t[j], t[4+j], t[8+j], t[12+j]
+		y[j], y[4+j], y[8+j], y[12+j] = (a+b+c+d)/2, (a+b-c-d)/2, (a-b-c+d)/2, (a-b+c-d)/2
+	}
+	return y
+}
+
+// quantMF 是4x4量化的乘数,按qP%6和位置类别(偶偶、奇奇、其它)
+var quantMF = [6][3]int64{
+	{13107, 5243, 8066}, {11916, 4660, 7490}, {10082, 4194, 6554},
+	{9362, 3647, 5825}, {8192, 3355, 5243}, {7282, 2893, 4559},
+}
+
+func quantize(coef *[16]int32, qp int32) (levels [16]int32) {
+	qbits := uint(15 + qp/6)
+	for pos, v := range coef {
+		i, j := pos/4, pos%4
+		class := 2
+		switch {
+		case i%2 == 0 && j%2 == 0:
+			class = 0
+		case i%2 == 1 && j%2 == 1:
+			class = 1
+		}
+		levels[pos] = quantizeOne(v, quantMF[qp%6][class], qbits)
+	}
+	return levels
+}
+
+func quantizeDC(coef [16]int32, qp int32) (levels [16]int32) {
+	for pos, v := range coef {
+		levels[pos] = quantizeOne(v, quantMF[qp%6][0], uint(16+qp/6))
+	}
+	return levels
+}
+
+func quantizeOne(v int32, mf int64, qbits uint) int32 {
+	level := int32((int64(abs32(v))*mf + (1<<qbits)/3) >> qbits)
+	if level > 1000 {
+		level = 1000
+	}
+	if v < 0 {
+		return -level
+	}
+	return level
+}
+
+// testImage 生成带渐变、噪点和二维码的灰度图
+func testImage(w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Pix[y*img.Stride+x] = uint8(x*2 + y + rng.Intn(12))
+		}
+	}
+	corpus.Paste(img, corpus.QR("h264", 58, color.Black, color.White), w-62, 4)
+	return img
+}
+
+func psnr(a, b *image.Gray) float64 {
+	var sum float64
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			d := float64(a.GrayAt(x, y).Y) - float64(b.GrayAt(x, y).Y)
+			sum += d * d
+		}
+	}
+	mse := sum / float64(a.Rect.Dx()*a.Rect.Dy())
+	return 10 * math.Log10(255*255/mse)
+}
+
+func TestDecodeIntraCAVLC(t *testing.T) {
+	img := testImage(102, 70)
+	for _, tc := range []struct {
+		name    string
+		qp      int32
+		slices  int
+		minPSNR float64
+	}{
+		{"qp12", 12, 1, 43},
+		{"qp24_slices", 24, 3, 39},
+		{"qp36_slices", 36, 7, 33},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, sample, recon := encodeTestPicture(t, img, tc.qp, tc.slices)
+			d, err := NewDecoder(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := d.Decode(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Rect != img.Rect {
+				t.Fatalf("decoded size %v, want %v", got.Rect, img.Rect)
+			}
+			for i := range got.Pix {
+				if got.Pix[i] != recon.Pix[i] {
+					t.Fatalf("pixel (%d, %d) = %d, encoder reconstructed %d", i%got.Stride, i/got.Stride, got.Pix[i], recon.Pix[i])
+				}
+			}
+			if p := psnr(img, got); p < tc.minPSNR {
+				t.Errorf("PSNR %.1f dB, want at least %.0f dB", p, tc.minPSNR)
+			}
+		})
+	}
+}
+
+func TestDecodePCM(t *testing.T) {
+	img := testImage(64, 48)
+	config, sample := corpus.H264(img)
+	d, err := NewDecoder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.Decode(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got.Pix {
+		if got.Pix[i] != img.Pix[i] {
+			t.Fatalf("I_PCM pixel %d = %d, want %d", i, got.Pix[i], img.Pix[i])
+		}
+	}
+}
+
+func TestDecodeMaxPixels(t *testing.T) {
+	config, sample := corpus.H264(testImage(64, 48))
+	d, err := NewDecoder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MaxPixels = 64*48 - 1
+	if _, err := d.Decode(sample); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Decode over MaxPixels = %v, want ErrUnsupported", err)
+	}
+	d.MaxPixels = 64 * 48
+	if _, err := d.Decode(sample); err != nil {
+		t.Errorf("Decode at MaxPixels = %v", err)
+	}
+}
+
+func TestDecodeInBandParameterSets(t *testing.T) {
+	img := testImage(48, 32)
+	config, sample, recon := encodeTestPicture(t, img, 26, 1)
+	// avcC中的参数集不同,样本内的SPS/PPS优先
+	other, _ := corpus.H264(image.NewGray(image.Rect(0, 0, 16, 16)))
+	d, err := NewDecoder(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, spsList, ppsList, err := parseAVCConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.Decode(append(corpus.AVCSample(spsList[0], ppsList[0]), sample...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Pix) != string(recon.Pix) {
+		t.Error("decoded picture differs from the encoder reconstruction")
+	}
+}
+
+func TestDecodeNotIntra(t *testing.T) {
+	config, _ := corpus.H264(image.NewGray(image.Rect(0, 0, 16, 16)))
+	d, err := NewDecoder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w corpus.BitWriter
+	w.UE(0) // first_mb_in_slice
+	w.UE(5) // slice_type P
+	pSlice := corpus.AVCSample(corpus.NAL(0x41, w.Trailing()))
+	for name, sample := range map[string][]byte{"p_slice": pSlice, "empty": nil, "sei_only": corpus.AVCSample([]byte{0x06, 0x05, 0x00, 0x80})} {
+		if _, err := d.Decode(sample); !errors.Is(err, ErrNotIntra) {
+			t.Errorf("%s: got %v, want ErrNotIntra", name, err)
+		}
+	}
+}
+
+func TestNewDecoderUnsupported(t *testing.T) {
+	// High 4:2:2档次
+	var w corpus.BitWriter
+	w.U(8, 122)
+	w.U(16, 0)
+	w.UE(0)
+	w.UE(2) // chroma_format_idc
+	w.UE(0)
+	w.UE(0)
+	w.Bit(0)
+	w.Bit(0)
+	w.UE(0)
+	w.UE(2)
+	w.UE(0)
+	w.Bit(0)
+	w.UE(0)
+	w.UE(0)
+	w.Bit(1)
+	w.Bit(1)
+	w.Bit(0)
+	w.Bit(0)
+	sps := corpus.NAL(0x67, w.Trailing())
+	if _, err := NewDecoder(corpus.AVCConfig(sps, corpus.H264PPS())); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+	if _, err := NewDecoder([]byte{1, 2, 3}); err == nil {
+		t.Error("expected an error for a truncated avcC")
+	}
+}
+
+// TestVLCTables 检查CAVLC码表是前缀码,否则按位匹配会读错
+func TestVLCTables(t *testing.T) {
+	check := func(name string, lengths, codes []uint8) {
+		for i, li := range lengths {
+			for j, lj := range lengths {
+				if i == j || li == 0 || lj == 0 || li > lj {
+					continue
+				}
+				if uint32(codes[j])>>(lj-li) == uint32(codes[i]) {
+					t.Errorf("%s: code %d is a prefix of code %d", name, i, j)
+				}
+			}
+		}
+	}
+	for i := range coeffTokenLen {
+		check("coeff_token", coeffTokenLen[i][:], coeffTokenBits[i][:])
+	}
+	check("chroma DC coeff_token", chromaDCCoeffTokenLen[:], chromaDCCoeffTokenBits[:])
+	for i := range totalZerosLen {
+		check("total_zeros", totalZerosLen[i][:16-i], totalZerosBits[i][:16-i])
+	}
+	for i := range chromaDCTotalZerosLen {
+		check("chroma DC total_zeros", chromaDCTotalZerosLen[i][:4-i], chromaDCTotalZerosBits[i][:4-i])
+	}
+	for i := range runBeforeLen {
+		n := i + 2
+		if i == 6 {
+			n = 15
+		}
+		check("run_before", runBeforeLen[i][:n], runBeforeBits[i][:n])
+	}
+}
+
+// FuzzDecode 检查损坏的码流只返回错误而不会panic
+func FuzzDecode(f *testing.F) {
+	img := testImage(64, 48)
+	config, sample, _ := encodeTestPicture(f, img, 28, 2)
+	f.Add(sample)
+	_, pcm := corpus.H264(img)
+	f.Add(pcm)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := NewDecoder(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Decode(data)
+	})
+}
@@ -0,0 +1,426 @@
+package h264
+
+import "fmt"
+
+// 宏块类型
+const (
+	mbI4x4 = iota + 1
+	mbI8x8
+	mbI16x16
+	mbPCM
+)
+
+// macroblock 记录已解码宏块中供相邻宏块推导上下文和预测模式的信息
+type macroblock struct {
+	slice          int // 所属条带编号,从1开始,0表示尚未解码
+	kind           uint8
+	transform8x8   bool
+	cbpLuma        uint8
+	cbpChroma      uint8
+	chromaPredMode uint8
+	// predModes 是各4x4块(光栅顺序)的帧内预测模式,不是I_NxN宏块时为-1
+	predModes [16]int8
+	// coeffs 是各4x4亮度块(光栅顺序)的非零系数个数,I16x16宏块只计AC系数
+	coeffs       [16]uint8
+	lumaDC       bool
+	chromaDC     [2]bool
+	chromaCoeffs [2][4]uint8
+}
+
+// blockPos 把luma4x4BlkIdx(解码顺序)映射为宏块内4x4块的坐标(以4x4块为单位)
+var blockPos = func() (pos [16][2]int) {
+	for i := range pos {
+		pos[i] = [2]int{(i/4)%2*2 + i%2, (i/4)/2*2 + (i%4)/2}
+	}
+	return
+}()
+
+// blockIndex 返回宏块内(x, y)处像素所在4x4块的解码顺序
+func blockIndex(x, y int) int {
+	return (y/8)*8 + (x/8)*4 + ((y%8)/4)*2 + (x%8)/4
+}
+
+// sliceDecoder 解码一个I条带
+type sliceDecoder struct {
+	pic   *picture
+	pps   *pps
+	r     *bitReader
+	cabac *cabac
+	scale *levelScale
+	slice int
+	qp    int32
+	// prevQPDelta 是条带中上一个宏块的mb_qp_delta,用于CABAC上下文
+	prevQPDelta int32
+
+	// 当前宏块的残差系数,按扫描顺序
+	luma   [16][16]int32 // 按4x4块的光栅顺序
+	luma8  [4][64]int32
+	dc     [16]int32
+	chroma [16]int32
+}
+
+// decode 从firstMB开始解码条带中的所有宏块
+func (s *sliceDecoder) decode(firstMB int) error {
+	if s.pps.cabac {
+		s.r.align() // cabac_alignment_one_bit
+		s.cabac = &cabac{r: s.r}
+		s.cabac.initContexts(s.qp)
+		if err := s.cabac.initEngine(); err != nil {
+			return err
+		}
+	}
+	for addr := firstMB; ; addr++ {
+		if addr >= len(s.pic.mbs) || s.pic.mbs[addr].slice != 0 {
+			return fmt.Errorf("h264: invalid macroblock address %d", addr)
+		}
+		if err := s.macroblock(addr); err != nil {
+			return fmt.Errorf("h264: macroblock %d: %w", addr, err)
+		}
+		if s.r.err != nil {
+			return fmt.Errorf("h264: macroblock %d: %w", addr, s.r.err)
+		}
+		if s.cabac != nil {
+			if s.cabac.terminate() == 1 {
+				return nil
+			}
+		} else if !s.r.moreRBSPData() {
+			return nil
+		}
+	}
+}
+
+// neighbour 返回当前宏块相邻方向(dx, dy)上同一条带内已解码的宏块,不可用时返回nil
+func (s *sliceDecoder) neighbour(addr, dx, dy int) *macroblock {
+	w := s.pic.widthMbs
+	x, y := addr%w+dx, addr/w+dy
+	if x < 0 || x >= w || y < 0 {
+		return nil
+	}
+	n := y*w + x
+	if n >= addr || s.pic.mbs[n].slice != s.slice {
+		return nil
+	}
+	return &s.pic.mbs[n]
+}
+
+// lumaLeft/lumaAbove 返回4x4块(bx, by)左边/上边的4x4块所在宏块和块下标(光栅顺序)
+func (s *sliceDecoder) lumaLeft(addr, bx, by int) (*macroblock, int) {
+	if bx > 0 {
+		return &s.pic.mbs[addr], by*4 + bx - 1
+	}
+	return s.neighbour(addr, -1, 0), by*4 + 3
+}
+
+func (s *sliceDecoder) lumaAbove(addr, bx, by int) (*macroblock, int) {
+	if by > 0 {
+		return &s.pic.mbs[addr], (by-1)*4 + bx
+	}
+	return s.neighbour(addr, 0, -1), 12 + bx
+}
+
+// chromaLeft/chromaAbove 是色度4x4块(2x2排列)的相邻块
+func (s *sliceDecoder) chromaLeft(addr, blk int) (*macroblock, int) {
+	if blk%2 == 1 {
+		return &s.pic.mbs[addr], blk - 1
+	}
+	return s.neighbour(addr, -1, 0), blk + 1
+}
+
+func (s *sliceDecoder) chromaAbove(addr, blk int) (*macroblock, int) {
+	if blk >= 2 {
+		return &s.pic.mbs[addr], blk - 2
+	}
+	return s.neighbour(addr, 0, -1), blk + 2
+}
+
+// macroblock 解析并重建一个宏块
+func (s *sliceDecoder) macroblock(addr int) error {
+	m := &s.pic.mbs[addr]
+	*m = macroblock{slice: s.slice}
+	for i := range m.predModes {
+		m.predModes[i] = -1
+	}
+
+	mbType := s.mbType(addr)
+	switch {
+	case mbType == 25:
+		return s.pcm(addr, m)
+	case mbType == 0:
+		m.kind = mbI4x4
+		if s.pps.transform8x8 && s.transformSize8x8(addr) {
+			m.kind = mbI8x8
+			m.transform8x8 = true
+		}
+		s.intraPredModes(addr, m)
+		m.chromaPredMode = s.chromaPredMode(addr)
+		m.cbpLuma, m.cbpChroma = s.codedBlockPattern(addr)
+	case mbType <= 24:
+		m.kind = mbI16x16
+		m.chromaPredMode = s.chromaPredMode(addr)
+		m.cbpChroma = uint8((mbType - 1) / 4 % 3)
+		if mbType >= 13 {
+			m.cbpLuma = 15
+		}
+	default:
+		return fmt.Errorf("invalid mb_type %d in I slice", mbType)
+	}
+	if m.chromaPredMode > 3 || m.cbpChroma > 2 {
+		return fmt.Errorf("invalid chroma prediction mode or coded block pattern")
+	}
+
+	var delta int32
+	if m.cbpLuma > 0 || m.cbpChroma > 0 || m.kind == mbI16x16 {
+		delta = s.qpDelta()
+		if delta < -26 || delta > 25 {
+			return fmt.Errorf("invalid mb_qp_delta %d", delta)
+		}
+		s.qp = (s.qp + delta + 52) % 52
+	}
+	s.prevQPDelta = delta
+	if err := s.residual(addr, m); err != nil {
+		return err
+	}
+	if s.r.err != nil {
+		return s.r.err
+	}
+	s.reconstruct(addr, m, mbType)
+	return nil
+}
+
+// pcm 读取I_PCM宏块的原始像素
+func (s *sliceDecoder) pcm(addr int, m *macroblock) error {
+	m.kind = mbPCM
+	m.cbpLuma, m.cbpChroma = 15, 2
+	m.lumaDC = true
+	m.chromaDC = [2]bool{true, true}
+	for i := range m.coeffs {
+		m.coeffs[i] = 16
+	}
+	for c := range m.chromaCoeffs {
+		for i := range m.chromaCoeffs[c] {
+			m.chromaCoeffs[c][i] = 16
+		}
+	}
+	s.prevQPDelta = 0
+
+	s.r.align()
+	x0, y0 := s.mbOrigin(addr)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			s.pic.luma[(y0+y)*s.pic.stride+x0+x] = byte(s.r.u(8))
+		}
+	}
+	for i := 0; i < 2*8*8; i++ {
+		s.r.u(8)
+	}
+	if s.r.err != nil {
+		return s.r.err
+	}
+	if s.cabac != nil {
+		return s.cabac.initEngine()
+	}
+	return nil
+}
+
+// mbOrigin 返回宏块左上角的像素坐标
+func (s *sliceDecoder) mbOrigin(addr int) (int, int) {
+	return addr % s.pic.widthMbs * 16, addr / s.pic.widthMbs * 16
+}
+
+// intraPredModes 读取I_NxN宏块各块的预测模式并按相邻块推导实际模式
+func (s *sliceDecoder) intraPredModes(addr int, m *macroblock) {
+	if m.transform8x8 {
+		for b8 := 0; b8 < 4; b8++ {
+			bx, by := b8%2*2, b8/2*2
+			mode := s.intraPredMode(s.predictedMode(addr, bx, by))
+			for _, i := range []int{0, 1, 4, 5} {
+				m.predModes[by*4+bx+i] = mode
+			}
+		}
+		return
+	}
+	for blk := 0; blk < 16; blk++ {
+		bx, by := blockPos[blk][0], blockPos[blk][1]
+		m.predModes[by*4+bx] = s.intraPredMode(s.predictedMode(addr, bx, by))
+	}
+}
+
+// predictedMode 由左边和上边的块推导预测模式(8.3.1.1)
+func (s *sliceDecoder) predictedMode(addr, bx, by int) int8 {
+	left, li := s.lumaLeft(addr, bx, by)
+	above, ai := s.lumaAbove(addr, bx, by)
+	if left == nil || above == nil {
+		return 2
+	}
+	a, b := left.predModes[li], above.predModes[ai]
+	if a < 0 {
+		a = 2
+	}
+	if b < 0 {
+		b = 2
+	}
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// intraPredMode 读取prev_intra_pred_mode_flag和rem_intra_pred_mode
+func (s *sliceDecoder) intraPredMode(predicted int8) int8 {
+	var prev bool
+	var rem int8
+	if c := s.cabac; c != nil {
+		prev = c.decision(68) == 1
+		if !prev {
+			rem = int8(c.decision(69) | c.decision(69)<<1 | c.decision(69)<<2)
+		}
+	} else {
+		prev = s.r.flag()
+		if !prev {
+			rem = int8(s.r.u(3))
+		}
+	}
+	if prev {
+		return predicted
+	}
+	if rem < predicted {
+		return rem
+	}
+	return rem + 1
+}
+
+func (s *sliceDecoder) mbType(addr int) int {
+	c := s.cabac
+	if c == nil {
+		return int(s.r.ue())
+	}
+	inc := 0
+	for _, n := range []*macroblock{s.neighbour(addr, -1, 0), s.neighbour(addr, 0, -1)} {
+		if n != nil && n.kind != mbI4x4 && n.kind != mbI8x8 {
+			inc++
+		}
+	}
+	if c.decision(3+inc) == 0 {
+		return 0
+	}
+	if c.terminate() == 1 {
+		return 25
+	}
+	t := 1 + 12*int(c.decision(3+3))
+	if c.decision(3+4) == 1 {
+		t += 4 + 4*int(c.decision(3+5))
+	}
+	t += 2 * int(c.decision(3+6))
+	t += int(c.decision(3 + 7))
+	return t
+}
+
+func (s *sliceDecoder) transformSize8x8(addr int) bool {
+	c := s.cabac
+	if c == nil {
+		return s.r.flag()
+	}
+	inc := 0
+	for _, n := range []*macroblock{s.neighbour(addr, -1, 0), s.neighbour(addr, 0, -1)} {
+		if n != nil && n.transform8x8 {
+			inc++
+		}
+	}
+	return c.decision(399+inc) == 1
+}
+
+func (s *sliceDecoder) chromaPredMode(addr int) uint8 {
+	c := s.cabac
+	if c == nil {
+		return uint8(s.r.ue())
+	}
+	inc := 0
+	for _, n := range []*macroblock{s.neighbour(addr, -1, 0), s.neighbour(addr, 0, -1)} {
+		if n != nil && n.kind != mbPCM && n.chromaPredMode != 0 {
+			inc++
+		}
+	}
+	if c.decision(64+inc) == 0 {
+		return 0
+	}
+	if c.decision(67) == 0 {
+		return 1
+	}
+	if c.decision(67) == 0 {
+		return 2
+	}
+	return 3
+}
+
+func (s *sliceDecoder) codedBlockPattern(addr int) (luma, chroma uint8) {
+	c := s.cabac
+	if c == nil {
+		code := s.r.ue()
+		if code >= uint32(len(intraCBP)) {
+			s.r.err = fmt.Errorf("h264: invalid coded_block_pattern %d", code)
+			return 0, 0
+		}
+		return intraCBP[code] & 15, intraCBP[code] >> 4
+	}
+
+	left, above := s.neighbour(addr, -1, 0), s.neighbour(addr, 0, -1)
+	// 相邻8x8块没有残差时条件为1,不可用或I_PCM时为0
+	cond := func(n *macroblock, cbp uint8, b8 int) int {
+		if n == nil || cbp>>uint(b8)&1 != 0 {
+			return 0
+		}
+		return 1
+	}
+	for b8 := 0; b8 < 4; b8++ {
+		var a, b int
+		if b8%2 == 1 {
+			a = cond(&s.pic.mbs[addr], luma, b8-1)
+		} else if left != nil {
+			a = cond(left, left.cbpLuma, b8+1)
+		}
+		if b8 >= 2 {
+			b = cond(&s.pic.mbs[addr], luma, b8-2)
+		} else if above != nil {
+			b = cond(above, above.cbpLuma, b8+2)
+		}
+		luma |= uint8(c.decision(73+a+2*b)) << uint(b8)
+	}
+
+	chromaCond := func(n *macroblock, min uint8) int {
+		if n != nil && n.cbpChroma >= min {
+			return 1
+		}
+		return 0
+	}
+	if c.decision(77+chromaCond(left, 1)+2*chromaCond(above, 1)) == 0 {
+		return luma, 0
+	}
+	return luma, 1 + uint8(c.decision(77+4+chromaCond(left, 2)+2*chromaCond(above, 2)))
+}
+
+func (s *sliceDecoder) qpDelta() int32 {
+	c := s.cabac
+	if c == nil {
+		return s.r.se()
+	}
+	inc := 0
+	if s.prevQPDelta != 0 {
+		inc = 1
+	}
+	if c.decision(60+inc) == 0 {
+		return 0
+	}
+	k := int32(1)
+	ctx := 62
+	for c.decision(ctx) == 1 {
+		k++
+		ctx = 63
+		if k > 104 {
+			break
+		}
+	}
+	if k%2 == 1 {
+		return (k + 1) / 2
+	}
+	return -k / 2
+}
@@ -0,0 +1,361 @@
+package h264
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported 表示码流用到了解码器没有实现的特性
+var ErrUnsupported = errors.New("h264: unsupported stream")
+
+func unsupported(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUnsupported, fmt.Sprintf(format, args...))
+}
+
+// sps 是序列参数集中解码I帧需要的字段
+type sps struct {
+	id                   uint32
+	profileIdc           uint32
+	chromaFormatIdc      uint32
+	bitDepthLuma         uint32
+	bitDepthChroma       uint32
+	transformBypass      bool
+	scalingMatrixPresent bool
+	scaling4x4           [6][16]int32 // 按zigzag顺序
+	scaling8x8           [6][64]int32
+	log2MaxFrameNum      uint32
+	pocType              uint32
+	log2MaxPocLsb        uint32
+	deltaPicOrderZero    bool
+	widthMbs             int
+	heightMbs            int
+	frameMbsOnly         bool
+	mbAdaptiveFrameField bool
+	cropLeft             int
+	cropRight            int
+	cropTop              int
+	cropBottom           int
+}
+
+// pps 是图像参数集中解码I帧需要的字段
+type pps struct {
+	id                     uint32
+	spsID                  uint32
+	cabac                  bool
+	bottomFieldPocPresent  bool
+	numSliceGroups         uint32
+	picInitQP              int32
+	chromaQPOffset         int32
+	deblockingControl      bool
+	constrainedIntraPred   bool
+	redundantPicCntPresent bool
+	transform8x8           bool
+	scaling4x4             [6][16]int32
+	scaling8x8             [6][64]int32
+}
+
+var (
+	flat4x4 = [16]int32{16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16, 16}
+	flat8x8 = func() (m [64]int32) {
+		for i := range m {
+			m[i] = 16
+		}
+		return
+	}()
+	default4x4Intra = [16]int32{6, 13, 13, 20, 20, 20, 28, 28, 28, 28, 32, 32, 32, 37, 37, 42}
+	default4x4Inter = [16]int32{10, 14, 14, 20, 20, 20, 24, 24, 24, 24, 27, 27, 27, 30, 30, 34}
+	default8x8Intra = [64]int32{
+		6, 10, 10, 13, 11, 13, 16, 16, 16, 16, 18, 18, 18, 18, 18, 23,
+		23, 23, 23, 23, 23, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27,
+		27, 27, 27, 27, 29, 29, 29, 29, 29, 29, 29, 31, 31, 31, 31, 31,
+		31, 33, 33, 33, 33, 33, 36, 36, 36, 36, 38, 38, 38, 40, 40, 42,
+	}
+	default8x8Inter = [64]int32{
+		9, 13, 13, 15, 13, 15, 17, 17, 17, 17, 19, 19, 19, 19, 19, 21,
+		21, 21, 21, 21, 21, 22, 22, 22, 22, 22, 22, 22, 24, 24, 24, 24,
+		24, 24, 24, 24, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27, 27,
+		27, 28, 28, 28, 28, 28, 30, 30, 30, 30, 32, 32, 32, 33, 33, 35,
+	}
+)
+
+// readScalingList 读取一个量化矩阵,返回是否使用默认矩阵
+func readScalingList(r *bitReader, list []int32) bool {
+	last, next := int32(8), int32(8)
+	for j := range list {
+		if next != 0 {
+			delta := r.se()
+			next = (last + delta + 256) % 256
+			if j == 0 && next == 0 {
+				return true
+			}
+		}
+		if next != 0 {
+			list[j] = next
+		} else {
+			list[j] = last
+		}
+		last = list[j]
+	}
+	return false
+}
+
+// readScalingMatrix 读取SPS或PPS中的量化矩阵,fallback4x4/fallback8x8是缺省时使用的矩阵(回退规则A或B)
+func readScalingMatrix(r *bitReader, count int, m4 *[6][16]int32, m8 *[6][64]int32, fallback4x4 [6][16]int32, fallback8x8 [6][64]int32) {
+	for i := 0; i < count; i++ {
+		present := r.flag()
+		if i < 6 {
+			switch {
+			case !present && (i == 0 || i == 3):
+				m4[i] = fallback4x4[i]
+			case !present:
+				m4[i] = m4[i-1]
+			case readScalingList(r, m4[i][:]):
+				if i < 3 {
+					m4[i] = default4x4Intra
+				} else {
+					m4[i] = default4x4Inter
+				}
+			}
+			continue
+		}
+		j := i - 6
+		switch {
+		case !present && j < 2:
+			m8[j] = fallback8x8[j]
+		case !present:
+			m8[j] = m8[j-2]
+		case readScalingList(r, m8[j][:]):
+			if j%2 == 0 {
+				m8[j] = default8x8Intra
+			} else {
+				m8[j] = default8x8Inter
+			}
+		}
+	}
+}
+
+// defaultMatrices 返回回退规则A使用的默认矩阵
+func defaultMatrices() (m4 [6][16]int32, m8 [6][64]int32) {
+	for i := range m4 {
+		if i < 3 {
+			m4[i] = default4x4Intra
+		} else {
+			m4[i] = default4x4Inter
+		}
+	}
+	for i := range m8 {
+		if i%2 == 0 {
+			m8[i] = default8x8Intra
+		} else {
+			m8[i] = default8x8Inter
+		}
+	}
+	return
+}
+
+func flatMatrices() (m4 [6][16]int32, m8 [6][64]int32) {
+	for i := range m4 {
+		m4[i] = flat4x4
+	}
+	for i := range m8 {
+		m8[i] = flat8x8
+	}
+	return
+}
+
+// parseSPS 解析去掉NAL头的SPS
+func parseSPS(rbsp []byte) (*sps, error) {
+	r := newBitReader(rbsp)
+	s := &sps{chromaFormatIdc: 1, bitDepthLuma: 8, bitDepthChroma: 8}
+	s.profileIdc = r.u(8)
+	r.u(16) // constraint_set flags, level_idc
+	s.id = r.ue()
+	if s.id > 31 {
+		return nil, fmt.Errorf("h264: invalid sps id %d", s.id)
+	}
+	s.scaling4x4, s.scaling8x8 = flatMatrices()
+	switch s.profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.chromaFormatIdc = r.ue()
+		if s.chromaFormatIdc == 3 {
+			r.flag() // separate_colour_plane_flag
+		}
+		s.bitDepthLuma = r.ue() + 8
+		s.bitDepthChroma = r.ue() + 8
+		s.transformBypass = r.flag()
+		s.scalingMatrixPresent = r.flag()
+		if s.scalingMatrixPresent {
+			count := 8
+			if s.chromaFormatIdc == 3 {
+				count = 12
+			}
+			d4, d8 := defaultMatrices()
+			readScalingMatrix(r, count, &s.scaling4x4, &s.scaling8x8, d4, d8)
+		}
+	}
+	s.log2MaxFrameNum = r.ue() + 4
+	s.pocType = r.ue()
+	switch s.pocType {
+	case 0:
+		s.log2MaxPocLsb = r.ue() + 4
+	case 1:
+		s.deltaPicOrderZero = r.flag()
+		r.se() // offset_for_non_ref_pic
+		r.se() // offset_for_top_to_bottom_field
+		cycle := r.ue()
+		if cycle > 255 {
+			return nil, fmt.Errorf("h264: invalid poc cycle length %d", cycle)
+		}
+		for i := uint32(0); i < cycle; i++ {
+			r.se()
+		}
+	}
+	r.ue()   // max_num_ref_frames
+	r.flag() // gaps_in_frame_num_value_allowed_flag
+	s.widthMbs = int(r.ue()) + 1
+	heightMapUnits := int(r.ue()) + 1
+	s.frameMbsOnly = r.flag()
+	s.heightMbs = heightMapUnits
+	if !s.frameMbsOnly {
+		s.heightMbs *= 2
+		s.mbAdaptiveFrameField = r.flag()
+	}
+	r.flag() // direct_8x8_inference_flag
+	if r.flag() {
+		s.cropLeft = int(r.ue())
+		s.cropRight = int(r.ue())
+		s.cropTop = int(r.ue())
+		s.cropBottom = int(r.ue())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if s.widthMbs > 1024 || s.heightMbs > 1024 {
+		return nil, unsupported("picture too large (%dx%d macroblocks)", s.widthMbs, s.heightMbs)
+	}
+	return s, nil
+}
+
+// check 报告解码器是否支持该序列
+func (s *sps) check() error {
+	switch {
+	case s.chromaFormatIdc != 1:
+		return unsupported("chroma_format_idc %d", s.chromaFormatIdc)
+	case s.bitDepthLuma != 8 || s.bitDepthChroma != 8:
+		return unsupported("bit depth %d", s.bitDepthLuma)
+	case s.transformBypass:
+		return unsupported("lossless transform bypass")
+	case s.mbAdaptiveFrameField:
+		return unsupported("MBAFF interlaced coding")
+	}
+	return nil
+}
+
+// crop 返回裁剪后的画面范围
+func (s *sps) crop() (x0, y0, x1, y1 int) {
+	unitY := 2
+	if !s.frameMbsOnly {
+		unitY = 4
+	}
+	x0, y0 = 2*s.cropLeft, unitY*s.cropTop
+	x1, y1 = s.widthMbs*16-2*s.cropRight, s.heightMbs*16-unitY*s.cropBottom
+	if x1 <= x0 || y1 <= y0 {
+		return 0, 0, s.widthMbs * 16, s.heightMbs * 16
+	}
+	return
+}
+
+// parsePPS 解析去掉NAL头的PPS,量化矩阵等字段依赖对应的SPS
+func parsePPS(rbsp []byte, spsByID map[uint32]*sps) (*pps, error) {
+	r := newBitReader(rbsp)
+	p := &pps{}
+	p.id = r.ue()
+	p.spsID = r.ue()
+	if p.id > 255 {
+		return nil, fmt.Errorf("h264: invalid pps id %d", p.id)
+	}
+	s := spsByID[p.spsID]
+	if s == nil {
+		return nil, fmt.Errorf("h264: pps %d refers to unknown sps %d", p.id, p.spsID)
+	}
+	p.cabac = r.flag()
+	p.bottomFieldPocPresent = r.flag()
+	p.numSliceGroups = r.ue() + 1
+	if p.numSliceGroups > 1 {
+		return nil, unsupported("slice groups (FMO)")
+	}
+	r.ue() // num_ref_idx_l0_default_active_minus1
+	r.ue() // num_ref_idx_l1_default_active_minus1
+	r.flag()
+	r.u(2) // weighted_pred_flag, weighted_bipred_idc
+	p.picInitQP = 26 + r.se()
+	r.se() // pic_init_qs_minus26
+	p.chromaQPOffset = r.se()
+	p.deblockingControl = r.flag()
+	p.constrainedIntraPred = r.flag()
+	p.redundantPicCntPresent = r.flag()
+	p.scaling4x4, p.scaling8x8 = s.scaling4x4, s.scaling8x8
+	if r.err == nil && r.moreRBSPData() {
+		p.transform8x8 = r.flag()
+		if r.flag() {
+			count := 6
+			if p.transform8x8 {
+				count += 2
+				if s.chromaFormatIdc == 3 {
+					count += 4
+				}
+			}
+			// 回退规则: SPS没有量化矩阵时用默认矩阵(A),否则用SPS的矩阵(B)
+			f4, f8 := defaultMatrices()
+			if s.scalingMatrixPresent {
+				f4, f8 = s.scaling4x4, s.scaling8x8
+			}
+			readScalingMatrix(r, count, &p.scaling4x4, &p.scaling8x8, f4, f8)
+		}
+		r.se() // second_chroma_qp_index_offset
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return p, nil
+}
+
+// parseAVCConfig 解析MP4中avcC box的内容,返回NAL长度字段的字节数以及其中的SPS和PPS
+func parseAVCConfig(data []byte) (lengthSize int, spsList, ppsList [][]byte, err error) {
+	if len(data) < 7 || data[0] != 1 {
+		return 0, nil, nil, fmt.Errorf("h264: invalid avcC")
+	}
+	lengthSize = int(data[4]&3) + 1
+	if lengthSize == 3 {
+		return 0, nil, nil, fmt.Errorf("h264: invalid NAL length size %d", lengthSize)
+	}
+	pos := 6
+	readList := func(count int) ([][]byte, error) {
+		var list [][]byte
+		for i := 0; i < count; i++ {
+			if pos+2 > len(data) {
+				return nil, fmt.Errorf("h264: truncated avcC")
+			}
+			n := int(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+			if pos+n > len(data) {
+				return nil, fmt.Errorf("h264: truncated avcC")
+			}
+			list = append(list, data[pos:pos+n])
+			pos += n
+		}
+		return list, nil
+	}
+	if spsList, err = readList(int(data[5] & 31)); err != nil {
+		return 0, nil, nil, err
+	}
+	pos++
+	if pos > len(data) {
+		return 0, nil, nil, fmt.Errorf("h264: truncated avcC")
+	}
+	if ppsList, err = readList(int(data[pos-1])); err != nil {
+		return 0, nil, nil, err
+	}
+	return lengthSize, spsList, ppsList, nil
+}
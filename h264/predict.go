@@ -0,0 +1,208 @@
+package h264
+
+// edges 是帧内预测用到的相邻像素,下标0是左上角p[-1,-1]
+type edges struct {
+	top       [17]int32 // top[1+x] = p[x,-1]
+	left      [17]int32 // left[1+y] = p[-1,y]
+	hasTop    bool
+	hasLeft   bool
+	hasCorner bool
+}
+
+// p 按标准中的坐标取相邻像素,x或y为-1
+func (e *edges) p(x, y int) int32 {
+	if y < 0 {
+		return e.top[x+1]
+	}
+	return e.left[y+1]
+}
+
+// predictDirectional 计算4x4或8x8块的帧内预测(Intra_4x4/Intra_8x8的9种模式),n为块宽
+func predictDirectional(e *edges, mode int8, n int, pred []int32) {
+	p := e.p
+	last := 2*n - 1 // 右上角最后一个像素的x坐标
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var v int32
+			switch mode {
+			case 0: // Vertical
+				v = p(x, -1)
+			case 1: // Horizontal
+				v = p(-1, y)
+			case 2: // DC
+				v = predictDC(e, n)
+			case 3: // Diagonal_Down_Left
+				if x == n-1 && y == n-1 {
+					v = (p(last-1, -1) + 3*p(last, -1) + 2) >> 2
+				} else {
+					v = (p(x+y, -1) + 2*p(x+y+1, -1) + p(x+y+2, -1) + 2) >> 2
+				}
+			case 4: // Diagonal_Down_Right
+				switch {
+				case x > y:
+					v = (p(x-y-2, -1) + 2*p(x-y-1, -1) + p(x-y, -1) + 2) >> 2
+				case x < y:
+					v = (p(-1, y-x-2) + 2*p(-1, y-x-1) + p(-1, y-x) + 2) >> 2
+				default:
+					v = (p(0, -1) + 2*p(-1, -1) + p(-1, 0) + 2) >> 2
+				}
+			case 5: // Vertical_Right
+				z := 2*x - y
+				switch {
+				case z >= 0 && z%2 == 0:
+					v = (p(x-(y>>1)-1, -1) + p(x-(y>>1), -1) + 1) >> 1
+				case z > 0:
+					v = (p(x-(y>>1)-2, -1) + 2*p(x-(y>>1)-1, -1) + p(x-(y>>1), -1) + 2) >> 2
+				case z == -1:
+					v = (p(-1, 0) + 2*p(-1, -1) + p(0, -1) + 2) >> 2
+				default:
+					v = (p(-1, y-2*x-1) + 2*p(-1, y-2*x-2) + p(-1, y-2*x-3) + 2) >> 2
+				}
+			case 6: // Horizontal_Down
+				z := 2*y - x
+				switch {
+				case z >= 0 && z%2 == 0:
+					v = (p(-1, y-(x>>1)-1) + p(-1, y-(x>>1)) + 1) >> 1
+				case z > 0:
+					v = (p(-1, y-(x>>1)-2) + 2*p(-1, y-(x>>1)-1) + p(-1, y-(x>>1)) + 2) >> 2
+				case z == -1:
+					v = (p(-1, 0) + 2*p(-1, -1) + p(0, -1) + 2) >> 2
+				default:
+					v = (p(x-2*y-1, -1) + 2*p(x-2*y-2, -1) + p(x-2*y-3, -1) + 2) >> 2
+				}
+			case 7: // Vertical_Left
+				if y%2 == 0 {
+					v = (p(x+(y>>1), -1) + p(x+(y>>1)+1, -1) + 1) >> 1
+				} else {
+					v = (p(x+(y>>1), -1) + 2*p(x+(y>>1)+1, -1) + p(x+(y>>1)+2, -1) + 2) >> 2
+				}
+			case 8: // Horizontal_Up
+				z := x + 2*y
+				limit := 2*n - 3
+				switch {
+				case z < limit && z%2 == 0:
+					v = (p(-1, y+(x>>1)) + p(-1, y+(x>>1)+1) + 1) >> 1
+				case z < limit:
+					v = (p(-1, y+(x>>1)) + 2*p(-1, y+(x>>1)+1) + p(-1, y+(x>>1)+2) + 2) >> 2
+				case z == limit:
+					v = (p(-1, n-2) + 3*p(-1, n-1) + 2) >> 2
+				default:
+					v = p(-1, n-1)
+				}
+			}
+			pred[y*n+x] = v
+		}
+	}
+}
+
+// predictDC 计算n×n块的DC预测值
+func predictDC(e *edges, n int) int32 {
+	var sum int32
+	shift := 0
+	for i := 0; i < n; i++ {
+		if e.hasTop {
+			sum += e.top[1+i]
+		}
+		if e.hasLeft {
+			sum += e.left[1+i]
+		}
+	}
+	switch {
+	case e.hasTop && e.hasLeft:
+		shift = log2(n) + 1
+	case e.hasTop || e.hasLeft:
+		shift = log2(n)
+	default:
+		return 128
+	}
+	return (sum + 1<<uint(shift-1)) >> uint(shift)
+}
+
+func log2(n int) int {
+	s := 0
+	for n > 1 {
+		n >>= 1
+		s++
+	}
+	return s
+}
+
+// filter8x8 对Intra_8x8的相邻像素做低通滤波
+func filter8x8(e *edges) {
+	src := *e
+	p := src.p
+	if e.hasTop {
+		if e.hasCorner {
+			e.top[1] = (p(-1, -1) + 2*p(0, -1) + p(1, -1) + 2) >> 2
+		} else {
+			e.top[1] = (3*p(0, -1) + p(1, -1) + 2) >> 2
+		}
+		for x := 1; x < 15; x++ {
+			e.top[1+x] = (p(x-1, -1) + 2*p(x, -1) + p(x+1, -1) + 2) >> 2
+		}
+		e.top[16] = (p(14, -1) + 3*p(15, -1) + 2) >> 2
+	}
+	if e.hasCorner {
+		var v int32
+		switch {
+		case e.hasTop && e.hasLeft:
+			v = (p(0, -1) + 2*p(-1, -1) + p(-1, 0) + 2) >> 2
+		case e.hasTop:
+			v = (3*p(-1, -1) + p(0, -1) + 2) >> 2
+		case e.hasLeft:
+			v = (3*p(-1, -1) + p(-1, 0) + 2) >> 2
+		default:
+			v = p(-1, -1)
+		}
+		e.top[0], e.left[0] = v, v
+	}
+	if e.hasLeft {
+		if e.hasCorner {
+			e.left[1] = (p(-1, -1) + 2*p(-1, 0) + p(-1, 1) + 2) >> 2
+		} else {
+			e.left[1] = (3*p(-1, 0) + p(-1, 1) + 2) >> 2
+		}
+		for y := 1; y < 7; y++ {
+			e.left[1+y] = (p(-1, y-1) + 2*p(-1, y) + p(-1, y+1) + 2) >> 2
+		}
+		e.left[8] = (p(-1, 6) + 3*p(-1, 7) + 2) >> 2
+	}
+}
+
+// predict16x16 计算Intra_16x16预测
+func predict16x16(e *edges, mode int, pred []int32) {
+	p := e.p
+	switch mode {
+	case 0:
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				pred[y*16+x] = p(x, -1)
+			}
+		}
+	case 1:
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				pred[y*16+x] = p(-1, y)
+			}
+		}
+	case 2:
+		dc := predictDC(e, 16)
+		for i := range pred[:256] {
+			pred[i] = dc
+		}
+	case 3:
+		var h, v int32
+		for i := 0; i < 8; i++ {
+			h += int32(i+1) * (p(8+i, -1) - p(6-i, -1))
+			v += int32(i+1) * (p(-1, 8+i) - p(-1, 6-i))
+		}
+		a := 16 * (p(-1, 15) + p(15, -1))
+		b := (5*h + 32) >> 6
+		c := (5*v + 32) >> 6
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				pred[y*16+x] = int32(clipPixel((a + b*int32(x-7) + c*int32(y-7) + 16) >> 5))
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package h264
+
+// reconstruct 按预测模式和残差重建宏块的亮度,色度不参与二维码识别,不做重建
+func (s *sliceDecoder) reconstruct(addr int, m *macroblock, mbType int) {
+	switch m.kind {
+	case mbI4x4:
+		for blk := 0; blk < 16; blk++ {
+			bx, by := blockPos[blk][0], blockPos[blk][1]
+			raster := by*4 + bx
+			e := s.edges(addr, bx*4, by*4, 4, blk)
+			var pred [16]int32
+			predictDirectional(&e, m.predModes[raster], 4, pred[:])
+			var res [16]int32
+			if m.coeffs[raster] > 0 {
+				s.scale.dequant4x4(&s.luma[raster], s.qp, false, &res)
+				idct4x4(&res)
+			}
+			s.store(addr, bx*4, by*4, 4, pred[:], res[:])
+		}
+	case mbI8x8:
+		for b8 := 0; b8 < 4; b8++ {
+			x, y := b8%2*8, b8/2*8
+			e := s.edges(addr, x, y, 8, b8)
+			filter8x8(&e)
+			var pred [64]int32
+			predictDirectional(&e, m.predModes[(y/4)*4+x/4], 8, pred[:])
+			var res [64]int32
+			if m.cbpLuma>>uint(b8)&1 != 0 {
+				s.scale.dequant8x8(&s.luma8[b8], s.qp, &res)
+				idct8x8(&res)
+			}
+			s.store(addr, x, y, 8, pred[:], res[:])
+		}
+	case mbI16x16:
+		e := s.edges(addr, 0, 0, 16, 0)
+		var pred [256]int32
+		predict16x16(&e, (mbType-1)%4, pred[:])
+		var dc [16]int32
+		if m.lumaDC {
+			dc = s.scale.lumaDC(&s.dc, s.qp)
+		}
+		for raster := 0; raster < 16; raster++ {
+			bx, by := raster%4, raster/4
+			var res [16]int32
+			s.scale.dequant4x4(&s.luma[raster], s.qp, true, &res)
+			res[0] = dc[raster]
+			idct4x4(&res)
+			var blockPred [16]int32
+			for y := 0; y < 4; y++ {
+				copy(blockPred[y*4:y*4+4], pred[(by*4+y)*16+bx*4:])
+			}
+			s.store(addr, bx*4, by*4, 4, blockPred[:], res[:])
+		}
+	}
+}
+
+// store 把预测值加残差写入图像
+func (s *sliceDecoder) store(addr, x0, y0, n int, pred, res []int32) {
+	mx, my := s.mbOrigin(addr)
+	for y := 0; y < n; y++ {
+		row := s.pic.luma[(my+y0+y)*s.pic.stride+mx+x0:]
+		for x := 0; x < n; x++ {
+			row[x] = clipPixel(pred[y*n+x] + res[y*n+x])
+		}
+	}
+}
+
+// available 报告宏块内坐标(x, y)(可以在宏块外)的像素是否已重建并可用于帧内预测
+// cur是当前块的解码顺序,n是块大小
+func (s *sliceDecoder) available(addr, x, y, n, cur int) bool {
+	if x >= 0 && x < 16 && y >= 0 && y < 16 {
+		switch n {
+		case 4:
+			return blockIndex(x, y) < cur
+		case 8:
+			return (y/8)*2+x/8 < cur
+		}
+		return false
+	}
+	dx, dy := 0, 0
+	switch {
+	case x < 0:
+		dx = -1
+	case x >= 16:
+		dx = 1
+	}
+	switch {
+	case y < 0:
+		dy = -1
+	case y >= 16:
+		return false
+	}
+	if dx == 1 && dy == 0 {
+		return false
+	}
+	return s.neighbour(addr, dx, dy) != nil
+}
+
+// edges 收集n×n块(宏块内坐标x0, y0)的相邻像素,右上方不可用时用上方最后一个像素代替
+func (s *sliceDecoder) edges(addr, x0, y0, n, cur int) edges {
+	var e edges
+	mx, my := s.mbOrigin(addr)
+	pix := func(x, y int) int32 {
+		return int32(s.pic.luma[(my+y0+y)*s.pic.stride+mx+x0+x])
+	}
+	e.hasTop = s.available(addr, x0, y0-1, n, cur)
+	e.hasLeft = s.available(addr, x0-1, y0, n, cur)
+	e.hasCorner = s.available(addr, x0-1, y0-1, n, cur)
+	if e.hasTop {
+		for x := 0; x < n; x++ {
+			e.top[1+x] = pix(x, -1)
+		}
+		if n < 16 {
+			if s.available(addr, x0+n, y0-1, n, cur) {
+				for x := n; x < 2*n; x++ {
+					e.top[1+x] = pix(x, -1)
+				}
+			} else {
+				for x := n; x < 2*n; x++ {
+					e.top[1+x] = e.top[n]
+				}
+			}
+		}
+	}
+	if e.hasLeft {
+		for y := 0; y < n; y++ {
+			e.left[1+y] = pix(-1, y)
+		}
+	}
+	if e.hasCorner {
+		e.top[0] = pix(-1, -1)
+		e.left[0] = e.top[0]
+	}
+	return e
+}
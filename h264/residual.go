@@ -0,0 +1,426 @@
+package h264
+
+import "fmt"
+
+// 残差块类别(ctxBlockCat)
+const (
+	catLumaDC   = 0 // Intra16x16DCLevel
+	catLumaAC   = 1 // Intra16x16ACLevel
+	catLuma4x4  = 2 // LumaLevel4x4
+	catChromaDC = 3
+	catChromaAC = 4
+	catLuma8x8  = 5
+)
+
+var (
+	cbfCatOffset = [5]int{0, 4, 8, 12, 16}
+	sigCatOffset = [5]int{0, 15, 29, 44, 47}
+	absCatOffset = [5]int{0, 10, 20, 30, 39}
+)
+
+// sig8x8Inc/last8x8Inc 是帧编码8x8块significant_coeff_flag和last_significant_coeff_flag的ctxIdxInc
+var sig8x8Inc = [63]uint8{
+	0, 1, 2, 3, 4, 5, 5, 4, 4, 3, 3, 4, 4, 4, 5, 5,
+	4, 4, 4, 4, 3, 3, 6, 7, 7, 7, 8, 9, 10, 9, 8, 7,
+	7, 6, 11, 12, 13, 11, 6, 7, 8, 9, 14, 10, 9, 8, 6, 11,
+	12, 13, 11, 6, 9, 14, 10, 9, 11, 12, 13, 11, 14, 10, 12,
+}
+
+var last8x8Inc = [63]uint8{
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	3, 3, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4,
+	5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8,
+}
+
+// residual 读取宏块的全部残差,亮度系数留给重建使用,色度只记录非零系数个数
+func (s *sliceDecoder) residual(addr int, m *macroblock) error {
+	s.luma = [16][16]int32{}
+	s.luma8 = [4][64]int32{}
+	s.dc = [16]int32{}
+
+	if m.kind == mbI16x16 {
+		n, err := s.block(s.dc[:], catLumaDC, addr, 0, 0)
+		if err != nil {
+			return err
+		}
+		m.lumaDC = n > 0
+	}
+	for b8 := 0; b8 < 4; b8++ {
+		if m.cbpLuma>>uint(b8)&1 == 0 {
+			continue
+		}
+		if m.transform8x8 && s.cabac != nil {
+			n, err := s.block(s.luma8[b8][:], catLuma8x8, addr, 0, 0)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 4; i++ {
+				bx, by := blockPos[b8*4+i][0], blockPos[b8*4+i][1]
+				m.coeffs[by*4+bx] = uint8(n)
+			}
+			continue
+		}
+		for i := 0; i < 4; i++ {
+			bx, by := blockPos[b8*4+i][0], blockPos[b8*4+i][1]
+			blk := by*4 + bx
+			var n int
+			var err error
+			switch {
+			case m.kind == mbI16x16:
+				n, err = s.block(s.luma[blk][1:], catLumaAC, addr, blk, 0)
+			case m.transform8x8:
+				// CAVLC把8x8块的系数交错分成4个4x4块传输
+				var levels [16]int32
+				n, err = s.block(levels[:], catLuma4x4, addr, blk, 0)
+				for k, v := range levels {
+					s.luma8[b8][4*k+i] = v
+				}
+			default:
+				n, err = s.block(s.luma[blk][:], catLuma4x4, addr, blk, 0)
+			}
+			if err != nil {
+				return err
+			}
+			m.coeffs[blk] = uint8(n)
+		}
+	}
+
+	if m.cbpChroma != 0 {
+		for c := 0; c < 2; c++ {
+			n, err := s.block(s.chroma[:4], catChromaDC, addr, 0, c)
+			if err != nil {
+				return err
+			}
+			m.chromaDC[c] = n > 0
+		}
+	}
+	if m.cbpChroma == 2 {
+		for c := 0; c < 2; c++ {
+			for blk := 0; blk < 4; blk++ {
+				n, err := s.block(s.chroma[:15], catChromaAC, addr, blk, c)
+				if err != nil {
+					return err
+				}
+				m.chromaCoeffs[c][blk] = uint8(n)
+			}
+		}
+	}
+	return nil
+}
+
+// block 读取一个残差块,blk是亮度4x4块(光栅顺序)或色度4x4块的下标,comp是色度分量
+func (s *sliceDecoder) block(levels []int32, cat int, addr, blk, comp int) (int, error) {
+	for i := range levels {
+		levels[i] = 0
+	}
+	if s.cabac != nil {
+		inc := 0
+		if cat != catLuma8x8 {
+			a, b := s.codedBlockFlags(cat, addr, blk, comp)
+			inc = a + 2*b
+		}
+		return s.cabacBlock(levels, cat, inc), nil
+	}
+	nC := -1
+	if cat != catChromaDC {
+		nC = s.totalCoeffPrediction(cat, addr, blk, comp)
+	}
+	return s.cavlcBlock(levels, nC)
+}
+
+// totalCoeffPrediction 由左边和上边块的非零系数个数计算CAVLC的nC
+func (s *sliceDecoder) totalCoeffPrediction(cat int, addr, blk, comp int) int {
+	var left, above *macroblock
+	var na, nb int
+	if cat == catChromaAC {
+		var li, ai int
+		left, li = s.chromaLeft(addr, blk)
+		above, ai = s.chromaAbove(addr, blk)
+		if left != nil {
+			na = int(left.chromaCoeffs[comp][li])
+		}
+		if above != nil {
+			nb = int(above.chromaCoeffs[comp][ai])
+		}
+	} else {
+		var li, ai int
+		left, li = s.lumaLeft(addr, blk%4, blk/4)
+		above, ai = s.lumaAbove(addr, blk%4, blk/4)
+		if left != nil {
+			na = int(left.coeffs[li])
+		}
+		if above != nil {
+			nb = int(above.coeffs[ai])
+		}
+	}
+	switch {
+	case left != nil && above != nil:
+		return (na + nb + 1) >> 1
+	case left != nil:
+		return na
+	case above != nil:
+		return nb
+	}
+	return 0
+}
+
+// codedBlockFlags 计算coded_block_flag上下文用到的左边和上边块的条件值
+func (s *sliceDecoder) codedBlockFlags(cat int, addr, blk, comp int) (int, int) {
+	cond := func(n *macroblock, i int) int {
+		if n == nil {
+			// 帧内宏块的相邻宏块不可用时为1
+			return 1
+		}
+		var coded bool
+		switch cat {
+		case catLumaDC:
+			coded = n.kind == mbPCM || (n.kind == mbI16x16 && n.lumaDC)
+		case catLumaAC, catLuma4x4:
+			coded = n.coeffs[i] != 0
+		case catChromaDC:
+			coded = n.chromaDC[comp]
+		case catChromaAC:
+			coded = n.chromaCoeffs[comp][i] != 0
+		}
+		if coded {
+			return 1
+		}
+		return 0
+	}
+	switch cat {
+	case catLumaDC:
+		return cond(s.neighbour(addr, -1, 0), 0), cond(s.neighbour(addr, 0, -1), 0)
+	case catChromaDC:
+		return cond(s.neighbour(addr, -1, 0), 0), cond(s.neighbour(addr, 0, -1), 0)
+	case catChromaAC:
+		left, li := s.chromaLeft(addr, blk)
+		above, ai := s.chromaAbove(addr, blk)
+		return cond(left, li), cond(above, ai)
+	}
+	left, li := s.lumaLeft(addr, blk%4, blk/4)
+	above, ai := s.lumaAbove(addr, blk%4, blk/4)
+	return cond(left, li), cond(above, ai)
+}
+
+// cabacBlock 用CABAC读取残差块(9.3.2.x中的residual_block_cabac)
+func (s *sliceDecoder) cabacBlock(levels []int32, cat, cbfInc int) int {
+	c := s.cabac
+	sigBase, lastBase, absBase := 402, 417, 426
+	if cat != catLuma8x8 {
+		if c.decision(85+cbfCatOffset[cat]+cbfInc) == 0 {
+			return 0
+		}
+		sigBase = 105 + sigCatOffset[cat]
+		lastBase = 166 + sigCatOffset[cat]
+		absBase = 227 + absCatOffset[cat]
+	}
+
+	maxNum := len(levels)
+	var significant [64]int
+	count := 0
+	i := 0
+	for ; i < maxNum-1; i++ {
+		sigInc, lastInc := i, i
+		switch cat {
+		case catChromaDC:
+			if i > 2 {
+				sigInc, lastInc = 2, 2
+			}
+		case catLuma8x8:
+			sigInc, lastInc = int(sig8x8Inc[i]), int(last8x8Inc[i])
+		}
+		if c.decision(sigBase+sigInc) == 1 {
+			significant[count] = i
+			count++
+			if c.decision(lastBase+lastInc) == 1 {
+				break
+			}
+		}
+	}
+	if i == maxNum-1 {
+		significant[count] = i
+		count++
+	}
+
+	var eq1, gt1 int
+	gt1Limit := 4
+	if cat == catChromaDC {
+		gt1Limit = 3
+	}
+	for k := count - 1; k >= 0; k-- {
+		inc := 0
+		if gt1 == 0 {
+			inc = minInt(4, 1+eq1)
+		}
+		var v int32
+		if c.decision(absBase+inc) == 1 {
+			inc = 5 + minInt(gt1Limit, gt1)
+			v = 1
+			for v < 14 && c.decision(absBase+inc) == 1 {
+				v++
+			}
+			if v == 14 {
+				v += c.expGolombBypass()
+			}
+		}
+		level := v + 1
+		if level == 1 {
+			eq1++
+		} else {
+			gt1++
+		}
+		if c.bypass() == 1 {
+			level = -level
+		}
+		levels[significant[k]] = level
+	}
+	return count
+}
+
+// expGolombBypass 读取0阶指数哥伦布码的旁路后缀
+func (c *cabac) expGolombBypass() int32 {
+	var v int32
+	k := uint(0)
+	for c.bypass() == 1 {
+		v += 1 << k
+		k++
+		if k >= 24 {
+			c.r.err = fmt.Errorf("h264: invalid coeff_abs_level_minus1 suffix")
+			return 0
+		}
+	}
+	for k > 0 {
+		k--
+		v += int32(c.bypass()) << k
+	}
+	return v
+}
+
+// cavlcBlock 用CAVLC读取残差块,nC为-1表示色度DC
+func (s *sliceDecoder) cavlcBlock(levels []int32, nC int) (int, error) {
+	r := s.r
+	var token int
+	var ok bool
+	switch {
+	case nC == -1:
+		token, ok = chromaDCCoeffTokenVLC.read(r, 8)
+	case nC < 2:
+		token, ok = coeffTokenVLC[0].read(r, 16)
+	case nC < 4:
+		token, ok = coeffTokenVLC[1].read(r, 14)
+	case nC < 8:
+		token, ok = coeffTokenVLC[2].read(r, 10)
+	default:
+		token, ok = coeffTokenVLC[3].read(r, 6)
+	}
+	if !ok {
+		return 0, fmt.Errorf("invalid coeff_token")
+	}
+	total, ones := token/4, token%4
+	maxNum := len(levels)
+	if total == 0 {
+		return 0, nil
+	}
+	if total > maxNum {
+		return 0, fmt.Errorf("too many coefficients (%d > %d)", total, maxNum)
+	}
+
+	var level [16]int32
+	suffixLength := 0
+	if total > 10 && ones < 3 {
+		suffixLength = 1
+	}
+	for i := 0; i < total; i++ {
+		if i < ones {
+			level[i] = 1 - 2*int32(r.bit())
+			continue
+		}
+		prefix := 0
+		for r.bit() == 0 {
+			prefix++
+			if r.err != nil || prefix > 32 {
+				return 0, fmt.Errorf("invalid level_prefix")
+			}
+		}
+		code := minInt(15, prefix) << uint(suffixLength)
+		if suffixLength > 0 || prefix >= 14 {
+			size := suffixLength
+			if prefix == 14 && suffixLength == 0 {
+				size = 4
+			}
+			if prefix >= 15 {
+				size = prefix - 3
+			}
+			code += int(r.u(size))
+		}
+		if prefix >= 15 && suffixLength == 0 {
+			code += 15
+		}
+		if prefix >= 16 {
+			code += 1<<uint(prefix-3) - 4096
+		}
+		if i == ones && ones < 3 {
+			code += 2
+		}
+		if code%2 == 0 {
+			level[i] = int32(code+2) >> 1
+		} else {
+			level[i] = int32(-code-1) >> 1
+		}
+		if suffixLength == 0 {
+			suffixLength = 1
+		}
+		if abs32(level[i]) > 3<<uint(suffixLength-1) && suffixLength < 6 {
+			suffixLength++
+		}
+	}
+
+	zeros := 0
+	if total < maxNum {
+		var table vlc
+		if nC == -1 {
+			table = chromaDCTotalZerosVLC[total-1]
+		} else {
+			table = totalZerosVLC[total-1]
+		}
+		if zeros, ok = table.read(r, 9); !ok {
+			return 0, fmt.Errorf("invalid total_zeros")
+		}
+	}
+	if total+zeros > maxNum {
+		return 0, fmt.Errorf("invalid total_zeros %d", zeros)
+	}
+
+	var run [16]int
+	left := zeros
+	for i := 0; i < total-1 && left > 0; i++ {
+		rb, ok := runBeforeVLC[minInt(left, 7)-1].read(r, 11)
+		if !ok || rb > left {
+			return 0, fmt.Errorf("invalid run_before")
+		}
+		run[i] = rb
+		left -= rb
+	}
+	run[total-1] += left
+	pos := -1
+	for i := total - 1; i >= 0; i-- {
+		pos += run[i] + 1
+		levels[pos] = level[i]
+	}
+	return total, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
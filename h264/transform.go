@@ -0,0 +1,198 @@
+package h264
+
+// zigzag4x4/zigzag8x8 把帧编码的扫描顺序映射为光栅顺序下标
+var zigzag4x4 = [16]int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+var zigzag8x8 = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+var normAdjust4x4 = [6][3]int32{
+	{10, 16, 13}, {11, 18, 14}, {13, 20, 16}, {14, 23, 18}, {16, 25, 20}, {18, 29, 23},
+}
+
+var normAdjust8x8 = [6][6]int32{
+	{20, 18, 32, 19, 25, 24},
+	{22, 19, 35, 21, 28, 26},
+	{26, 23, 42, 24, 33, 31},
+	{28, 25, 45, 26, 35, 33},
+	{32, 28, 51, 30, 40, 38},
+	{36, 32, 58, 34, 46, 43},
+}
+
+// levelScale 是帧内亮度的反量化系数,按qP%6和光栅顺序下标
+type levelScale struct {
+	s4x4 [6][16]int32
+	s8x8 [6][64]int32
+}
+
+// newLevelScale 由帧内亮度的量化矩阵(扫描顺序)计算反量化系数
+func newLevelScale(weight4x4 [16]int32, weight8x8 [64]int32) *levelScale {
+	ls := &levelScale{}
+	for m := 0; m < 6; m++ {
+		for k := 0; k < 16; k++ {
+			pos := zigzag4x4[k]
+			i, j := pos/4, pos%4
+			v := normAdjust4x4[m][2]
+			switch {
+			case i%2 == 0 && j%2 == 0:
+				v = normAdjust4x4[m][0]
+			case i%2 == 1 && j%2 == 1:
+				v = normAdjust4x4[m][1]
+			}
+			ls.s4x4[m][pos] = weight4x4[k] * v
+		}
+		for k := 0; k < 64; k++ {
+			pos := zigzag8x8[k]
+			i, j := pos/8, pos%8
+			v := normAdjust8x8[m][5]
+			switch {
+			case i%4 == 0 && j%4 == 0:
+				v = normAdjust8x8[m][0]
+			case i%2 == 1 && j%2 == 1:
+				v = normAdjust8x8[m][1]
+			case i%4 == 2 && j%4 == 2:
+				v = normAdjust8x8[m][2]
+			case (i%4 == 0 && j%2 == 1) || (i%2 == 1 && j%4 == 0):
+				v = normAdjust8x8[m][3]
+			case (i%4 == 0 && j%4 == 2) || (i%4 == 2 && j%4 == 0):
+				v = normAdjust8x8[m][4]
+			}
+			ls.s8x8[m][pos] = weight8x8[k] * v
+		}
+	}
+	return ls
+}
+
+// dequant4x4 把扫描顺序的系数反量化为光栅顺序,skipDC时第0个系数由调用方填入
+func (ls *levelScale) dequant4x4(levels *[16]int32, qp int32, skipDC bool, out *[16]int32) {
+	m, shift := qp%6, qp/6
+	for k, c := range levels {
+		if c == 0 || (skipDC && k == 0) {
+			continue
+		}
+		pos := zigzag4x4[k]
+		if shift >= 4 {
+			out[pos] = (c * ls.s4x4[m][pos]) << uint(shift-4)
+		} else {
+			out[pos] = (c*ls.s4x4[m][pos] + 1<<uint(3-shift)) >> uint(4-shift)
+		}
+	}
+}
+
+func (ls *levelScale) dequant8x8(levels *[64]int32, qp int32, out *[64]int32) {
+	m, shift := qp%6, qp/6
+	for k, c := range levels {
+		if c == 0 {
+			continue
+		}
+		pos := zigzag8x8[k]
+		if shift >= 6 {
+			out[pos] = (c * ls.s8x8[m][pos]) << uint(shift-6)
+		} else {
+			out[pos] = (c*ls.s8x8[m][pos] + 1<<uint(5-shift)) >> uint(6-shift)
+		}
+	}
+}
+
+// lumaDC 对Intra16x16的DC系数做反Hadamard变换和反量化,结果按4x4块的光栅位置排列
+func (ls *levelScale) lumaDC(levels *[16]int32, qp int32) (dc [16]int32) {
+	var c [16]int32
+	for k, v := range levels {
+		c[zigzag4x4[k]] = v
+	}
+	var f [16]int32
+	for i := 0; i < 4; i++ {
+		a, b, x, y := c[i*4], c[i*4+1], c[i*4+2], c[i*4+3]
+		f[i*4], f[i*4+1], f[i*4+2], f[i*4+3] = a+b+x+y, a+b-x-y, a-b-x+y, a-b+x-y
+	}
+	for j := 0; j < 4; j++ {
+		a, b, x, y := f[j], f[4+j], f[8+j], f[12+j]
+		f[j], f[4+j], f[8+j], f[12+j] = a+b+x+y, a+b-x-y, a-b-x+y, a-b+x-y
+	}
+	scale := ls.s4x4[qp%6][0]
+	shift := qp / 6
+	for i, v := range f {
+		if shift >= 6 {
+			dc[i] = (v * scale) << uint(shift-6)
+		} else {
+			dc[i] = (v*scale + 1<<uint(5-shift)) >> uint(6-shift)
+		}
+	}
+	return dc
+}
+
+// idct4x4 对光栅顺序的4x4系数做反变换,结果为残差
+func idct4x4(d *[16]int32) {
+	for i := 0; i < 4; i++ {
+		r := d[i*4 : i*4+4]
+		e0, e1 := r[0]+r[2], r[0]-r[2]
+		e2, e3 := r[1]>>1-r[3], r[1]+r[3]>>1
+		r[0], r[1], r[2], r[3] = e0+e3, e1+e2, e1-e2, e0-e3
+	}
+	for j := 0; j < 4; j++ {
+		c0, c1, c2, c3 := d[j], d[4+j], d[8+j], d[12+j]
+		e0, e1 := c0+c2, c0-c2
+		e2, e3 := c1>>1-c3, c1+c3>>1
+		d[j], d[4+j], d[8+j], d[12+j] = (e0+e3+32)>>6, (e1+e2+32)>>6, (e1-e2+32)>>6, (e0-e3+32)>>6
+	}
+}
+
+// idct8x8 对光栅顺序的8x8系数做反变换,结果为残差
+func idct8x8(d *[64]int32) {
+	var v [8]int32
+	for i := 0; i < 8; i++ {
+		for k := 0; k < 8; k++ {
+			v[k] = d[i*8+k]
+		}
+		idct8(&v)
+		for k := 0; k < 8; k++ {
+			d[i*8+k] = v[k]
+		}
+	}
+	for j := 0; j < 8; j++ {
+		for k := 0; k < 8; k++ {
+			v[k] = d[k*8+j]
+		}
+		idct8(&v)
+		for k := 0; k < 8; k++ {
+			d[k*8+j] = (v[k] + 32) >> 6
+		}
+	}
+}
+
+func idct8(d *[8]int32) {
+	e0 := d[0] + d[4]
+	e1 := -d[3] + d[5] - d[7] - d[7]>>1
+	e2 := d[0] - d[4]
+	e3 := d[1] + d[7] - d[3] - d[3]>>1
+	e4 := d[2]>>1 - d[6]
+	e5 := -d[1] + d[7] + d[5] + d[5]>>1
+	e6 := d[2] + d[6]>>1
+	e7 := d[3] + d[5] + d[1] + d[1]>>1
+
+	f0 := e0 + e6
+	f1 := e1 + e7>>2
+	f2 := e2 + e4
+	f3 := e3 + e5>>2
+	f4 := e2 - e4
+	f5 := e3>>2 - e5
+	f6 := e0 - e6
+	f7 := e7 - e1>>2
+
+	d[0], d[1], d[2], d[3] = f0+f7, f2+f5, f4+f3, f6+f1
+	d[4], d[5], d[6], d[7] = f6-f1, f4-f3, f2-f5, f0-f7
+}
+
+func clipPixel(v int32) byte {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
@@ -0,0 +1,196 @@
+package corpus
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// BitWriter 按位写入H.264的RBSP
+type BitWriter struct {
+	buf []byte
+	n   int // 已写入的位数
+}
+
+// Bit 写入一位
+func (w *BitWriter) Bit(b uint32) {
+	if w.n%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if b&1 == 1 {
+		w.buf[len(w.buf)-1] |= 0x80 >> uint(w.n%8)
+	}
+	w.n++
+}
+
+// U 写入n位无符号数
+func (w *BitWriter) U(n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		w.Bit(v >> uint(i))
+	}
+}
+
+// UE 写入无符号指数哥伦布码
+func (w *BitWriter) UE(v uint32) {
+	size := bits.Len32(v + 1)
+	w.U(size-1, 0)
+	w.U(size, v+1)
+}
+
+// SE 写入有符号指数哥伦布码
+func (w *BitWriter) SE(v int32) {
+	if v > 0 {
+		w.UE(uint32(2*v - 1))
+	} else {
+		w.UE(uint32(-2 * v))
+	}
+}
+
+// Align 用0补齐到字节边界
+func (w *BitWriter) Align() {
+	for w.n%8 != 0 {
+		w.Bit(0)
+	}
+}
+
+// Trailing 写入rbsp_trailing_bits并返回全部内容
+func (w *BitWriter) Trailing() []byte {
+	w.Bit(1)
+	w.Align()
+	return w.buf
+}
+
+// NAL 给RBSP加上NAL头并插入防竞争字节
+func NAL(header byte, rbsp []byte) []byte {
+	out := []byte{header}
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// AVCSample 把NAL单元按4字节长度前缀拼成MP4样本
+func AVCSample(nals ...[]byte) []byte {
+	var out []byte
+	for _, nal := range nals {
+		out = append(out, u32(uint32(len(nal)))...)
+		out = append(out, nal...)
+	}
+	return out
+}
+
+// AVCConfig 生成avcC box的内容,NAL长度字段为4字节
+func AVCConfig(sps, pps []byte) []byte {
+	return concat([]byte{1, sps[1], sps[2], sps[3], 0xFF, 0xE1}, u16(uint16(len(sps))), sps,
+		[]byte{1}, u16(uint16(len(pps))), pps)
+}
+
+// H264SPS 生成width×height(宽高为偶数)的Baseline档次SPS,超出宏块边界的部分用裁剪去掉
+func H264SPS(width, height int) []byte {
+	widthMbs, heightMbs := (width+15)/16, (height+15)/16
+	var w BitWriter
+	w.U(8, 66) // profile_idc
+	w.U(8, 0)  // constraint_set flags
+	w.U(8, 30) // level_idc
+	w.UE(0)    // seq_parameter_set_id
+	w.UE(0)    // log2_max_frame_num_minus4
+	w.UE(2)    // pic_order_cnt_type
+	w.UE(0)    // max_num_ref_frames
+	w.Bit(0)   // gaps_in_frame_num_value_allowed_flag
+	w.UE(uint32(widthMbs - 1))
+	w.UE(uint32(heightMbs - 1))
+	w.Bit(1) // frame_mbs_only_flag
+	w.Bit(1) // direct_8x8_inference_flag
+	right, bottom := (widthMbs*16-width)/2, (heightMbs*16-height)/2
+	if right > 0 || bottom > 0 {
+		w.Bit(1)
+		w.UE(0)
+		w.UE(uint32(right))
+		w.UE(0)
+		w.UE(uint32(bottom))
+	} else {
+		w.Bit(0)
+	}
+	w.Bit(0) // vui_parameters_present_flag
+	return NAL(0x67, w.Trailing())
+}
+
+// H264PPS 生成使用CAVLC、初始QP为26的PPS
+func H264PPS() []byte {
+	var w BitWriter
+	w.UE(0)   // pic_parameter_set_id
+	w.UE(0)   // seq_parameter_set_id
+	w.Bit(0)  // entropy_coding_mode_flag
+	w.Bit(0)  // bottom_field_pic_order_in_frame_present_flag
+	w.UE(0)   // num_slice_groups_minus1
+	w.UE(0)   // num_ref_idx_l0_default_active_minus1
+	w.UE(0)   // num_ref_idx_l1_default_active_minus1
+	w.Bit(0)  // weighted_pred_flag
+	w.U(2, 0) // weighted_bipred_idc
+	w.SE(0)   // pic_init_qp_minus26
+	w.SE(0)   // pic_init_qs_minus26
+	w.SE(0)   // chroma_qp_index_offset
+	w.Bit(1)  // deblocking_filter_control_present_flag
+	w.Bit(0)  // constrained_intra_pred_flag
+	w.Bit(0)  // redundant_pic_cnt_present_flag
+	return NAL(0x68, w.Trailing())
+}
+
+// H264SliceHeader 写入H264SPS/H264PPS对应的IDR I条带头,关闭去块滤波
+func H264SliceHeader(w *BitWriter, firstMB int, qpDelta int32) {
+	w.UE(uint32(firstMB))
+	w.UE(7)   // slice_type,全部为I条带
+	w.UE(0)   // pic_parameter_set_id
+	w.U(4, 0) // frame_num
+	w.UE(0)   // idr_pic_id
+	w.Bit(0)  // no_output_of_prior_pics_flag
+	w.Bit(0)  // long_term_reference_flag
+	w.SE(qpDelta)
+	w.UE(1) // disable_deblocking_filter_idc
+}
+
+// H264 把图片编码为只有一个IDR帧的H.264码流,全部宏块为I_PCM,返回avcC内容和样本
+func H264(img image.Image) (config, sample []byte) {
+	b := img.Bounds()
+	width, height := (b.Dx()+1)&^1, (b.Dy()+1)&^1
+	widthMbs, heightMbs := (width+15)/16, (height+15)/16
+	sps, pps := H264SPS(width, height), H264PPS()
+
+	var w BitWriter
+	H264SliceHeader(&w, 0, 0)
+	for mb := 0; mb < widthMbs*heightMbs; mb++ {
+		w.UE(25) // mb_type I_PCM
+		w.Align()
+		x0, y0 := mb%widthMbs*16, mb/widthMbs*16
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				// 超出图片的部分复制边缘像素
+				px := minInt(b.Min.X+x0+x, b.Max.X-1)
+				py := minInt(b.Min.Y+y0+y, b.Max.Y-1)
+				w.U(8, uint32(color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y))
+			}
+		}
+		for i := 0; i < 2*8*8; i++ {
+			w.U(8, 128)
+		}
+	}
+	slice := NAL(0x65, w.Trailing())
+	return AVCConfig(sps, pps), AVCSample(slice)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
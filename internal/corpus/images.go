@@ -0,0 +1,253 @@
+// Package corpus 生成检测器回归测试使用的合成图片和视频,保证每次生成的内容完全相同
+package corpus
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ImageCase 是一张带有标注的合成图片
+type ImageCase struct {
+	Name string
+	// QR 表示图片中含有二维码,即期望的检测结果
+	QR bool
+	// Ext 是写入文件时使用的格式,.png 或 .jpg
+	Ext   string
+	Image image.Image
+}
+
+// Write 把图片写入dir,返回文件路径
+func (c ImageCase) Write(dir string) (string, error) {
+	path := filepath.Join(dir, c.Name+c.Ext)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if c.Ext == ".jpg" {
+		// 低质量压缩,模拟群聊中被多次转发的图片
+		err = jpeg.Encode(file, c.Image, &jpeg.Options{Quality: 40})
+	} else {
+		err = png.Encode(file, c.Image)
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// AdText 是合成图片中二维码的内容
+const AdText = "https://example.com/join?group=12345678"
+
+// Images 返回全部图片用例,包括各种尺度和位置的二维码以及不含二维码的纹理图片
+func Images() []ImageCase {
+	poster := Texture(1200, 400, 1)
+	Paste(poster, QR(AdText, 132, color.Black, color.White), 1040, 240)
+
+	lowContrast := Tiles(800, 600, 2)
+	Paste(lowContrast, QR(AdText, 200, color.Gray{105}, color.Gray{150}), 300, 200)
+
+	small := Texture(800, 600, 3)
+	Paste(small, QR(AdText, 100, color.Black, color.White), 60, 460)
+
+	// 大尺寸照片中的小二维码,整图检测找不到,需要分块
+	large := Texture(3000, 1500, 11)
+	Paste(large, QR(AdText, 70, color.Black, color.White), 2900, 1400)
+
+	return []ImageCase{
+		{Name: "qr_center", QR: true, Ext: ".png", Image: onWhite(800, 600, QR(AdText, 300, color.Black, color.White), 250, 150)},
+		{Name: "qr_poster_corner", QR: true, Ext: ".png", Image: poster},
+		{Name: "qr_poster_corner_jpeg", QR: true, Ext: ".jpg", Image: poster},
+		{Name: "qr_tall_screenshot", QR: true, Ext: ".png", Image: screenshot()},
+		{Name: "qr_rotated", QR: true, Ext: ".png", Image: imaging.Rotate(onWhite(600, 600, QR(AdText, 260, color.Black, color.White), 170, 170), 20, color.White)},
+		{Name: "qr_low_contrast", QR: true, Ext: ".png", Image: lowContrast},
+		{Name: "qr_small", QR: true, Ext: ".png", Image: small},
+		{Name: "qr_large_photo", QR: true, Ext: ".jpg", Image: large},
+		{Name: "qr_inverted", QR: true, Ext: ".png", Image: onWhite(600, 600, QR(AdText, 260, color.White, color.Black), 170, 170)},
+		{Name: "photo_texture", QR: false, Ext: ".jpg", Image: Texture(800, 600, 4)},
+		{Name: "tiles", QR: false, Ext: ".png", Image: Tiles(800, 600, 5)},
+		{Name: "gradient", QR: false, Ext: ".png", Image: gradient(800, 600)},
+		{Name: "stripes", QR: false, Ext: ".png", Image: stripes(800, 400, 6)},
+		{Name: "text_lines", QR: false, Ext: ".png", Image: textLines(600, 800, 7)},
+		{Name: "finder_decoy", QR: false, Ext: ".png", Image: onWhite(600, 600, finderDecoy(250, 8), 175, 175)},
+	}
+}
+
+// QR 生成size×size的二维码图片,四周带有静区
+func QR(text string, size int, dark, light color.Color) image.Image {
+	matrix, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, size, size, nil)
+	if err != nil {
+		panic(fmt.Sprintf("corpus: failed to encode QR code: %v", err))
+	}
+	img := image.NewRGBA(image.Rect(0, 0, matrix.GetWidth(), matrix.GetHeight()))
+	for y := 0; y < matrix.GetHeight(); y++ {
+		for x := 0; x < matrix.GetWidth(); x++ {
+			if matrix.Get(x, y) {
+				img.Set(x, y, dark)
+			} else {
+				img.Set(x, y, light)
+			}
+		}
+	}
+	return img
+}
+
+// Paste 把src贴到dst的(x,y)处
+func Paste(dst draw.Image, src image.Image, x, y int) {
+	r := src.Bounds().Sub(src.Bounds().Min).Add(image.Pt(x, y))
+	draw.Draw(dst, r, src, src.Bounds().Min, draw.Src)
+}
+
+// Texture 生成类似照片的平滑色块加细小噪点
+func Texture(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	coarse := image.NewNRGBA(image.Rect(0, 0, w/40+2, h/40+2))
+	for i := 0; i < len(coarse.Pix); i += 4 {
+		coarse.Pix[i] = uint8(rng.Intn(256))
+		coarse.Pix[i+1] = uint8(rng.Intn(256))
+		coarse.Pix[i+2] = uint8(rng.Intn(256))
+		coarse.Pix[i+3] = 255
+	}
+	img := imaging.Resize(coarse, w, h, imaging.Linear)
+	for i := 0; i < len(img.Pix); i += 4 {
+		noise := rng.Intn(41) - 20
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = clamp(int(img.Pix[i+c]) + noise)
+		}
+	}
+	return img
+}
+
+// Tiles 生成6像素的随机色块,纹理比照片更细碎
+func Tiles(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y += 6 {
+		for x := 0; x < w; x += 6 {
+			c := color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+			draw.Draw(img, image.Rect(x, y, x+6, y+6), &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+	return img
+}
+
+func onWhite(w, h int, src image.Image, x, y int) *image.NRGBA {
+	img := imaging.New(w, h, color.White)
+	Paste(img, src, x, y)
+	return img
+}
+
+// screenshot 模拟手机长截图,二维码位于底部
+func screenshot() *image.NRGBA {
+	img := imaging.New(480, 1800, color.NRGBA{240, 240, 240, 255})
+	rng := rand.New(rand.NewSource(9))
+	for y := 40; y < 1400; y += 90 {
+		draw.Draw(img, image.Rect(20, y, 460, y+70), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		Paste(img, textLines(360, 50, rng.Int63()), 90, y+10)
+	}
+	Paste(img, QR(AdText, 180, color.Black, color.White), 150, 1520)
+	return img
+}
+
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(255 * x / w), uint8(255 * y / h), 128, 255})
+		}
+	}
+	return img
+}
+
+// stripes 生成宽度随机的竖条,类似一维条码
+func stripes(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := imaging.New(w, h, color.White)
+	for x := 20; x < w-20; {
+		width := 2 + rng.Intn(8)
+		if rng.Intn(2) == 0 {
+			draw.Draw(img, image.Rect(x, 0, x+width, h), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+		}
+		x += width
+	}
+	return img
+}
+
+// textLines 用长短不一的黑色短条模拟文字
+func textLines(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := imaging.New(w, h, color.White)
+	for y := 8; y+12 < h; y += 22 {
+		for x := 8; x < w-8; {
+			word := 10 + rng.Intn(40)
+			if x+word > w-8 {
+				break
+			}
+			draw.Draw(img, image.Rect(x, y, x+word, y+12), &image.Uniform{color.Gray{uint8(rng.Intn(60))}}, image.Point{}, draw.Src)
+			x += word + 6
+		}
+	}
+	return img
+}
+
+// finderDecoy 在随机模块的三个角上画出定位图案,没有时序图案和格式信息,不是有效的二维码
+func finderDecoy(size int, seed int64) *image.NRGBA {
+	const modules = 25
+	rng := rand.New(rand.NewSource(seed))
+	cells := make([][]bool, modules)
+	for i := range cells {
+		cells[i] = make([]bool, modules)
+		for j := range cells[i] {
+			cells[i][j] = rng.Intn(2) == 0
+		}
+	}
+	finder := func(top, left int) {
+		for i := -1; i <= 7; i++ {
+			for j := -1; j <= 7; j++ {
+				y, x := top+i, left+j
+				if y < 0 || x < 0 || y >= modules || x >= modules {
+					continue
+				}
+				ring := i >= 0 && i <= 6 && j >= 0 && j <= 6 && (i == 0 || i == 6 || j == 0 || j == 6)
+				core := i >= 2 && i <= 4 && j >= 2 && j <= 4
+				cells[y][x] = ring || core
+			}
+		}
+	}
+	finder(0, 0)
+	finder(0, modules-7)
+	finder(modules-7, 0)
+
+	module := size / (modules + 8)
+	img := imaging.New(size, size, color.White)
+	for i := range cells {
+		for j := range cells[i] {
+			if cells[i][j] {
+				x, y := (j+4)*module, (i+4)*module
+				draw.Draw(img, image.Rect(x, y, x+module, y+module), &image.Uniform{color.Black}, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
+
+func clamp(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
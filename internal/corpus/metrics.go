@@ -0,0 +1,43 @@
+package corpus
+
+import "fmt"
+
+// Tally 统计检测结果与标注的对比
+type Tally struct {
+	TP, FP, TN, FN int
+}
+
+// Add 记录一次检测,expected为标注,got为检测结果
+func (t *Tally) Add(expected, got bool) {
+	switch {
+	case expected && got:
+		t.TP++
+	case expected:
+		t.FN++
+	case got:
+		t.FP++
+	default:
+		t.TN++
+	}
+}
+
+// Precision 是检测为阳性的结果中真正阳性的比例,没有阳性结果时为1
+func (t Tally) Precision() float64 {
+	if t.TP+t.FP == 0 {
+		return 1
+	}
+	return float64(t.TP) / float64(t.TP+t.FP)
+}
+
+// Recall 是所有阳性样本中被检测出的比例,没有阳性样本时为1
+func (t Tally) Recall() float64 {
+	if t.TP+t.FN == 0 {
+		return 1
+	}
+	return float64(t.TP) / float64(t.TP+t.FN)
+}
+
+func (t Tally) String() string {
+	return fmt.Sprintf("precision %.2f recall %.2f (tp %d fp %d tn %d fn %d)",
+		t.Precision(), t.Recall(), t.TP, t.FP, t.TN, t.FN)
+}
@@ -0,0 +1,266 @@
+package corpus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+)
+
+// MP4 描述一个合成的MP4文件,只生成解析器关心的box,样本数据原样写入mdat
+type MP4 struct {
+	// Timescale 同时用于mvhd和视频轨道的mdhd
+	Timescale uint32
+	// SampleDelta 是每个样本的时长,单位为Timescale
+	SampleDelta uint32
+	// Samples 是视频样本,MJPEG视频的每个样本是一张JPEG图片
+	Samples [][]byte
+	// Codec 是视频样本描述的类型,如 avc1、jpeg
+	Codec  string
+	Width  int
+	Height int
+	// AVCC 不为空时作为avcC box写入样本描述,H.264视频解码需要其中的参数集
+	AVCC []byte
+	// SyncSamples 不为空时写入stss,是关键帧的样本序号(从1开始)
+	SyncSamples []uint32
+
+	// Version1 使用64位时长的mvhd/mdhd
+	Version1 bool
+	// UnknownDuration 在mvhd中写入表示未知的时长
+	UnknownDuration bool
+	// MoovAtEnd 把moov放在mdat之后,模拟未做faststart的文件
+	MoovAtEnd bool
+	// LargeMdat 使用64位largesize的mdat头
+	LargeMdat bool
+	// Co64 使用64位的chunk偏移表
+	Co64 bool
+	// Audio 额外添加一条音频轨道
+	Audio bool
+	// Cover 不为空时写入udta封面图
+	Cover []byte
+	// Fragments 大于0时生成分片MP4,样本平均分配到各个moof中
+	Fragments int
+	// Mehd 在分片MP4的mvex中写入总时长
+	Mehd bool
+}
+
+// Duration 返回视频轨道的时长,单位为Timescale
+func (m MP4) Duration() uint64 {
+	return uint64(len(m.Samples)) * uint64(m.SampleDelta)
+}
+
+// Bytes 生成文件内容
+func (m MP4) Bytes() []byte {
+	ftyp := box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2mp41"))
+	if m.Fragments > 0 {
+		return m.fragmented(ftyp)
+	}
+
+	var payload []byte
+	for _, sample := range m.Samples {
+		payload = append(payload, sample...)
+	}
+	mdatHeader := 8
+	if m.LargeMdat {
+		mdatHeader = 16
+	}
+
+	// 样本偏移取决于moov的长度,moov的长度与偏移的值无关,先用0生成一次得到长度
+	dataStart := len(ftyp) + mdatHeader
+	if !m.MoovAtEnd {
+		dataStart += len(m.moov(0))
+	}
+	moov := m.moov(uint64(dataStart))
+
+	var mdat []byte
+	if m.LargeMdat {
+		mdat = append(append(u32(1), []byte("mdat")...), u64(uint64(16+len(payload)))...)
+		mdat = append(mdat, payload...)
+	} else {
+		mdat = box("mdat", payload)
+	}
+	if m.MoovAtEnd {
+		return concat(ftyp, mdat, moov)
+	}
+	return concat(ftyp, moov, mdat)
+}
+
+// fragmented 生成 ftyp + moov(mvex) + 若干个 moof/mdat
+func (m MP4) fragmented(ftyp []byte) []byte {
+	out := concat(ftyp, m.moov(0))
+	perFragment := (len(m.Samples) + m.Fragments - 1) / m.Fragments
+	for i := 0; i < m.Fragments; i++ {
+		start := i * perFragment
+		end := start + perFragment
+		if end > len(m.Samples) {
+			end = len(m.Samples)
+		}
+		if start >= end {
+			break
+		}
+		var payload []byte
+		for _, sample := range m.Samples[start:end] {
+			payload = append(payload, sample...)
+		}
+		// trun只写样本数,样本时长取trex中的默认值
+		traf := box("traf",
+			fullBox("tfhd", 0, 0, u32(1)),
+			fullBox("trun", 0, 0, u32(uint32(end-start))))
+		moof := box("moof", fullBox("mfhd", 0, 0, u32(uint32(i+1))), traf)
+		out = concat(out, moof, box("mdat", payload))
+	}
+	return out
+}
+
+func (m MP4) moov(dataStart uint64) []byte {
+	duration := m.Duration()
+	movieDuration := duration
+	if m.Fragments > 0 {
+		movieDuration = 0
+	}
+	var children [][]byte
+	children = append(children, m.times("mvhd", m.Timescale, movieDuration, m.UnknownDuration, make([]byte, 80)))
+	children = append(children, m.videoTrak(dataStart))
+	if m.Audio {
+		children = append(children, m.audioTrak())
+	}
+	if m.Fragments > 0 {
+		var mvex [][]byte
+		if m.Mehd {
+			mvex = append(mvex, fullBox("mehd", 0, 0, u32(uint32(duration))))
+		}
+		mvex = append(mvex, fullBox("trex", 0, 0, u32(1), u32(1), u32(m.SampleDelta), u32(0), u32(0)))
+		children = append(children, box("mvex", mvex...))
+	}
+	if len(m.Cover) > 0 {
+		data := box("data", u32(13), u32(0), m.Cover)
+		ilst := box("ilst", box("covr", data))
+		hdlr := fullBox("hdlr", 0, 0, u32(0), []byte("mdir"), make([]byte, 13))
+		children = append(children, box("udta", fullBox("meta", 0, 0, hdlr, ilst)))
+	}
+	return box("moov", children...)
+}
+
+func (m MP4) videoTrak(dataStart uint64) []byte {
+	tkhd := tkhd(1, m.Width, m.Height)
+
+	entry := concat([]byte{0, 0, 0, 0, 0, 0}, u16(1), make([]byte, 16), u16(uint16(m.Width)), u16(uint16(m.Height)),
+		u32(0x00480000), u32(0x00480000), u32(0), u16(1), make([]byte, 32), u16(24), u16(0xFFFF))
+	if len(m.AVCC) > 0 {
+		entry = concat(entry, box("avcC", m.AVCC))
+	}
+	stsd := fullBox("stsd", 0, 0, u32(1), box(m.Codec, entry))
+
+	var stbl [][]byte
+	stbl = append(stbl, stsd)
+	if m.Fragments > 0 {
+		// 分片MP4的样本表为空,样本信息在moof中
+		stbl = append(stbl,
+			fullBox("stts", 0, 0, u32(0)),
+			fullBox("stsc", 0, 0, u32(0)),
+			fullBox("stsz", 0, 0, u32(0), u32(0)),
+			fullBox("stco", 0, 0, u32(0)))
+	} else {
+		// 每个chunk一个样本
+		stts := fullBox("stts", 0, 0, u32(1), u32(uint32(len(m.Samples))), u32(m.SampleDelta))
+		stsc := fullBox("stsc", 0, 0, u32(1), u32(1), u32(1), u32(1))
+		sizes := [][]byte{u32(0), u32(uint32(len(m.Samples)))}
+		offsets := [][]byte{u32(uint32(len(m.Samples)))}
+		offset := dataStart
+		for _, sample := range m.Samples {
+			sizes = append(sizes, u32(uint32(len(sample))))
+			if m.Co64 {
+				offsets = append(offsets, u64(offset))
+			} else {
+				offsets = append(offsets, u32(uint32(offset)))
+			}
+			offset += uint64(len(sample))
+		}
+		chunkBox := "stco"
+		if m.Co64 {
+			chunkBox = "co64"
+		}
+		stbl = append(stbl, stts, stsc, fullBox("stsz", 0, 0, sizes...), fullBox(chunkBox, 0, 0, offsets...))
+		if len(m.SyncSamples) > 0 {
+			stss := [][]byte{u32(uint32(len(m.SyncSamples)))}
+			for _, n := range m.SyncSamples {
+				stss = append(stss, u32(n))
+			}
+			stbl = append(stbl, fullBox("stss", 0, 0, stss...))
+		}
+	}
+
+	duration := m.Duration()
+	if m.Fragments > 0 {
+		duration = 0
+	}
+	mdia := box("mdia",
+		m.times("mdhd", m.Timescale, duration, false, make([]byte, 4)),
+		fullBox("hdlr", 0, 0, u32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00")),
+		box("minf", box("stbl", stbl...)))
+	return box("trak", tkhd, mdia)
+}
+
+// audioTrak 生成一条没有样本的音频轨道,时长与视频相同
+func (m MP4) audioTrak() []byte {
+	const rate = 44100
+	entry := concat([]byte{0, 0, 0, 0, 0, 0}, u16(1), make([]byte, 8), u16(2), u16(16), u32(0), u32(rate<<16))
+	duration := m.Duration() * rate / uint64(m.Timescale)
+	mdia := box("mdia",
+		m.times("mdhd", rate, duration, false, make([]byte, 4)),
+		fullBox("hdlr", 0, 0, u32(0), []byte("soun"), make([]byte, 12), []byte("SoundHandler\x00")),
+		box("minf", box("stbl", fullBox("stsd", 0, 0, u32(1), box("mp4a", entry)))))
+	return box("trak", tkhd(2, 0, 0), mdia)
+}
+
+// times 生成mvhd/mdhd,v0为32位时长,v1为64位时长
+func (m MP4) times(typ string, timescale uint32, duration uint64, unknown bool, rest []byte) []byte {
+	if m.Version1 {
+		if unknown {
+			duration = ^uint64(0)
+		}
+		return fullBox(typ, 1, 0, u64(0), u64(0), u32(timescale), u64(duration), rest)
+	}
+	d := uint32(duration)
+	if unknown {
+		d = 0xFFFFFFFF
+	}
+	return fullBox(typ, 0, 0, u32(0), u32(0), u32(timescale), u32(d), rest)
+}
+
+func tkhd(id uint32, width, height int) []byte {
+	return fullBox("tkhd", 0, 3, u32(0), u32(0), u32(id), u32(0), u32(0), make([]byte, 8),
+		u16(0), u16(0), u16(0), u16(0), make([]byte, 36), u32(uint32(width)<<16), u32(uint32(height)<<16))
+}
+
+// JPEG 把图片编码为JPEG,用作MJPEG视频的样本或封面图
+func JPEG(img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	body := concat(payload...)
+	return concat(u32(uint32(8+len(body))), []byte(typ), body)
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	return box(typ, append([][]byte{u32(uint32(version)<<24 | flags)}, payload...)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
@@ -0,0 +1,100 @@
+package corpus
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/disintegration/imaging"
+)
+
+// SunCodes 返回小程序码用例,QR表示图片中含有小程序码
+// 反例是形状相近的图案:只有同心圆定位点、只有放射状码条、成片的同心圆图标和方形定位点的二维码
+func SunCodes() []ImageCase {
+	poster := Texture(900, 600, 21)
+	Paste(poster, SunCode(180, 22, color.Black, color.White), 680, 380)
+
+	large := Texture(1600, 1200, 23)
+	Paste(large, SunCode(400, 24, color.Black, color.White), 200, 300)
+
+	grid := imaging.New(700, 500, color.White)
+	for y := 30; y+100 <= 500; y += 150 {
+		for x := 30; x+100 <= 700; x += 160 {
+			Paste(grid, sunCode(100, 25, color.Black, color.White, true, false), x, y)
+		}
+	}
+
+	return []ImageCase{
+		{Name: "suncode_center", QR: true, Ext: ".png", Image: onWhite(600, 600, SunCode(300, 26, color.Black, color.White), 150, 150)},
+		{Name: "suncode_poster_corner", QR: true, Ext: ".png", Image: poster},
+		{Name: "suncode_green_jpeg", QR: true, Ext: ".jpg", Image: onWhite(500, 500, SunCode(260, 27, color.NRGBA{7, 140, 70, 255}, color.White), 120, 120)},
+		{Name: "suncode_rotated", QR: true, Ext: ".png", Image: imaging.Rotate(onWhite(500, 500, SunCode(260, 28, color.Black, color.White), 120, 120), 30, color.White)},
+		{Name: "suncode_large_photo", QR: true, Ext: ".jpg", Image: large},
+		{Name: "bullseyes", QR: false, Ext: ".png", Image: onWhite(600, 600, sunCode(300, 29, color.Black, color.White, true, false), 150, 150)},
+		{Name: "sunburst", QR: false, Ext: ".png", Image: onWhite(600, 600, sunCode(300, 30, color.Black, color.White, false, true), 150, 150)},
+		{Name: "bullseye_grid", QR: false, Ext: ".png", Image: grid},
+		{Name: "qr_finder_squares", QR: false, Ext: ".png", Image: onWhite(600, 600, QR(AdText, 300, color.Black, color.White), 150, 150)},
+	}
+}
+
+// SunCode 生成size×size的小程序码:圆心附近是头像,外圈是长短不一的放射状码条,
+// 左上、右上、左下三个同心圆定位点位于内切于圆的正方形角上
+func SunCode(size int, seed int64, dark, light color.Color) image.Image {
+	return sunCode(size, seed, dark, light, true, true)
+}
+
+// sunCode 按需只画定位点或只画码条,用于生成形状相近的反例
+func sunCode(size int, seed int64, dark, light color.Color, withEyes, withBars bool) *image.NRGBA {
+	const bars = 48
+	rng := rand.New(rand.NewSource(seed))
+	inner := make([]float64, bars)
+	outer := make([]float64, bars)
+	for i := range inner {
+		inner[i] = 0.35 + 0.1*rng.Float64()
+		outer[i] = 0.8 + 0.2*rng.Float64()
+	}
+
+	center := float64(size) / 2
+	radius := float64(size) * 0.46
+	// 定位点到圆心的距离为0.68倍半径,检测时在其0.75-1.15倍处采样码条
+	offset := radius * 0.68 / math.Sqrt2
+	eyes := [][2]float64{{center - offset, center - offset}, {center + offset, center - offset}, {center - offset, center + offset}}
+	// 定位点由宽1u的外环、宽1u的间隙和直径3u的中心圆组成
+	unit := radius * 0.13 / 3.5
+
+	img := imaging.New(size, size, light)
+	avatar := color.Gray{160}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			r := math.Hypot(px-center, py-center) / radius
+
+			nearEye := false
+			for _, eye := range eyes {
+				d := math.Hypot(px-eye[0], py-eye[1]) / unit
+				if d > 5 {
+					continue
+				}
+				nearEye = true
+				if withEyes && (d <= 1.5 || (d > 2.5 && d <= 3.5)) {
+					img.Set(x, y, dark)
+				}
+			}
+			switch {
+			case nearEye:
+			case r <= 0.3:
+				img.Set(x, y, avatar)
+			case withBars && r <= 1:
+				// 每个角度区间的前一半是码条
+				angle := math.Atan2(py-center, px-center) + math.Pi
+				slot := angle / (2 * math.Pi) * bars
+				i := int(slot) % bars
+				if slot-math.Floor(slot) < 0.5 && r >= inner[i] && r <= outer[i] {
+					img.Set(x, y, dark)
+				}
+			}
+		}
+	}
+	return img
+}
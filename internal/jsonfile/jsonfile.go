@@ -0,0 +1,65 @@
+// Package jsonfile 提供持久化到单个json文件的存储共用的读写和全局实例
+package jsonfile
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Load 从path读取json到v,文件不存在时返回false且不修改v
+func Load(path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Save 把v写入临时文件后替换path,避免写一半时崩溃损坏文件
+func Save(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Global 是按文件加载的全局实例,首次Get时加载默认文件,Open可以随时换成其他文件
+type Global[T any] struct {
+	path     string
+	open     func(path string) *T
+	instance *T
+	mu       sync.Mutex
+}
+
+// NewGlobal 返回以path为默认文件、用open加载的全局实例
+func NewGlobal[T any](path string, open func(path string) *T) *Global[T] {
+	return &Global[T]{path: path, open: open}
+}
+
+// Get 返回当前实例,尚未加载时从默认文件加载
+func (g *Global[T]) Get() *T {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.instance == nil {
+		g.instance = g.open(g.path)
+	}
+	return g.instance
+}
+
+// Open 从path重新加载并替换当前实例
+func (g *Global[T]) Open(path string) *T {
+	instance := g.open(path)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.instance = instance
+	return instance
+}
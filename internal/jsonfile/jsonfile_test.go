@@ -0,0 +1,65 @@
+package jsonfile
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	var got map[string]int
+	if found, err := Load(path, &got); found || err != nil {
+		t.Fatalf("Load missing file = %v, %v; want false, nil", found, err)
+	}
+
+	if err := Save(path, map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+	if found, err := Load(path, &got); !found || err != nil || got["a"] != 1 {
+		t.Fatalf("Load = %v, %v, %v", found, err, got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, &got); err == nil {
+		t.Error("Load accepted truncated json")
+	}
+}
+
+// TestGlobalOpen 并发Get和Open时应总是拿到完整加载的实例,配合-race检查
+func TestGlobalOpen(t *testing.T) {
+	type store struct{ path string }
+	g := NewGlobal("default.json", func(path string) *store {
+		return &store{path: path}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if s := g.Get(); s == nil || s.path == "" {
+				t.Errorf("Get = %+v", s)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			g.Open("other.json")
+		}()
+	}
+	wg.Wait()
+
+	if s := g.Get(); s.path != "other.json" {
+		t.Errorf("Get after Open = %q, want other.json", s.path)
+	}
+	if s := g.Open("third.json"); s != g.Get() {
+		t.Error("Open did not replace the instance")
+	}
+}
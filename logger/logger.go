@@ -1,12 +1,8 @@
 package logger
 
 import (
-	"crypto/md5"
-	"crypto/tls"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,16 +10,12 @@ import (
 
 var logFolder = "video"
 
-func init() {
-	// 确保日志文件夹存在
-	err := os.MkdirAll(logFolder, 0755)
-	if err != nil {
-		log.Fatalf("Failed to create log directory: %v", err)
-	}
-}
-
 // LogEvent logs the specified message to a file named with today's date
 func LogEvent(message string) {
+	// 第一次写日志时才创建日志文件夹,只引用本包(如测试)时不在工作目录留下空文件夹
+	if err := os.MkdirAll(logFolder, 0755); err != nil {
+		log.Fatalf("Failed to create log directory: %v", err)
+	}
 	now := time.Now()
 	filename := filepath.Join(logFolder, now.Format("2006-01-02")+".log")
 
@@ -38,39 +30,3 @@ func LogEvent(message string) {
 		log.Fatalf("Failed to write to log file: %v", err)
 	}
 }
-
-// DownloadVideo downloads the video from the specified URL and ignores SSL certificate errors
-func DownloadVideo(url, selfID string) string {
-	// Create a custom HTTP client that ignores certificate errors
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: tr,
-	}
-
-	// Use the custom client to initiate a request
-	resp, err := client.Get(url)
-	if err != nil {
-		LogEvent(fmt.Sprintf("Failed to download video for selfID %s: %v", selfID, err))
-		return ""
-	}
-	defer resp.Body.Close()
-
-	hash := md5.Sum([]byte(url))
-	filePath := filepath.Join(logFolder, fmt.Sprintf("%x.mp4", hash))
-	file, err := os.Create(filePath)
-	if err != nil {
-		LogEvent(fmt.Sprintf("Failed to create file for video URL %s: %v", url, err))
-		return ""
-	}
-	defer file.Close()
-
-	if _, err := io.Copy(file, resp.Body); err != nil {
-		LogEvent(fmt.Sprintf("Failed to save video for URL %s: %v", url, err))
-		return ""
-	}
-
-	LogEvent(fmt.Sprintf("Video downloaded successfully for URL %s, saved to %s", url, filePath))
-	return filePath
-}
@@ -10,15 +10,26 @@ import (
 	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/cli"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/server"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/superini"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/webapi"
 )
 
 func main() {
+	// scan子命令离线检测本地文件,不启动机器人
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		os.Exit(cli.Scan(os.Args[2:]))
+	}
+	// replay子命令回放录制的onebot事件,只输出会执行的动作,不连接机器人
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(cli.Replay(os.Args[2:]))
+	}
+
 	// 如果用户指定了-yml参数
 	configFilePath := "config.yml" // 默认配置文件路径
 
@@ -28,19 +39,46 @@ func main() {
 	}
 
 	// 加载配置
-	superini.GetInstance()
 	conf, err := config.LoadConfig(configFilePath)
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
+	// 加载各群的设置,首次运行时从旧版config.ini迁移
+	groupconfig.GetInstance()
+
+	// 检查条码格式配置
+	utils.CheckBarcodeFormats()
+
+	// 检查违规阶梯处罚配置
+	pipeline.CheckPunishLadder()
+
+	// 报告ffmpeg等检测能力是否可用
+	utils.ReportCapabilities()
 
 	// 判断是否设置多个http地址,获取对应关系
 	if len(config.GetHttpPaths()) > 0 {
 		utils.FetchAndStoreUserIDs()
 	}
+	// 检测流水线,撤回等动作按self_id选择ws或http发送
+	pipeline.Init(server.GetTransport)
+
 	router := gin.Default()
 	router.GET("/videoDuration", webapi.GetVideoPlaylist)
 	router.GET("/picheck", webapi.GetImageAndCheckQRCode)
+	router.GET("/metrics/queue", webapi.GetQueueStats)
+	router.GET("/capabilities", webapi.GetCapabilities)
+	router.GET("/phash", webapi.ListPhash)
+	// 修改黑名单、禁言和群设置的接口需要admin_token
+	admin := router.Group("/", webapi.RequireAdminToken)
+	admin.POST("/phash", webapi.AddPhash)
+	admin.DELETE("/phash", webapi.RemovePhash)
+	admin.POST("/mute", webapi.Mute)
+	admin.DELETE("/mute", webapi.Unmute)
+	admin.POST("/mute/all", webapi.MuteAll)
+	admin.DELETE("/mute/all", webapi.UnmuteAll)
+	admin.GET("/group/settings", webapi.GetGroupSettings)
+	admin.POST("/group/settings", webapi.SetGroupSetting)
+	admin.DELETE("/group/settings", webapi.UnsetGroupSetting)
 
 	//正向ws
 	wspath := conf.Settings.WsPath
@@ -52,6 +90,9 @@ func main() {
 		fmt.Println("正向ws启动成功,监听0.0.0.0:" + conf.Settings.Port + "/" + wspath + "请注意设置ws_server_token(可空),并对外放通端口...")
 	}
 
+	//主动连接onebot的ws地址(适用于本程序无法对外放通端口的情况)
+	server.StartReverseWsClients(conf)
+
 	// 创建一个http.Server实例(主服务器)
 	httpServer := &http.Server{
 		Addr:    "0.0.0.0:" + conf.Settings.Port,
@@ -67,14 +108,6 @@ func main() {
 		}
 	}()
 
-	// 调试用
-	//bool := utils.ContainsQRCode("C:\\Users\\Cosmo\\Pictures\\haibao.png")
-	//bool := utils.ContainsQRCode("C:\\Users\\Cosmo\\Pictures\\frame_0002.jpg")
-	//bool := utils.ContainsQRCode("C:\\Users\\Cosmo\\Pictures\\智能体背景1.jpg")
-	//bool := utils.ContainsQRCode("C:\\Users\\Cosmo\\Pictures\\支付宝.JPG")
-
-	//fmt.Printf("%v", bool)
-
 	// 设置信号捕获
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,28 @@
+package media
+
+import (
+	"fmt"
+)
+
+// FetchVideoDuration 通过Range请求读取视频的moov等元数据,解析出时长(秒)
+func FetchVideoDuration(videoURL string) (float64, error) {
+	info, err := FetchVideoInfo(videoURL)
+	if err != nil {
+		return 0, err
+	}
+	return info.Duration, nil
+}
+
+// FetchVideoInfo 通过Range请求读取视频元数据,moov位于文件末尾时跳过mdat直接读取末尾部分
+func FetchVideoInfo(videoURL string) (*VideoInfo, error) {
+	reader, err := OpenRange(videoURL, TypeVideo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video: %w", err)
+	}
+
+	info, err := Probe(reader, reader.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse video after %d requests: %v", reader.requests, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,218 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+)
+
+// Type 是媒体类型,决定大小上限和允许的文件格式
+type Type int
+
+const (
+	TypeVideo Type = iota
+	TypeImage
+)
+
+func (t Type) String() string {
+	if t == TypeImage {
+		return "image"
+	}
+	return "video"
+}
+
+// maxBytes 返回该类型允许下载的最大字节数
+func (t Type) maxBytes() int64 {
+	if t == TypeImage {
+		return int64(config.GetMaxImageSizeMB()) * 1024 * 1024
+	}
+	return int64(config.GetMaxVideoSizeMB()) * 1024 * 1024
+}
+
+// dir 返回保存该类型文件的目录,视频与日志放在同一目录
+func (t Type) dir() string {
+	if t == TypeImage {
+		return "images"
+	}
+	return "video"
+}
+
+var (
+	// ErrTooLarge 表示文件超过了该类型的大小上限
+	ErrTooLarge = errors.New("media too large")
+	// ErrContentType 表示服务器返回的Content-Type与媒体类型不符
+	ErrContentType = errors.New("unexpected content type")
+	// ErrBadMagic 表示文件头与媒体类型不符
+	ErrBadMagic = errors.New("unrecognized file signature")
+)
+
+// sniffSize 是检查文件头时读取的字节数
+const sniffSize = 16
+
+// Fetch 下载媒体文件到本地并返回路径
+// 先用HEAD请求检查大小和类型,服务器不支持HEAD时依靠下载过程中的限制,超过上限的文件会被删除
+func Fetch(mediaURL string, t Type) (string, error) {
+	client := newHTTPClient(time.Duration(config.GetDownloadTimeout()) * time.Second)
+	maxBytes := t.maxBytes()
+
+	if resp, err := client.Head(mediaURL); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			if err := checkResponse(resp, t, maxBytes); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	resp, err := client.Get(mediaURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", t, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", t, resp.Status)
+	}
+	if err := checkResponse(resp, t, maxBytes); err != nil {
+		return "", err
+	}
+
+	header := make([]byte, sniffSize)
+	n, err := io.ReadFull(resp.Body, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read %s: %v", t, err)
+	}
+	header = header[:n]
+	ext, ok := sniff(header, t)
+	if !ok {
+		return "", fmt.Errorf("%w for %s: % x", ErrBadMagic, t, header)
+	}
+
+	if err := os.MkdirAll(t.dir(), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+	// 每次下载使用随机名,同一URL的并发任务不会共用视频文件和帧目录
+	filePath := filepath.Join(t.dir(), uuid.New().String()+ext)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %v", err)
+	}
+
+	body := io.MultiReader(bytes.NewReader(header), io.LimitReader(resp.Body, maxBytes-int64(n)+1))
+	written, err := io.Copy(file, body)
+	file.Close()
+	if err == nil && written > maxBytes {
+		err = fmt.Errorf("%w: %s exceeds %d bytes", ErrTooLarge, t, maxBytes)
+	}
+	if err != nil {
+		os.Remove(filePath)
+		if errors.Is(err, ErrTooLarge) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to save %s: %v", t, err)
+	}
+	return filePath, nil
+}
+
+// OpenRange 不下载整个文件,返回按需发起Range请求的reader,用于只需要读取元数据的检测
+func OpenRange(mediaURL string, t Type) (*RangeReader, error) {
+	reader, err := NewRangeReader(newHTTPClient(time.Duration(config.GetDownloadTimeout())*time.Second), mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	if !allowedContentType(reader.contentType, t) {
+		return nil, fmt.Errorf("%w %q for %s", ErrContentType, reader.contentType, t)
+	}
+	header := make([]byte, sniffSize)
+	n, _ := reader.ReadAt(header, 0)
+	if _, ok := sniff(header[:n], t); !ok {
+		return nil, fmt.Errorf("%w for %s: % x", ErrBadMagic, t, header[:n])
+	}
+	return reader, nil
+}
+
+// checkResponse 检查Content-Length和Content-Type
+func checkResponse(resp *http.Response, t Type, maxBytes int64) error {
+	if resp.ContentLength > maxBytes {
+		return fmt.Errorf("%w: %s is %d bytes, limit %d", ErrTooLarge, t, resp.ContentLength, maxBytes)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !allowedContentType(contentType, t) {
+		return fmt.Errorf("%w %q for %s", ErrContentType, contentType, t)
+	}
+	return nil
+}
+
+// allowedContentType 未声明类型或声明为通用二进制时交给文件头判断
+func allowedContentType(contentType string, t Type) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/octet-stream", "binary/octet-stream":
+		return true
+	}
+	if t == TypeImage {
+		return strings.HasPrefix(mediaType, "image/")
+	}
+	return strings.HasPrefix(mediaType, "video/") || mediaType == "application/mp4"
+}
+
+// sniff 按文件头判断格式,返回对应的扩展名
+func sniff(header []byte, t Type) (string, bool) {
+	if t == TypeVideo {
+		// ISO-BMFF/QuickTime 文件以box开头,第4-8字节是box类型
+		if len(header) >= 8 {
+			switch string(header[4:8]) {
+			case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+				return ".mp4", true
+			}
+		}
+		return "", false
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg", true
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png", true
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return ".gif", true
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return ".webp", true
+	case bytes.HasPrefix(header, []byte("BM")):
+		return ".bmp", true
+	}
+	return "", false
+}
+
+// SniffFile 按文件头判断本地文件是视频还是图片
+func SniffFile(path string) (Type, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffSize)
+	n, _ := io.ReadFull(file, header)
+	for _, t := range []Type{TypeVideo, TypeImage} {
+		if _, ok := sniff(header[:n], t); ok {
+			return t, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,532 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/h264"
+)
+
+// Frame 是从视频中取出的一帧
+type Frame struct {
+	Path string
+	// Time 是该帧在视频中的时间(秒),未知时为-1
+	Time float64
+}
+
+// FrameSource 从视频中取出用于检测的帧
+// 没有ffmpeg时由内置的H.264解码器处理关键帧,H.265等其它编码只能处理MJPEG视频和容器中的封面图
+type FrameSource interface {
+	Name() string
+	// Available 报告当前环境是否具备该来源需要的依赖
+	Available() bool
+	// Supports 报告是否能处理该视频,info为nil表示容器解析失败
+	Supports(info *VideoInfo) bool
+	// Extract 把帧写入FramesDir并逐帧回调,emit返回false时立即停止抽帧
+	// ctx取消时停止抽帧并返回nil,由调用方根据ctx判断是否超时
+	Extract(ctx context.Context, req FrameRequest, emit func(Frame) bool) error
+}
+
+// FrameRequest 是一次抽帧的参数
+type FrameRequest struct {
+	VideoPath string
+	FramesDir string
+	// Info 是容器解析结果,解析失败时为nil
+	Info     *VideoInfo
+	Sampling Sampling
+}
+
+// duration 返回视频时长,未知时为0
+func (r FrameRequest) duration() float64 {
+	if r.Info == nil {
+		return 0
+	}
+	return r.Info.Duration
+}
+
+// ErrNoFrameSource 表示没有可用的帧来源能处理该视频
+var ErrNoFrameSource = errors.New("no frame source available for this video")
+
+// FrameSources 按优先级返回所有帧来源
+func FrameSources() []FrameSource {
+	return []FrameSource{ffmpegSource{}, h264Source{}, mjpegSource{}, coverArtSource{}}
+}
+
+// ExtractFrames 按配置的抽帧策略依次尝试可用的帧来源,返回实际使用的来源名
+func ExtractFrames(ctx context.Context, videoPath, framesDir string, emit func(Frame) bool) (string, error) {
+	info, err := ProbeFile(videoPath)
+	if err != nil {
+		info = nil
+	}
+	req := FrameRequest{VideoPath: videoPath, FramesDir: framesDir, Info: info, Sampling: SamplingFromConfig()}
+
+	var failures []string
+	for _, source := range FrameSources() {
+		if !source.Available() || !source.Supports(info) {
+			continue
+		}
+		if err := source.Extract(ctx, req, emit); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", source.Name(), err))
+			continue
+		}
+		return source.Name(), nil
+	}
+	if len(failures) > 0 {
+		return "", fmt.Errorf("%w (%s)", ErrNoFrameSource, strings.Join(failures, "; "))
+	}
+	return "", ErrNoFrameSource
+}
+
+// FFmpegPath 返回可用的ffmpeg路径,未找到时返回空字符串
+// 依次查找配置的ffmpeg_path、程序目录和工作目录下随程序分发的ffmpeg、环境变量PATH
+func FFmpegPath() string {
+	if configured := config.GetFFmpegPath(); configured != "" {
+		if path, err := exec.LookPath(configured); err == nil {
+			return path
+		}
+		return ""
+	}
+
+	name := "ffmpeg"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	var candidates []string
+	if exe, err := os.Executable(); err == nil {
+		dir := filepath.Dir(exe)
+		candidates = append(candidates, filepath.Join(dir, "ffmpeg", name), filepath.Join(dir, name))
+	}
+	candidates = append(candidates, filepath.Join("ffmpeg", name), name)
+	for _, candidate := range candidates {
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				return abs
+			}
+		}
+	}
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		return path
+	}
+	return ""
+}
+
+// ffmpegSource 调用ffmpeg按抽帧策略输出JPEG流,边解码边检测,支持所有ffmpeg能解码的格式
+type ffmpegSource struct{}
+
+func (ffmpegSource) Name() string { return "ffmpeg" }
+
+func (ffmpegSource) Available() bool { return FFmpegPath() != "" }
+
+func (ffmpegSource) Supports(info *VideoInfo) bool { return true }
+
+func (ffmpegSource) Extract(ctx context.Context, req FrameRequest, emit func(Frame) bool) error {
+	// 确保 videoPath 是绝对路径
+	absVideoPath, err := filepath.Abs(req.VideoPath)
+	if err != nil {
+		fmt.Printf("Failed to get absolute path for video: %v\n", err)
+		return err
+	}
+
+	// 检查并创建目录
+	if err := os.MkdirAll(req.FramesDir, 0755); err != nil {
+		fmt.Printf("Failed to create frames directory: %v\n", err)
+		return err
+	}
+
+	// 构建 ffmpeg 命令,帧以JPEG流的形式写到标准输出
+	duration := req.duration()
+	sampling := req.Sampling.resolve(duration)
+	cmd := exec.CommandContext(ctx, FFmpegPath(), "-v", "error", "-i", absVideoPath,
+		"-vf", req.Sampling.ffmpegFilter(duration), "-vsync", "vfr",
+		"-frames:v", strconv.Itoa(sampling.MaxFrames),
+		"-f", "image2pipe", "-vcodec", "mjpeg", "-q:v", "2", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+
+	scanner := newJPEGScanner(stdout)
+	count := 0
+	stopped := false
+	var scanErr error
+	for {
+		data, err := scanner.Next()
+		if err != nil {
+			if err != io.EOF {
+				scanErr = err
+			}
+			break
+		}
+		count++
+		framePath := filepath.Join(req.FramesDir, fmt.Sprintf("frame_%04d.jpg", count))
+		if err := os.WriteFile(framePath, data, 0644); err != nil {
+			scanErr = err
+			break
+		}
+		frameTime := -1.0
+		if sampling.Strategy == SamplingFPS {
+			frameTime = float64(count-1) / sampling.FPS
+		}
+		if !emit(Frame{Path: framePath, Time: frameTime}) {
+			// 已经得出结论,不再等待ffmpeg解码剩余部分
+			stopped = true
+			break
+		}
+	}
+
+	if stopped || scanErr != nil {
+		cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	if stopped || ctx.Err() != nil {
+		return nil
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to read ffmpeg output: %v", scanErr)
+	}
+	if waitErr != nil && count == 0 {
+		fmt.Printf("ffmpeg stderr: %s\n", stderr.String())
+		return fmt.Errorf("ffmpeg command failed with error: %v, stderr: %s", waitErr, stderr.String())
+	}
+	return nil
+}
+
+// h264Codecs 是内置解码器能处理的H.264样本描述类型
+var h264Codecs = []string{"avc1", "avc3"}
+
+// 内置H.264解码器的上限,码流来自群消息中的视频,不能让一个视频占用过多内存和时间
+const (
+	// maxH264Pixels 是单帧的最大像素数,约为4K
+	maxH264Pixels = 3840 * 2176
+	// maxH264Frames 是一个视频最多解码的关键帧数
+	maxH264Frames = 60
+)
+
+// h264Source 用内置的纯Go解码器解码H.264视频的关键帧,只取亮度,按抽帧策略在关键帧中挑选
+type h264Source struct{}
+
+func (h264Source) Name() string { return "h264" }
+
+func (h264Source) Available() bool { return true }
+
+func (h264Source) Supports(info *VideoInfo) bool {
+	if info == nil {
+		return false
+	}
+	for _, codec := range info.Codecs {
+		if containsCodec(h264Codecs, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h264Source) Extract(ctx context.Context, req FrameRequest, emit func(Frame) bool) error {
+	file, err := os.Open(req.VideoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	p, err := parseMP4(file, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	var t *track
+	for _, candidate := range p.tracks {
+		if containsCodec(h264Codecs, candidate.codec) && candidate.avcC != nil {
+			t = candidate
+			break
+		}
+	}
+	if t == nil {
+		return fmt.Errorf("no H.264 track with decoder configuration")
+	}
+	decoder, err := h264.NewDecoder(t.avcC)
+	if err != nil {
+		return err
+	}
+	decoder.MaxPixels = maxH264Pixels
+	offsets := t.sampleOffsets()
+	times := t.sampleTimes()
+	if len(offsets) == 0 {
+		return fmt.Errorf("empty sample table")
+	}
+	if len(times) < len(offsets) {
+		return fmt.Errorf("incomplete time-to-sample table")
+	}
+
+	// 只有关键帧能单独解码,抽帧策略在关键帧的时间点中挑选;没有stss时所有样本都是关键帧
+	var keys []int
+	var keyTimes []float64
+	if len(t.syncSamples) == 0 {
+		for i := range offsets {
+			keys = append(keys, i)
+		}
+	} else {
+		for _, n := range t.syncSamples {
+			if n >= 1 && int(n) <= len(offsets) {
+				keys = append(keys, int(n-1))
+			}
+		}
+	}
+	for _, i := range keys {
+		keyTimes = append(keyTimes, times[i])
+	}
+	if err := os.MkdirAll(req.FramesDir, 0755); err != nil {
+		return err
+	}
+
+	count := 0
+	var lastErr error
+	picked := req.Sampling.pick(keyTimes, req.duration())
+	if len(picked) > maxH264Frames {
+		picked = picked[:maxH264Frames]
+	}
+	for _, k := range picked {
+		if ctx.Err() != nil {
+			break
+		}
+		i := keys[k]
+		size := t.sampleSizes[i]
+		if size > maxMoofSize {
+			return fmt.Errorf("sample %d is too large (%d bytes)", i, size)
+		}
+		data := make([]byte, size)
+		if _, err := file.ReadAt(data, int64(offsets[i])); err != nil {
+			return fmt.Errorf("failed to read sample %d: %v", i, err)
+		}
+		img, err := decodeH264(decoder, data)
+		if errors.Is(err, h264.ErrUnsupported) {
+			return err
+		}
+		if err != nil {
+			// 单帧损坏或不是I帧时跳过,继续检查其它关键帧
+			lastErr = err
+			continue
+		}
+
+		count++
+		framePath := filepath.Join(req.FramesDir, fmt.Sprintf("frame_%04d.png", count))
+		if err := writePNG(framePath, img); err != nil {
+			return err
+		}
+		if !emit(Frame{Path: framePath, Time: times[i]}) {
+			break
+		}
+	}
+	if count == 0 && lastErr != nil {
+		return fmt.Errorf("no key frame could be decoded: %v", lastErr)
+	}
+	return nil
+}
+
+// decodeH264 解码一帧,解码器在畸形码流上panic时按该帧损坏处理
+// 离线扫描没有工作池的recover,不能让一个视频的码流错误结束整个进程
+func decodeH264(decoder *h264.Decoder, sample []byte) (img *image.Gray, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("h264 decoder panicked: %v", r)
+		}
+	}()
+	return decoder.Decode(sample)
+}
+
+// writePNG 把解码出的帧无损写入文件,避免再次压缩损失二维码的细节
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// mjpegCodecs 是样本本身就是JPEG图片的编码格式
+var mjpegCodecs = []string{"jpeg", "mjpa", "mjpb", "MJPG", "AVDJ", "dmb1"}
+
+// mjpegSource 不经解码直接从MJPEG视频的样本表中按抽帧策略取出JPEG帧
+type mjpegSource struct{}
+
+func (mjpegSource) Name() string { return "mjpeg" }
+
+func (mjpegSource) Available() bool { return true }
+
+func (mjpegSource) Supports(info *VideoInfo) bool {
+	if info == nil {
+		return false
+	}
+	for _, codec := range info.Codecs {
+		if containsCodec(mjpegCodecs, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mjpegSource) Extract(ctx context.Context, req FrameRequest, emit func(Frame) bool) error {
+	file, err := os.Open(req.VideoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	p, err := parseMP4(file, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	var t *track
+	for _, candidate := range p.tracks {
+		if containsCodec(mjpegCodecs, candidate.codec) {
+			t = candidate
+			break
+		}
+	}
+	if t == nil {
+		return fmt.Errorf("no MJPEG track")
+	}
+	offsets := t.sampleOffsets()
+	times := t.sampleTimes()
+	if len(offsets) == 0 {
+		return fmt.Errorf("empty sample table")
+	}
+	if err := os.MkdirAll(req.FramesDir, 0755); err != nil {
+		return err
+	}
+	if len(times) < len(offsets) {
+		return fmt.Errorf("incomplete time-to-sample table")
+	}
+
+	count := 0
+	for _, i := range req.Sampling.pick(times[:len(offsets)], req.duration()) {
+		if ctx.Err() != nil {
+			break
+		}
+		offset := offsets[i]
+		size := t.sampleSizes[i]
+		if size > maxMoofSize {
+			return fmt.Errorf("sample %d is too large (%d bytes)", i, size)
+		}
+		data := make([]byte, size)
+		if _, err := file.ReadAt(data, int64(offset)); err != nil {
+			return fmt.Errorf("failed to read sample %d: %v", i, err)
+		}
+		if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+			return fmt.Errorf("sample %d is not a JPEG image", i)
+		}
+
+		count++
+		framePath := filepath.Join(req.FramesDir, fmt.Sprintf("frame_%04d.jpg", count))
+		if err := os.WriteFile(framePath, data, 0644); err != nil {
+			return err
+		}
+		if !emit(Frame{Path: framePath, Time: times[i]}) {
+			break
+		}
+	}
+	return nil
+}
+
+// coverArtSource 取出容器中的封面图,没有其它来源可用时至少检查封面
+type coverArtSource struct{}
+
+func (coverArtSource) Name() string { return "cover_art" }
+
+func (coverArtSource) Available() bool { return true }
+
+func (coverArtSource) Supports(info *VideoInfo) bool { return info != nil && info.HasCoverArt }
+
+func (coverArtSource) Extract(ctx context.Context, req FrameRequest, emit func(Frame) bool) error {
+	file, err := os.Open(req.VideoPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	p, err := parseMP4(file, stat.Size())
+	if err != nil {
+		return err
+	}
+
+	ext, ok := sniff(p.coverArt, TypeImage)
+	if !ok {
+		return fmt.Errorf("unrecognized cover art format")
+	}
+	if err := os.MkdirAll(req.FramesDir, 0755); err != nil {
+		return err
+	}
+	framePath := filepath.Join(req.FramesDir, "cover"+ext)
+	if err := os.WriteFile(framePath, p.coverArt, 0644); err != nil {
+		return err
+	}
+	emit(Frame{Path: framePath, Time: -1})
+	return nil
+}
+
+// sampleOffsets 由stsc、stco和stsz计算每个样本在文件中的偏移
+func (t *track) sampleOffsets() []uint64 {
+	offsets := make([]uint64, 0, len(t.sampleSizes))
+	sample := 0
+	for i, entry := range t.sampleToChunk {
+		lastChunk := uint32(len(t.chunkOffsets))
+		if i+1 < len(t.sampleToChunk) {
+			lastChunk = t.sampleToChunk[i+1].firstChunk - 1
+		}
+		for chunk := entry.firstChunk; chunk >= 1 && chunk <= lastChunk && int(chunk) <= len(t.chunkOffsets); chunk++ {
+			offset := t.chunkOffsets[chunk-1]
+			for j := uint32(0); j < entry.samplesPerChunk && sample < len(t.sampleSizes); j++ {
+				offsets = append(offsets, offset)
+				offset += uint64(t.sampleSizes[sample])
+				sample++
+			}
+		}
+	}
+	return offsets
+}
+
+// sampleTimes 由stts计算每个样本的解码时间(秒)
+func (t *track) sampleTimes() []float64 {
+	if t.timescale == 0 {
+		return nil
+	}
+	var times []float64
+	var current uint64
+	for _, entry := range t.timeToSample {
+		for i := uint32(0); i < entry.count && len(times) < len(t.sampleSizes); i++ {
+			times = append(times, float64(current)/float64(t.timescale))
+			current += uint64(entry.delta)
+		}
+	}
+	return times
+}
@@ -0,0 +1,165 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// maxStreamFrameSize 是管道中单帧JPEG允许的最大体积
+const maxStreamFrameSize = 32 * 1024 * 1024
+
+// jpegScanner 把 ffmpeg image2pipe 输出的连续JPEG按SOI/EOI标记切分成单帧
+// 按标记段长度跳过头部,只在熵编码数据中查找EOI,避免把头部中的FFD9误判为结尾
+type jpegScanner struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+	// markerPending 表示熵编码数据后标记的FF前缀已经读出
+	markerPending bool
+}
+
+func newJPEGScanner(r io.Reader) *jpegScanner {
+	return &jpegScanner{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next 返回下一帧JPEG数据,流结束时返回io.EOF
+func (s *jpegScanner) Next() ([]byte, error) {
+	s.buf.Reset()
+	s.markerPending = false
+	if err := s.skipToSOI(); err != nil {
+		return nil, err
+	}
+	s.buf.Write([]byte{0xFF, 0xD8})
+
+	for {
+		marker, err := s.readMarker()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		switch {
+		case marker == 0xD9: // EOI
+			return s.frame(), nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// 没有长度字段的标记
+		default:
+			if err := s.copySegment(); err != nil {
+				return nil, err
+			}
+			if marker == 0xDA { // SOS之后是熵编码数据
+				done, err := s.copyEntropyData()
+				if err != nil {
+					return nil, err
+				}
+				if done {
+					return s.frame(), nil
+				}
+			}
+		}
+		if s.buf.Len() > maxStreamFrameSize {
+			return nil, fmt.Errorf("jpeg frame exceeds %d bytes", maxStreamFrameSize)
+		}
+	}
+}
+
+func (s *jpegScanner) frame() []byte {
+	return append([]byte(nil), s.buf.Bytes()...)
+}
+
+// skipToSOI 跳过帧之间的无关字节
+func (s *jpegScanner) skipToSOI() error {
+	prev := byte(0)
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prev == 0xFF && b == 0xD8 {
+			return nil
+		}
+		prev = b
+	}
+}
+
+// readMarker 读取FF开头的标记,跳过填充的FF
+func (s *jpegScanner) readMarker() (byte, error) {
+	b := byte(0xFF)
+	var err error
+	if !s.markerPending {
+		if b, err = s.r.ReadByte(); err != nil {
+			return 0, err
+		}
+		if b != 0xFF {
+			return 0, fmt.Errorf("invalid jpeg marker prefix %#x", b)
+		}
+	}
+	s.markerPending = false
+	for b == 0xFF {
+		if b, err = s.r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	s.buf.Write([]byte{0xFF, b})
+	return b, nil
+}
+
+// copySegment 按长度字段复制一个标记段
+func (s *jpegScanner) copySegment() error {
+	var length [2]byte
+	if _, err := io.ReadFull(s.r, length[:]); err != nil {
+		return unexpected(err)
+	}
+	n := int(length[0])<<8 | int(length[1])
+	if n < 2 {
+		return fmt.Errorf("invalid jpeg segment length %d", n)
+	}
+	s.buf.Write(length[:])
+	if _, err := io.CopyN(&s.buf, s.r, int64(n-2)); err != nil {
+		return unexpected(err)
+	}
+	return nil
+}
+
+// copyEntropyData 复制熵编码数据,遇到EOI返回true,遇到其它标记(如渐进式JPEG的下一个扫描)时退回标记并返回false
+func (s *jpegScanner) copyEntropyData() (bool, error) {
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return false, unexpected(err)
+		}
+		if b != 0xFF {
+			s.buf.WriteByte(b)
+			continue
+		}
+		next, err := s.r.Peek(1)
+		if err != nil {
+			return false, unexpected(err)
+		}
+		switch {
+		case next[0] == 0x00 || (next[0] >= 0xD0 && next[0] <= 0xD7):
+			// 字节填充或RST标记,仍属于熵编码数据
+			s.buf.WriteByte(b)
+			s.buf.WriteByte(next[0])
+			s.r.ReadByte()
+		case next[0] == 0xFF:
+			// 填充字节
+		case next[0] == 0xD9:
+			s.r.ReadByte()
+			s.buf.Write([]byte{0xFF, 0xD9})
+			return true, nil
+		default:
+			s.markerPending = true
+			return false, nil
+		}
+		if s.buf.Len() > maxStreamFrameSize {
+			return false, fmt.Errorf("jpeg frame exceeds %d bytes", maxStreamFrameSize)
+		}
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,725 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// VideoInfo 是从MP4/MOV容器中解析出的视频信息
+type VideoInfo struct {
+	// Duration 是视频时长(秒)
+	Duration float64
+	Width    int
+	Height   int
+	// Codecs 是各轨道stsd中的编码格式,如 avc1、hvc1、mp4a
+	Codecs      []string
+	Tracks      int
+	VideoTracks int
+	AudioTracks int
+	// Fragmented 表示这是分片MP4(moov中含有mvex)
+	Fragmented bool
+	// HasCoverArt 表示容器中带有封面图片
+	HasCoverArt bool
+}
+
+// track 是单个轨道的信息
+type track struct {
+	id         uint32
+	handler    string
+	codec      string
+	timescale  uint32
+	duration   uint64 // mdhd中的时长,单位为timescale
+	fragDur    uint64 // moof/trun中累加的时长,单位为timescale
+	defaultDur uint32 // trex中的默认样本时长
+	width      int
+	height     int
+	tkhdWidth  int
+	tkhdHeight int
+
+	// avcC 是H.264样本描述中的解码器配置
+	avcC []byte
+
+	// 样本表,用于不经ffmpeg直接取出帧
+	sampleSizes   []uint32
+	chunkOffsets  []uint64
+	sampleToChunk []stscEntry
+	timeToSample  []sttsEntry
+	// syncSamples 是stss中的关键帧序号(从1开始),没有stss时为nil,表示所有样本都是关键帧
+	syncSamples []uint32
+}
+
+type stscEntry struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+type sttsEntry struct {
+	count uint32
+	delta uint32
+}
+
+// mp4Parser 遍历ISO-BMFF box并收集视频信息
+type mp4Parser struct {
+	r    io.ReaderAt
+	size int64
+
+	movieTimescale uint32
+	movieDuration  uint64
+	fragmentDur    uint64 // mehd中的总时长,单位为movieTimescale
+	hasMehd        bool
+	fragmented     bool
+	foundMoov      bool
+	tracks         []*track
+	// coverArt 是udta/meta/ilst/covr中的封面图片
+	coverArt []byte
+}
+
+const (
+	// maxMoovSize 是moov box允许的最大体积,超过时视为损坏的文件
+	maxMoovSize = 32 * 1024 * 1024
+	// maxMoofSize 是单个moof box允许的最大体积
+	maxMoofSize = 4 * 1024 * 1024
+	// unknownDuration32 是mvhd v0中表示时长未知的值
+	unknownDuration32 = 0xFFFFFFFF
+	// maxSamples 是stsz中允许的最大样本数
+	maxSamples = 1 << 22
+)
+
+var errNoMoov = errors.New("moov box not found")
+
+// ProbeFile 解析本地MP4/MOV文件
+func ProbeFile(path string) (*VideoInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Probe(file, stat.Size())
+}
+
+// Probe 解析MP4/MOV容器,只读取moov、moof等元数据box,跳过mdat
+func Probe(r io.ReaderAt, size int64) (*VideoInfo, error) {
+	p, err := parseMP4(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return p.info(), nil
+}
+
+func parseMP4(r io.ReaderAt, size int64) (*mp4Parser, error) {
+	p := &mp4Parser{r: r, size: size}
+	if err := p.walkTopLevel(); err != nil {
+		return nil, err
+	}
+	if !p.foundMoov {
+		return nil, errNoMoov
+	}
+	return p, nil
+}
+
+// walkTopLevel 遍历顶层box,moov在文件末尾时跳过mdat直接读取
+func (p *mp4Parser) walkTopLevel() error {
+	var offset int64
+	for offset+8 <= p.size {
+		typ, headerSize, boxSize, err := p.readHeader(offset)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case "moov":
+			payload, err := p.readPayload(offset, headerSize, boxSize, maxMoovSize)
+			if err != nil {
+				return err
+			}
+			if err := p.parseMoov(payload); err != nil {
+				return err
+			}
+			p.foundMoov = true
+			// 普通MP4或带有mehd总时长的分片MP4,不需要再遍历moof
+			if !p.fragmented || p.hasMehd {
+				return nil
+			}
+		case "moof":
+			payload, err := p.readPayload(offset, headerSize, boxSize, maxMoofSize)
+			if err != nil {
+				return err
+			}
+			if err := p.parseMoof(payload); err != nil {
+				return err
+			}
+		}
+
+		if boxSize == 0 {
+			// size为0表示该box延伸到文件末尾
+			return nil
+		}
+		offset += boxSize
+	}
+	return nil
+}
+
+// readHeader 读取offset处的box头,返回类型、头部长度和整个box的长度(0表示到文件末尾)
+func (p *mp4Parser) readHeader(offset int64) (string, int64, int64, error) {
+	var buf [16]byte
+	n := int64(len(buf))
+	if offset+n > p.size {
+		n = p.size - offset
+	}
+	if _, err := p.r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+		return "", 0, 0, fmt.Errorf("failed to read box header at %d: %v", offset, err)
+	}
+
+	size := int64(binary.BigEndian.Uint32(buf[0:4]))
+	typ := string(buf[4:8])
+	headerSize := int64(8)
+	switch size {
+	case 0:
+		return typ, headerSize, 0, nil
+	case 1:
+		// 64位largesize
+		if n < 16 {
+			return "", 0, 0, fmt.Errorf("truncated largesize header for %q at %d", typ, offset)
+		}
+		size = int64(binary.BigEndian.Uint64(buf[8:16]))
+		headerSize = 16
+	}
+	if size < headerSize {
+		return "", 0, 0, fmt.Errorf("invalid size %d for box %q at %d", size, typ, offset)
+	}
+	return typ, headerSize, size, nil
+}
+
+// readPayload 读取box内容(不含头部)
+func (p *mp4Parser) readPayload(offset, headerSize, boxSize, limit int64) ([]byte, error) {
+	if boxSize == 0 {
+		boxSize = p.size - offset
+	}
+	length := boxSize - headerSize
+	if length > limit {
+		return nil, fmt.Errorf("box at %d is too large (%d bytes)", offset, length)
+	}
+	if offset+boxSize > p.size {
+		return nil, fmt.Errorf("box at %d exceeds file size %d", offset, p.size)
+	}
+	payload := make([]byte, length)
+	if _, err := p.r.ReadAt(payload, offset+headerSize); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read box at %d: %v", offset, err)
+	}
+	return payload, nil
+}
+
+// walkBoxes 遍历内存中的子box
+func walkBoxes(data []byte, fn func(typ string, payload []byte) error) error {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("truncated largesize header for %q", typ)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return fmt.Errorf("invalid size %d for box %q", size, typ)
+		}
+		if err := fn(typ, data[headerSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func (p *mp4Parser) parseMoov(data []byte) error {
+	var mvex []byte
+	err := walkBoxes(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			return p.parseMvhd(payload)
+		case "trak":
+			t := &track{}
+			if err := parseTrak(t, payload); err != nil {
+				return err
+			}
+			p.tracks = append(p.tracks, t)
+		case "mvex":
+			mvex = payload
+		case "udta":
+			p.coverArt = findCoverArt(payload)
+		}
+		return nil
+	})
+	if err != nil || mvex == nil {
+		return err
+	}
+	// trex按轨道ID引用trak,在所有trak解析完之后再处理
+	p.fragmented = true
+	return p.parseMvex(mvex)
+}
+
+// parseMvhd 解析mvhd,v0为32位时长,v1为64位时长
+func (p *mp4Parser) parseMvhd(data []byte) error {
+	timescale, duration, err := parseTimes(data, "mvhd")
+	if err != nil {
+		return err
+	}
+	p.movieTimescale = timescale
+	p.movieDuration = duration
+	return nil
+}
+
+// parseTimes 解析mvhd/mdhd共有的 creation_time、modification_time、timescale、duration 字段
+func parseTimes(data []byte, name string) (uint32, uint64, error) {
+	if len(data) < 4 {
+		return 0, 0, fmt.Errorf("%s box too short", name)
+	}
+	switch data[0] {
+	case 0:
+		if len(data) < 20 {
+			return 0, 0, fmt.Errorf("%s v0 box too short", name)
+		}
+		duration := uint64(binary.BigEndian.Uint32(data[16:20]))
+		if duration == unknownDuration32 {
+			duration = 0
+		}
+		return binary.BigEndian.Uint32(data[12:16]), duration, nil
+	case 1:
+		if len(data) < 32 {
+			return 0, 0, fmt.Errorf("%s v1 box too short", name)
+		}
+		duration := binary.BigEndian.Uint64(data[24:32])
+		if duration == ^uint64(0) {
+			duration = 0
+		}
+		return binary.BigEndian.Uint32(data[20:24]), duration, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported %s version %d", name, data[0])
+}
+
+func parseTrak(t *track, data []byte) error {
+	return walkBoxes(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "tkhd":
+			return parseTkhd(t, payload)
+		case "mdia":
+			return parseMdia(t, payload)
+		}
+		return nil
+	})
+}
+
+// parseTkhd 解析轨道ID和显示宽高(16.16定点数)
+func parseTkhd(t *track, data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("tkhd box too short")
+	}
+	var idOffset, sizeOffset int
+	switch data[0] {
+	case 0:
+		idOffset, sizeOffset = 12, 76
+	case 1:
+		idOffset, sizeOffset = 20, 88
+	default:
+		return fmt.Errorf("unsupported tkhd version %d", data[0])
+	}
+	if len(data) < sizeOffset+8 {
+		return fmt.Errorf("tkhd box too short")
+	}
+	t.id = binary.BigEndian.Uint32(data[idOffset : idOffset+4])
+	t.tkhdWidth = int(binary.BigEndian.Uint32(data[sizeOffset:sizeOffset+4]) >> 16)
+	t.tkhdHeight = int(binary.BigEndian.Uint32(data[sizeOffset+4:sizeOffset+8]) >> 16)
+	return nil
+}
+
+func parseMdia(t *track, data []byte) error {
+	return walkBoxes(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "mdhd":
+			timescale, duration, err := parseTimes(payload, "mdhd")
+			if err != nil {
+				return err
+			}
+			t.timescale = timescale
+			t.duration = duration
+		case "hdlr":
+			if len(payload) >= 12 {
+				t.handler = string(payload[8:12])
+			}
+		case "minf":
+			return walkBoxes(payload, func(typ string, payload []byte) error {
+				if typ != "stbl" {
+					return nil
+				}
+				return walkBoxes(payload, func(typ string, payload []byte) error {
+					switch typ {
+					case "stsd":
+						parseStsd(t, payload)
+					case "stsz":
+						t.sampleSizes = parseStsz(payload)
+					case "stco":
+						t.chunkOffsets = parseChunkOffsets(payload, 4)
+					case "co64":
+						t.chunkOffsets = parseChunkOffsets(payload, 8)
+					case "stsc":
+						t.sampleToChunk = parseStsc(payload)
+					case "stts":
+						t.timeToSample = parseStts(payload)
+					case "stss":
+						t.syncSamples = parseStss(payload)
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+}
+
+// parseStsd 取第一个样本描述的类型作为编码格式,视频样本描述中还带有编码宽高
+func parseStsd(t *track, data []byte) {
+	if len(data) < 8 || binary.BigEndian.Uint32(data[4:8]) == 0 {
+		return
+	}
+	entries := data[8:]
+	if len(entries) < 8 {
+		return
+	}
+	t.codec = strings.TrimRight(string(entries[4:8]), "\x00 ")
+	// VisualSampleEntry: SampleEntry(8) + pre_defined/reserved(16) + width(2) + height(2)
+	entrySize := binary.BigEndian.Uint32(entries[0:4])
+	if len(entries) >= 8+28 && entrySize >= 8+28 {
+		t.width = int(binary.BigEndian.Uint16(entries[8+24 : 8+26]))
+		t.height = int(binary.BigEndian.Uint16(entries[8+26 : 8+28]))
+	}
+	// VisualSampleEntry共78字节,之后是avcC等子box
+	if (t.codec == "avc1" || t.codec == "avc3") && entrySize >= 8+78 && uint64(len(entries)) >= uint64(entrySize) {
+		walkBoxes(entries[8+78:entrySize], func(typ string, payload []byte) error {
+			if typ == "avcC" {
+				t.avcC = payload
+			}
+			return nil
+		})
+	}
+}
+
+// parseStss 解析关键帧序号
+func parseStss(data []byte) []uint32 {
+	if len(data) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(data[4:8])
+	if uint64(len(data)-8) < uint64(count)*4 {
+		return nil
+	}
+	samples := make([]uint32, count)
+	for i := range samples {
+		samples[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+	return samples
+}
+
+// parseStsz 解析每个样本的大小,所有样本大小相同时展开为列表
+func parseStsz(data []byte) []uint32 {
+	if len(data) < 12 {
+		return nil
+	}
+	uniform := binary.BigEndian.Uint32(data[4:8])
+	count := binary.BigEndian.Uint32(data[8:12])
+	if uniform != 0 {
+		if count > maxSamples {
+			return nil
+		}
+		sizes := make([]uint32, count)
+		for i := range sizes {
+			sizes[i] = uniform
+		}
+		return sizes
+	}
+	if uint64(len(data)-12) < uint64(count)*4 {
+		return nil
+	}
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		sizes[i] = binary.BigEndian.Uint32(data[12+i*4:])
+	}
+	return sizes
+}
+
+// parseChunkOffsets 解析stco(32位)或co64(64位)中的chunk偏移
+func parseChunkOffsets(data []byte, width int) []uint64 {
+	if len(data) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(data[4:8])
+	if uint64(len(data)-8) < uint64(count)*uint64(width) {
+		return nil
+	}
+	offsets := make([]uint64, count)
+	for i := range offsets {
+		start := 8 + i*width
+		if width == 8 {
+			offsets[i] = binary.BigEndian.Uint64(data[start:])
+		} else {
+			offsets[i] = uint64(binary.BigEndian.Uint32(data[start:]))
+		}
+	}
+	return offsets
+}
+
+func parseStsc(data []byte) []stscEntry {
+	if len(data) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(data[4:8])
+	if uint64(len(data)-8) < uint64(count)*12 {
+		return nil
+	}
+	entries := make([]stscEntry, count)
+	for i := range entries {
+		start := 8 + i*12
+		entries[i] = stscEntry{
+			firstChunk:      binary.BigEndian.Uint32(data[start:]),
+			samplesPerChunk: binary.BigEndian.Uint32(data[start+4:]),
+		}
+	}
+	return entries
+}
+
+func parseStts(data []byte) []sttsEntry {
+	if len(data) < 8 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(data[4:8])
+	if uint64(len(data)-8) < uint64(count)*8 {
+		return nil
+	}
+	entries := make([]sttsEntry, count)
+	for i := range entries {
+		start := 8 + i*8
+		entries[i] = sttsEntry{
+			count: binary.BigEndian.Uint32(data[start:]),
+			delta: binary.BigEndian.Uint32(data[start+4:]),
+		}
+	}
+	return entries
+}
+
+// findCoverArt 查找 udta/meta/ilst/covr/data 中的封面图片
+func findCoverArt(udta []byte) []byte {
+	var cover []byte
+	walkBoxes(udta, func(typ string, payload []byte) error {
+		if typ != "meta" || cover != nil {
+			return nil
+		}
+		// MP4中的meta是FullBox,QuickTime中不是;FullBox的版本和标志为0,而子box的长度至少为8
+		if len(payload) >= 4 && binary.BigEndian.Uint32(payload[0:4]) == 0 {
+			payload = payload[4:]
+		}
+		walkBoxes(payload, func(typ string, payload []byte) error {
+			if typ != "ilst" {
+				return nil
+			}
+			return walkBoxes(payload, func(typ string, payload []byte) error {
+				if typ != "covr" {
+					return nil
+				}
+				return walkBoxes(payload, func(typ string, payload []byte) error {
+					// data box: type(4) + locale(4) + 图片数据
+					if typ == "data" && len(payload) > 8 && cover == nil {
+						cover = payload[8:]
+					}
+					return nil
+				})
+			})
+		})
+		return nil
+	})
+	return cover
+}
+
+// parseMvex 解析分片MP4的总时长(mehd)和各轨道的默认样本时长(trex)
+func (p *mp4Parser) parseMvex(data []byte) error {
+	return walkBoxes(data, func(typ string, payload []byte) error {
+		switch typ {
+		case "mehd":
+			if len(payload) < 4 {
+				return fmt.Errorf("mehd box too short")
+			}
+			if payload[0] == 1 && len(payload) >= 12 {
+				p.fragmentDur = binary.BigEndian.Uint64(payload[4:12])
+			} else if len(payload) >= 8 {
+				p.fragmentDur = uint64(binary.BigEndian.Uint32(payload[4:8]))
+			}
+			p.hasMehd = p.fragmentDur > 0
+		case "trex":
+			if len(payload) < 16 {
+				return fmt.Errorf("trex box too short")
+			}
+			if t := p.trackByID(binary.BigEndian.Uint32(payload[4:8])); t != nil {
+				t.defaultDur = binary.BigEndian.Uint32(payload[12:16])
+			}
+		}
+		return nil
+	})
+}
+
+func (p *mp4Parser) trackByID(id uint32) *track {
+	for _, t := range p.tracks {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// parseMoof 累加每个traf中trun的样本时长
+func (p *mp4Parser) parseMoof(data []byte) error {
+	return walkBoxes(data, func(typ string, payload []byte) error {
+		if typ != "traf" {
+			return nil
+		}
+		var t *track
+		var defaultDur uint32
+		return walkBoxes(payload, func(typ string, payload []byte) error {
+			switch typ {
+			case "tfhd":
+				if len(payload) < 8 {
+					return fmt.Errorf("tfhd box too short")
+				}
+				t = p.trackByID(binary.BigEndian.Uint32(payload[4:8]))
+				if t != nil {
+					defaultDur = t.defaultDur
+				}
+				flags := binary.BigEndian.Uint32(payload[0:4]) & 0xFFFFFF
+				offset := 8
+				if flags&0x01 != 0 { // base-data-offset
+					offset += 8
+				}
+				if flags&0x02 != 0 { // sample-description-index
+					offset += 4
+				}
+				if flags&0x08 != 0 { // default-sample-duration
+					if len(payload) < offset+4 {
+						return fmt.Errorf("tfhd box too short")
+					}
+					defaultDur = binary.BigEndian.Uint32(payload[offset : offset+4])
+				}
+			case "trun":
+				if t == nil {
+					return nil
+				}
+				duration, err := parseTrun(payload, defaultDur)
+				if err != nil {
+					return err
+				}
+				t.fragDur += duration
+			}
+			return nil
+		})
+	})
+}
+
+// parseTrun 返回trun中所有样本的时长之和
+func parseTrun(data []byte, defaultDur uint32) (uint64, error) {
+	if len(data) < 8 {
+		return 0, fmt.Errorf("trun box too short")
+	}
+	flags := binary.BigEndian.Uint32(data[0:4]) & 0xFFFFFF
+	count := binary.BigEndian.Uint32(data[4:8])
+	offset := 8
+	if flags&0x01 != 0 { // data-offset
+		offset += 4
+	}
+	if flags&0x04 != 0 { // first-sample-flags
+		offset += 4
+	}
+	if offset > len(data) {
+		return 0, fmt.Errorf("trun box too short for its header fields")
+	}
+	if flags&0x100 == 0 {
+		return uint64(count) * uint64(defaultDur), nil
+	}
+
+	sampleSize := 4
+	for _, bit := range []uint32{0x200, 0x400, 0x800} {
+		if flags&bit != 0 {
+			sampleSize += 4
+		}
+	}
+	if uint64(len(data)-offset) < uint64(count)*uint64(sampleSize) {
+		return 0, fmt.Errorf("trun box too short for %d samples", count)
+	}
+	var total uint64
+	for i := uint32(0); i < count; i++ {
+		if offset+4 > len(data) {
+			return 0, fmt.Errorf("trun box too short for %d samples", count)
+		}
+		total += uint64(binary.BigEndian.Uint32(data[offset : offset+4]))
+		offset += sampleSize
+	}
+	return total, nil
+}
+
+// info 汇总时长、分辨率、编码和轨道数
+func (p *mp4Parser) info() *VideoInfo {
+	info := &VideoInfo{Tracks: len(p.tracks), Fragmented: p.fragmented, HasCoverArt: len(p.coverArt) > 0}
+
+	var trackDuration float64
+	for _, t := range p.tracks {
+		switch t.handler {
+		case "vide":
+			info.VideoTracks++
+			if info.Width == 0 {
+				info.Width, info.Height = t.tkhdWidth, t.tkhdHeight
+				if info.Width == 0 {
+					info.Width, info.Height = t.width, t.height
+				}
+			}
+		case "soun":
+			info.AudioTracks++
+		}
+		if t.codec != "" && !containsCodec(info.Codecs, t.codec) {
+			info.Codecs = append(info.Codecs, t.codec)
+		}
+		if t.timescale > 0 {
+			if d := float64(t.duration+t.fragDur) / float64(t.timescale); d > trackDuration {
+				trackDuration = d
+			}
+		}
+	}
+
+	switch {
+	case p.hasMehd && p.movieTimescale > 0:
+		info.Duration = float64(p.fragmentDur) / float64(p.movieTimescale)
+	case !p.fragmented && p.movieDuration > 0 && p.movieTimescale > 0:
+		info.Duration = float64(p.movieDuration) / float64(p.movieTimescale)
+	default:
+		// 分片MP4没有mehd,或mvhd中时长缺失时,取最长轨道的时长
+		info.Duration = trackDuration
+	}
+	return info
+}
+
+func containsCodec(list []string, codec string) bool {
+	for _, item := range list {
+		if item == codec {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/h264"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden 比较输出与testdata中的golden文件,-update时改为重写golden文件
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// jpegSamples 生成n帧不同灰度的JPEG样本
+func jpegSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = corpus.JPEG(imaging.New(64, 48, color.Gray{uint8(i * 20)}))
+	}
+	return samples
+}
+
+func probeCases() []struct {
+	name string
+	data []byte
+} {
+	avc := corpus.MP4{Timescale: 1000, SampleDelta: 40, Samples: make([][]byte, 250), Codec: "avc1", Width: 1280, Height: 720}
+	for i := range avc.Samples {
+		avc.Samples[i] = []byte{0, 0, 0, 1}
+	}
+	with := func(m corpus.MP4, edit func(*corpus.MP4)) []byte {
+		edit(&m)
+		return m.Bytes()
+	}
+	// corrupt 把第一个typ box的版本和标志改为flags,box长度不变
+	corrupt := func(data []byte, typ string, flags uint32) []byte {
+		data = append([]byte(nil), data...)
+		i := bytes.Index(data, []byte(typ)) + 4
+		binary.BigEndian.PutUint32(data[i:i+4], flags)
+		return data
+	}
+	fragmented := with(avc, func(m *corpus.MP4) { m.Fragments = 5 })
+	noMoov := []byte("\x00\x00\x00\x10ftypisom\x00\x00\x02\x00\x00\x00\x00\x0cmdat\x00\x00\x00\x00")
+	full := avc.Bytes()
+
+	return []struct {
+		name string
+		data []byte
+	}{
+		{"faststart", full},
+		{"moov_at_end", with(avc, func(m *corpus.MP4) { m.MoovAtEnd = true })},
+		{"version1", with(avc, func(m *corpus.MP4) { m.Version1 = true })},
+		{"largesize_mdat", with(avc, func(m *corpus.MP4) { m.LargeMdat = true; m.MoovAtEnd = true })},
+		{"unknown_movie_duration", with(avc, func(m *corpus.MP4) { m.UnknownDuration = true })},
+		{"with_audio", with(avc, func(m *corpus.MP4) { m.Audio = true })},
+		{"fragmented_mehd", with(avc, func(m *corpus.MP4) { m.Fragments = 5; m.Mehd = true })},
+		{"fragmented_no_mehd", with(avc, func(m *corpus.MP4) { m.Fragments = 5 })},
+		{"mjpeg_cover", corpus.MP4{Timescale: 600, SampleDelta: 300, Samples: jpegSamples(6), Codec: "jpeg", Width: 64, Height: 48, Co64: true, Cover: jpegSamples(1)[0]}.Bytes()},
+		{"no_moov", noMoov},
+		{"truncated_moov", full[:200]},
+		// 标志声明了data-offset等可选字段,但box中只有样本数
+		{"short_trun_header", corrupt(fragmented, "trun", 0x000105)},
+		// 标志声明了每个样本的时长,但box中没有样本表
+		{"short_trun_samples", corrupt(fragmented, "trun", 0x000100)},
+		{"short_tfhd", corrupt(fragmented, "tfhd", 0x00000B)},
+	}
+}
+
+func TestProbeGolden(t *testing.T) {
+	var out bytes.Buffer
+	for _, c := range probeCases() {
+		info, err := Probe(bytes.NewReader(c.data), int64(len(c.data)))
+		if err != nil {
+			fmt.Fprintf(&out, "%s: error: %v\n", c.name, err)
+			continue
+		}
+		data, _ := json.Marshal(info)
+		fmt.Fprintf(&out, "%s: %s\n", c.name, data)
+	}
+	checkGolden(t, "probe.golden", out.Bytes())
+}
+
+// FuzzProbe 检查任意输入都不会使解析崩溃
+func FuzzProbe(f *testing.F) {
+	for _, c := range probeCases() {
+		f.Add(c.data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if p, err := parseMP4(bytes.NewReader(data), int64(len(data))); err == nil {
+			p.info()
+			for _, tr := range p.tracks {
+				tr.sampleOffsets()
+				tr.sampleTimes()
+			}
+		}
+	})
+}
+
+// TestSampleTables 检查由样本表计算出的偏移确实指向每一帧JPEG
+func TestSampleTables(t *testing.T) {
+	samples := jpegSamples(5)
+	for _, co64 := range []bool{false, true} {
+		data := corpus.MP4{Timescale: 1000, SampleDelta: 500, Samples: samples, Codec: "jpeg", Width: 64, Height: 48, Co64: co64, MoovAtEnd: co64}.Bytes()
+		p, err := parseMP4(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := p.tracks[0]
+		offsets, times := tr.sampleOffsets(), tr.sampleTimes()
+		if len(offsets) != len(samples) || len(times) != len(samples) {
+			t.Fatalf("co64=%v: got %d offsets and %d times, want %d", co64, len(offsets), len(times), len(samples))
+		}
+		for i, sample := range samples {
+			if got := data[offsets[i] : offsets[i]+uint64(len(sample))]; !bytes.Equal(got, sample) {
+				t.Errorf("co64=%v: sample %d at offset %d does not match", co64, i, offsets[i])
+			}
+			if want := float64(i) * 0.5; times[i] != want {
+				t.Errorf("co64=%v: sample %d time %v, want %v", co64, i, times[i], want)
+			}
+		}
+	}
+}
+
+// TestH264Source 检查内置解码器只解码stss中的关键帧,跳过损坏的关键帧,并得到原始像素
+func TestH264Source(t *testing.T) {
+	var w corpus.BitWriter
+	w.UE(0) // first_mb_in_slice
+	w.UE(5) // slice_type P
+	pFrame := corpus.AVCSample(corpus.NAL(0x41, w.Trailing()))
+
+	var samples [][]byte
+	var sync []uint32
+	var config []byte
+	var images []*image.Gray
+	for i := 0; i < 4; i++ {
+		img := image.NewGray(image.Rect(0, 0, 40, 24))
+		for j := range img.Pix {
+			img.Pix[j] = uint8(i*50 + j%40)
+		}
+		var sample []byte
+		config, sample = corpus.H264(img)
+		if i == 2 {
+			sample = sample[:len(sample)/2] // 截断的关键帧
+		}
+		images = append(images, img)
+		sync = append(sync, uint32(len(samples)+1))
+		samples = append(samples, sample, pFrame, pFrame)
+	}
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 500, Samples: samples, Codec: "avc1", Width: 40, Height: 24,
+		AVCC: config, SyncSamples: sync}.Bytes()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "h264.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ProbeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(h264Source{}).Supports(info) {
+		t.Fatalf("h264 source does not support codecs %v", info.Codecs)
+	}
+
+	req := FrameRequest{VideoPath: path, FramesDir: filepath.Join(dir, "frames"), Info: info,
+		Sampling: Sampling{Strategy: SamplingFPS, FPS: 1, MaxFrames: 10}}
+	var frames []Frame
+	if err := (h264Source{}).Extract(context.Background(), req, func(f Frame) bool {
+		frames = append(frames, f)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	wantTimes := []float64{0, 1.5, 4.5}
+	wantImages := []*image.Gray{images[0], images[1], images[3]}
+	if len(frames) != len(wantTimes) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(wantTimes))
+	}
+	for i, f := range frames {
+		if f.Time != wantTimes[i] {
+			t.Errorf("frame %d time %v, want %v", i, f.Time, wantTimes[i])
+		}
+		img, err := imaging.Open(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gray, ok := img.(*image.Gray)
+		if !ok || !bytes.Equal(gray.Pix, wantImages[i].Pix) {
+			t.Errorf("frame %d does not match the encoded key frame", i)
+		}
+	}
+}
+
+// TestDecodeH264Recovers 检查解码器panic时只返回该帧的错误
+func TestDecodeH264Recovers(t *testing.T) {
+	var decoder *h264.Decoder
+	if _, err := decodeH264(decoder, []byte{0, 0, 0, 1, 0x65}); err == nil {
+		t.Error("decodeH264 with a panicking decoder returned no error")
+	}
+}
+
+// TestFetchVideoInfoSkipsMdat 检查moov位于文件末尾时只通过少量Range请求读取元数据
+func TestFetchVideoInfoSkipsMdat(t *testing.T) {
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = make([]byte, 20*1024)
+	}
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 100, Samples: samples, Codec: "avc1", Width: 640, Height: 360, MoovAtEnd: true}.Bytes()
+
+	var requests, served atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		counter := &countingWriter{ResponseWriter: w, n: &served}
+		http.ServeContent(counter, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	info, err := FetchVideoInfo(server.URL + "/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration != 10 || info.Width != 640 || info.Height != 360 {
+		t.Errorf("got %+v, want 10s 640x360", info)
+	}
+	if served.Load() >= int64(len(data))/2 {
+		t.Errorf("served %d of %d bytes, mdat should have been skipped", served.Load(), len(data))
+	}
+	t.Logf("%d requests, %d of %d bytes", requests.Load(), served.Load(), len(data))
+}
+
+// TestFetchSameURLConcurrently 检查同一URL的并发下载各自写入不同的文件
+func TestFetchSameURLConcurrently(t *testing.T) {
+	// 视频下载到当前目录下的video/
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 500, Samples: jpegSamples(4), Codec: "jpeg", Width: 64, Height: 48}.Bytes()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	paths := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, err := Fetch(server.URL+"/video.mp4", TypeVideo)
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			t.Errorf("two downloads share %s", path)
+		}
+		seen[path] = true
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s does not hold the downloaded video (%v)", path, err)
+		}
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
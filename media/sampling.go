@@ -0,0 +1,140 @@
+package media
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+)
+
+// 抽帧策略
+const (
+	// SamplingFPS 按固定帧率抽帧
+	SamplingFPS = "fps"
+	// SamplingScene 只抽取画面发生明显变化的帧(以及第一帧)
+	SamplingScene = "scene"
+	// SamplingEdges 只抽取开头和结尾几秒,广告二维码通常出现在这两处
+	SamplingEdges = "edges"
+	// SamplingCount 在整个视频中均匀抽取固定帧数
+	SamplingCount = "count"
+	// SamplingAdaptive 按视频长度自动选择,短视频抽得密,长视频均匀抽取
+	SamplingAdaptive = "adaptive"
+)
+
+// Sampling 描述如何从视频中抽帧
+type Sampling struct {
+	Strategy       string
+	FPS            float64
+	SceneThreshold float64
+	EdgeSeconds    float64
+	Count          int
+	// MaxFrames 是最多抽取的帧数
+	MaxFrames int
+}
+
+// SamplingFromConfig 按配置创建抽帧策略
+func SamplingFromConfig() Sampling {
+	return Sampling{
+		Strategy:       strings.ToLower(config.GetFrameSampling()),
+		FPS:            config.GetFrameFPS(),
+		SceneThreshold: config.GetFrameSceneThreshold(),
+		EdgeSeconds:    config.GetFrameEdgeSeconds(),
+		Count:          config.GetFrameCount(),
+		MaxFrames:      config.GetFrameMax(),
+	}
+}
+
+// ValidSampling 报告抽帧策略名是否有效,无效的策略按fps处理
+func ValidSampling(strategy string) bool {
+	switch strings.ToLower(strategy) {
+	case SamplingFPS, SamplingScene, SamplingEdges, SamplingCount, SamplingAdaptive:
+		return true
+	}
+	return false
+}
+
+// resolve 按视频时长(秒,未知时为0)把adaptive换成具体策略,并处理缺少时长的情况
+func (s Sampling) resolve(duration float64) Sampling {
+	switch s.Strategy {
+	case SamplingFPS, SamplingScene:
+		return s
+	case SamplingEdges:
+		// 视频不比开头加结尾更长时,直接按帧率抽取整个视频
+		if duration > 0 && duration > 2*s.EdgeSeconds {
+			return s
+		}
+	case SamplingCount:
+		if duration > 0 {
+			return s
+		}
+	case SamplingAdaptive:
+		switch {
+		case duration <= 0:
+		case duration <= 10:
+			// 几秒钟的广告视频,每秒2帧
+			s.FPS = math.Max(s.FPS, 2)
+		case duration <= 60:
+		default:
+			s.Strategy = SamplingCount
+			s.Count = s.MaxFrames
+			return s
+		}
+	}
+	s.Strategy = SamplingFPS
+	return s
+}
+
+// interval 返回count策略相邻两帧的间隔(秒)
+func (s Sampling) interval(duration float64) float64 {
+	if s.Count <= 1 {
+		return duration
+	}
+	return duration / float64(s.Count)
+}
+
+// ffmpegFilter 返回ffmpeg的-vf参数,select表达式用prev_selected_t控制间隔,不会像fps滤镜那样在间隔中补帧
+func (s Sampling) ffmpegFilter(duration float64) string {
+	s = s.resolve(duration)
+	step := 1 / s.FPS
+	spaced := func(seconds float64) string {
+		return fmt.Sprintf("(isnan(prev_selected_t)+gte(t-prev_selected_t\\,%.3f))", seconds)
+	}
+	switch s.Strategy {
+	case SamplingScene:
+		return fmt.Sprintf("select='eq(n\\,0)+gt(scene\\,%.3f)'", s.SceneThreshold)
+	case SamplingEdges:
+		return fmt.Sprintf("select='(lt(t\\,%.3f)+gte(t\\,%.3f))*%s'", s.EdgeSeconds, duration-s.EdgeSeconds, spaced(step))
+	case SamplingCount:
+		return fmt.Sprintf("select='%s'", spaced(s.interval(duration)))
+	}
+	return fmt.Sprintf("fps=%g", s.FPS)
+}
+
+// pick 按样本时间(秒)选出要抽取的样本下标,供无需解码的内置帧来源使用
+// 内置来源无法计算画面变化,scene策略按fps处理
+func (s Sampling) pick(times []float64, duration float64) []int {
+	s = s.resolve(duration)
+	step := 1 / s.FPS
+	inRange := func(t float64) bool { return true }
+	switch s.Strategy {
+	case SamplingEdges:
+		inRange = func(t float64) bool { return t < s.EdgeSeconds || t >= duration-s.EdgeSeconds }
+	case SamplingCount:
+		step = s.interval(duration)
+	}
+
+	var picked []int
+	last := math.Inf(-1)
+	for i, t := range times {
+		if len(picked) >= s.MaxFrames {
+			break
+		}
+		if !inRange(t) || t-last < step-1e-6 {
+			continue
+		}
+		picked = append(picked, i)
+		last = t
+	}
+	return picked
+}
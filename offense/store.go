@@ -0,0 +1,111 @@
+// Package offense 持久化保存每个群中每个用户的违规次数,次数随时间衰减
+package offense
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/jsonfile"
+)
+
+// Record 是一个用户在一个群中的违规记录
+type Record struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// Store 按 群号:QQ号 保存违规记录
+type Store struct {
+	filePath string
+	records  map[string]Record
+	mu       sync.Mutex
+}
+
+var global = jsonfile.NewGlobal("offense.json", New)
+
+// GetInstance 返回全局违规记录,首次调用时从文件加载
+func GetInstance() *Store {
+	return global.Get()
+}
+
+// Open 从filePath重新加载全局违规记录,需要在处理事件之前调用
+func Open(filePath string) *Store {
+	return global.Open(filePath)
+}
+
+// New 从filePath加载违规记录,文件不存在时为空
+func New(filePath string) *Store {
+	s := &Store{filePath: filePath, records: map[string]Record{}}
+	found, err := jsonfile.Load(filePath, &s.records)
+	if err != nil {
+		log.Printf("Failed to load offense store: %v", err)
+		s.records = map[string]Record{}
+		return s
+	}
+	if !found {
+		return s
+	}
+	fmt.Printf("成功加载 %d 条违规记录\n", len(s.records))
+	return s
+}
+
+// save 保存违规记录,调用者需持有锁
+func (s *Store) save() error {
+	return jsonfile.Save(s.filePath, s.records)
+}
+
+func key(groupID, userID string) string {
+	return groupID + ":" + userID
+}
+
+// decayed 返回衰减后的次数,距上次违规每过一个decay周期减少一次,decay不大于0时不衰减
+func decayed(r Record, now time.Time, decay time.Duration) int {
+	if decay <= 0 {
+		return r.Count
+	}
+	count := r.Count - int(now.Sub(r.Last)/decay)
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+// Add 记录一次违规,返回包含本次在内的违规次数
+func (s *Store) Add(groupID, userID string, decay time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// 顺便清除已经衰减为0的记录
+	for k, r := range s.records {
+		if decayed(r, now, decay) == 0 {
+			delete(s.records, k)
+		}
+	}
+	k := key(groupID, userID)
+	count := decayed(s.records[k], now, decay) + 1
+	s.records[k] = Record{Count: count, Last: now}
+	return count, s.save()
+}
+
+// Peek 返回再违规一次时的次数,不记录
+func (s *Store) Peek(groupID, userID string, decay time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return decayed(s.records[key(groupID, userID)], time.Now(), decay) + 1
+}
+
+// Reset 清除用户在群中的违规记录,不存在时返回false
+func (s *Store) Reset(groupID, userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(groupID, userID)
+	if _, ok := s.records[k]; !ok {
+		return false, nil
+	}
+	delete(s.records, k)
+	return true, s.save()
+}
@@ -0,0 +1,53 @@
+package offense
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecayed(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		count int
+		ago   time.Duration
+		decay time.Duration
+		want  int
+	}{
+		{3, time.Hour, 24 * time.Hour, 3},
+		{3, 25 * time.Hour, 24 * time.Hour, 2},
+		{3, 49 * time.Hour, 24 * time.Hour, 1},
+		{3, 30 * 24 * time.Hour, 24 * time.Hour, 0},
+		{3, 30 * 24 * time.Hour, 0, 3},
+	}
+	for _, c := range cases {
+		if got := decayed(Record{Count: c.count, Last: now.Add(-c.ago)}, now, c.decay); got != c.want {
+			t.Errorf("decayed(%d, %v ago, decay %v) = %d, want %d", c.count, c.ago, c.decay, got, c.want)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offense.json")
+	s := New(path)
+	for want := 1; want <= 3; want++ {
+		if got, err := s.Add("100", "1", time.Hour); err != nil || got != want {
+			t.Fatalf("Add #%d = %d, %v", want, got, err)
+		}
+	}
+	if got, _ := s.Add("200", "1", time.Hour); got != 1 {
+		t.Errorf("offenses in another group = %d, want 1", got)
+	}
+
+	// 重新加载后次数保留
+	s = New(path)
+	if got := s.Peek("100", "1", time.Hour); got != 4 {
+		t.Errorf("Peek after reload = %d, want 4", got)
+	}
+	if ok, err := s.Reset("100", "1"); !ok || err != nil {
+		t.Errorf("Reset = %v, %v", ok, err)
+	}
+	if got := New(path).Peek("100", "1", time.Hour); got != 1 {
+		t.Errorf("Peek after Reset = %d, want 1", got)
+	}
+}
@@ -0,0 +1,59 @@
+package onebot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// HTTPCaller 通过onebot v11正向http api调用action
+type HTTPCaller struct {
+	BaseURL     string
+	AccessToken string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// CallAction 以POST json的方式调用action并解析响应
+func (h *HTTPCaller) CallAction(action string, params map[string]interface{}) (*structs.ActionResponse, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/%s", h.BaseURL, action))
+	if err != nil {
+		return nil, fmt.Errorf("URL parsing failed: %v", err)
+	}
+
+	// 添加access_token参数
+	if h.AccessToken != "" {
+		query := u.Query()
+		query.Set("access_token", h.AccessToken)
+		u.RawQuery = query.Encode()
+	}
+
+	requestBody, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	resp, err := httpClient.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send POST request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("action %s received non-OK response status: %s", action, resp.Status)
+	}
+
+	var result structs.ActionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response of action %s: %w", action, err)
+	}
+	if result.Retcode != 0 || result.Status == "failed" {
+		return &result, fmt.Errorf("action %s failed: status=%s retcode=%d message=%s", action, result.Status, result.Retcode, result.Message+result.Wording)
+	}
+	return &result, nil
+}
@@ -0,0 +1,48 @@
+package onebot
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// Call 是一次被记录下来的action调用
+type Call struct {
+	SelfID string                 `json:"self_id"`
+	Action string                 `json:"action"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// Recorder 只记录action调用而不发送,所有调用都返回成功,用于回放事件时查看会执行哪些动作
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Transport 返回以selfID身份记录调用的Transport,签名与GetTransport相同,可直接作为TransportResolver
+func (r *Recorder) Transport(selfID string) Transport {
+	return NewTransport(&recordingCaller{recorder: r, selfID: selfID})
+}
+
+// Take 返回目前记录的调用并清空记录
+func (r *Recorder) Take() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+type recordingCaller struct {
+	recorder *Recorder
+	selfID   string
+}
+
+func (c *recordingCaller) CallAction(action string, params map[string]interface{}) (*structs.ActionResponse, error) {
+	c.recorder.mu.Lock()
+	c.recorder.calls = append(c.recorder.calls, Call{SelfID: c.selfID, Action: action, Params: params})
+	c.recorder.mu.Unlock()
+	// 返回空对象,查询类action得到零值而不是解析错误
+	return &structs.ActionResponse{Status: "ok", Data: json.RawMessage("{}")}, nil
+}
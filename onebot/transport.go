@@ -0,0 +1,120 @@
+package onebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// Caller 负责把一个onebot action送达实现端并取回响应,ws和http各有一种实现
+type Caller interface {
+	CallAction(action string, params map[string]interface{}) (*structs.ActionResponse, error)
+}
+
+// Transport 是所有管理动作的统一入口,与机器人的连接方式无关
+type Transport interface {
+	Caller
+	DeleteMsg(messageID string) error
+	SendGroupMsg(groupID, userID, message string) error
+	SendPrivateMsg(userID, message string) error
+	SetGroupKick(groupID, userID string, rejectAddRequest bool) error
+	SetGroupBan(groupID, userID string, duration int) error
+	SetGroupWholeBan(groupID string, enable bool) error
+	GetGroupMemberInfo(groupID, userID string) (*structs.GroupMemberInfo, error)
+}
+
+// actions 在Caller之上实现Transport的各个具体动作
+type actions struct {
+	Caller
+}
+
+// NewTransport 用给定的Caller构造Transport
+func NewTransport(caller Caller) Transport {
+	return &actions{Caller: caller}
+}
+
+// DeleteMsg 撤回消息
+func (a *actions) DeleteMsg(messageID string) error {
+	_, err := a.CallAction("delete_msg", map[string]interface{}{
+		"message_id": toID(messageID),
+	})
+	return err
+}
+
+// SendGroupMsg 发送群消息,userID不为空时at触发者
+func (a *actions) SendGroupMsg(groupID, userID, message string) error {
+	if userID != "" {
+		message = "[CQ:at,qq=" + userID + "]" + message
+	}
+	_, err := a.CallAction("send_group_msg", map[string]interface{}{
+		"group_id": toID(groupID),
+		"message":  message,
+	})
+	return err
+}
+
+// SendPrivateMsg 发送私聊消息
+func (a *actions) SendPrivateMsg(userID, message string) error {
+	_, err := a.CallAction("send_private_msg", map[string]interface{}{
+		"user_id": toID(userID),
+		"message": message,
+	})
+	return err
+}
+
+// SetGroupKick 踢出群成员,rejectAddRequest为true时拒绝此人再次加群
+func (a *actions) SetGroupKick(groupID, userID string, rejectAddRequest bool) error {
+	_, err := a.CallAction("set_group_kick", map[string]interface{}{
+		"group_id":           toID(groupID),
+		"user_id":            toID(userID),
+		"reject_add_request": rejectAddRequest,
+	})
+	return err
+}
+
+// SetGroupBan 禁言群成员duration秒,duration为0时解除禁言
+func (a *actions) SetGroupBan(groupID, userID string, duration int) error {
+	_, err := a.CallAction("set_group_ban", map[string]interface{}{
+		"group_id": toID(groupID),
+		"user_id":  toID(userID),
+		"duration": duration,
+	})
+	return err
+}
+
+// SetGroupWholeBan 开启或解除全员禁言
+func (a *actions) SetGroupWholeBan(groupID string, enable bool) error {
+	_, err := a.CallAction("set_group_whole_ban", map[string]interface{}{
+		"group_id": toID(groupID),
+		"enable":   enable,
+	})
+	return err
+}
+
+// GetGroupMemberInfo 获取群成员信息
+func (a *actions) GetGroupMemberInfo(groupID, userID string) (*structs.GroupMemberInfo, error) {
+	resp, err := a.CallAction("get_group_member_info", map[string]interface{}{
+		"group_id": toID(groupID),
+		"user_id":  toID(userID),
+		"no_cache": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var info structs.GroupMemberInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal group member info: %v", err)
+	}
+	return &info, nil
+}
+
+// toID 尽量把数字字符串转为整数,部分onebot实现不接受字符串形式的id
+func toID(id string) interface{} {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return n
+	}
+	return id
+}
@@ -0,0 +1,67 @@
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// DHash 计算图像的64位差值哈希(dHash)
+// 图像缩放为9x8灰度图,逐行比较相邻像素的亮度,对缩放、压缩和轻微调色不敏感
+func DHash(img image.Image) uint64 {
+	small := imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Lanczos)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.NRGBAAt(x, y).R
+			right := small.NRGBAAt(x+1, y).R
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashFile 读取图片文件并计算dHash
+func HashFile(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	img, err := imaging.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return DHash(img), nil
+}
+
+// Distance 返回两个哈希之间的汉明距离
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format 把哈希格式化为16位十六进制字符串
+func Format(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Parse 解析16位十六进制哈希字符串
+func Parse(s string) (uint64, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("invalid hash %q: want 16 hex digits", s)
+	}
+	hash, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q: %v", s, err)
+	}
+	return hash, nil
+}
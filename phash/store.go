@@ -0,0 +1,133 @@
+package phash
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/jsonfile"
+)
+
+// Entry 是黑名单中的一条已知广告图哈希
+type Entry struct {
+	Hash    string    `json:"hash"`
+	Source  string    `json:"source"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Store 持久化保存已知广告图的感知哈希
+type Store struct {
+	filePath string
+	entries  []Entry
+	hashes   []uint64
+	mu       sync.RWMutex
+}
+
+var global = jsonfile.NewGlobal("phash.json", load)
+
+// GetInstance 返回全局哈希库,首次调用时从文件加载
+func GetInstance() *Store {
+	return global.Get()
+}
+
+// Open 从filePath重新加载全局哈希库,需要在处理事件之前调用
+func Open(filePath string) *Store {
+	return global.Open(filePath)
+}
+
+// load 从filePath加载哈希库,文件不存在时视为空库
+func load(filePath string) *Store {
+	s := &Store{filePath: filePath}
+	var entries []Entry
+	found, err := jsonfile.Load(filePath, &entries)
+	if err != nil {
+		log.Printf("Failed to load phash store: %v", err)
+		return s
+	}
+	if !found {
+		return s
+	}
+	for _, e := range entries {
+		hash, err := Parse(e.Hash)
+		if err != nil {
+			log.Printf("Skipping invalid phash entry: %v", err)
+			continue
+		}
+		s.entries = append(s.entries, e)
+		s.hashes = append(s.hashes, hash)
+	}
+	fmt.Printf("成功加载 %d 条已知广告图哈希\n", len(s.entries))
+	return s
+}
+
+// save 保存哈希库,调用者需持有写锁
+func (s *Store) save() error {
+	return jsonfile.Save(s.filePath, s.entries)
+}
+
+// Add 添加哈希,已存在时返回false
+func (s *Store) Add(hash uint64, source string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.hashes {
+		if h == hash {
+			return false, nil
+		}
+	}
+	s.entries = append(s.entries, Entry{Hash: Format(hash), Source: source, AddedAt: time.Now()})
+	s.hashes = append(s.hashes, hash)
+	return true, s.save()
+}
+
+// Remove 删除哈希,不存在时返回false
+func (s *Store) Remove(hash uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, h := range s.hashes {
+		if h == hash {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			s.hashes = append(s.hashes[:i], s.hashes[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// Match 查找与hash汉明距离不超过threshold的最接近条目
+func (s *Store) Match(hash uint64, threshold int) (Entry, int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := -1
+	bestDistance := threshold + 1
+	for i, h := range s.hashes {
+		if d := Distance(hash, h); d < bestDistance {
+			best = i
+			bestDistance = d
+		}
+	}
+	if best < 0 {
+		return Entry{}, 0, false
+	}
+	return s.entries[best], bestDistance, true
+}
+
+// List 返回所有条目的副本
+func (s *Store) List() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+// AddFile 计算图片文件的哈希并添加,返回计算出的哈希
+func (s *Store) AddFile(path, source string) (uint64, bool, error) {
+	hash, err := HashFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	added, err := s.Add(hash, source)
+	return hash, added, err
+}
@@ -0,0 +1,305 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/qrpolicy"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
+)
+
+// Decision 是单个检测器的结论
+type Decision int
+
+const (
+	// DecisionContinue 没有结论,交给下一个检测器
+	DecisionContinue Decision = iota
+	// DecisionPass 确认无问题,停止检测
+	DecisionPass
+	// DecisionHit 确认是广告,停止检测并执行处理
+	DecisionHit
+	// DecisionReview 疑似广告但置信度不足,停止检测,不撤回,配置了管理员时交给管理员复核
+	DecisionReview
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DecisionPass:
+		return "pass"
+	case DecisionHit:
+		return "hit"
+	case DecisionReview:
+		return "review"
+	}
+	return "continue"
+}
+
+// Verdict 是检测器给出的结论及原因
+type Verdict struct {
+	Decision Decision
+	Detector string
+	Reason   string
+	// Kick 为true时撤回后踢出发送者
+	Kick    bool
+	Details map[string]interface{}
+	// HitMedia 是命中的图片或视频帧文件,撤回成功后记录其感知哈希
+	HitMedia []string
+	// Punishment 是命中的规则指定的处罚,不为nil时代替违规阶梯和Kick
+	Punishment *Punishment
+}
+
+// Detector 对一类任务进行检测
+type Detector interface {
+	Name() string
+	Detect(job *Job) (Verdict, error)
+}
+
+// KeywordDetector 检查文本中是否包含撤回关键词
+type KeywordDetector struct{}
+
+func (KeywordDetector) Name() string { return "keyword" }
+
+func (d KeywordDetector) Detect(job *Job) (Verdict, error) {
+	for _, entry := range groupconfig.Get(job.GroupID).WithdrawWords {
+		word, action := config.SplitRuleAction(entry)
+		if word != "" && strings.Contains(job.RawMessage, word) {
+			return Verdict{
+				Decision:   DecisionHit,
+				Detector:   d.Name(),
+				Reason:     fmt.Sprintf("message contains withdraw word [%s]", word),
+				Kick:       groupconfig.Get(job.GroupID).SetGroupKick,
+				Punishment: rulePunishment(action),
+			}, nil
+		}
+	}
+	return Verdict{Decision: DecisionPass, Detector: d.Name()}, nil
+}
+
+// DurationDetector 检查视频长度是否低于video_second_limit
+// 开启check_video_qrcode时,短视频还需要二维码检测确认
+type DurationDetector struct{}
+
+func (DurationDetector) Name() string { return "duration" }
+
+func (d DurationDetector) Detect(job *Job) (Verdict, error) {
+	var info *media.VideoInfo
+	var err error
+	if job.URL == "" && job.LocalPath != "" {
+		// 离线扫描本地文件
+		info, err = media.ProbeFile(job.LocalPath)
+	} else {
+		info, err = media.FetchVideoInfo(job.URL)
+	}
+	if err != nil {
+		return Verdict{}, err
+	}
+	duration := info.Duration
+	fmt.Printf("检测到视频,长度 %f,分辨率 %dx%d,编码 %v\n", duration, info.Width, info.Height, info.Codecs)
+
+	details := map[string]interface{}{"duration": duration, "width": info.Width, "height": info.Height, "codecs": info.Codecs, "fragmented": info.Fragmented}
+	settings := groupconfig.Get(job.GroupID)
+	videoSecondLimit := settings.VideoSecondLimit
+	if duration >= float64(videoSecondLimit) {
+		return Verdict{Decision: DecisionPass, Detector: d.Name(), Details: details}, nil
+	}
+
+	reason := fmt.Sprintf("video duration %f is less than limit %d", duration, videoSecondLimit)
+	logger.LogEvent(fmt.Sprintf("%s, message_id %s for self_id %s", reason, job.MessageID, job.SelfID))
+	if settings.CheckVideoQRCode {
+		return Verdict{Decision: DecisionContinue, Detector: d.Name(), Reason: reason, Details: details}, nil
+	}
+	return Verdict{Decision: DecisionHit, Detector: d.Name(), Reason: reason, Kick: settings.SetGroupKick, Details: details}, nil
+}
+
+// VideoQRDetector 下载视频并逐帧检查二维码和已知广告图
+type VideoQRDetector struct{}
+
+func (VideoQRDetector) Name() string { return "video_qrcode" }
+
+func (d VideoQRDetector) Detect(job *Job) (Verdict, error) {
+	if job.LocalPath == "" {
+		videoPath, err := media.Fetch(job.URL, media.TypeVideo)
+		if err != nil {
+			return Verdict{}, err
+		}
+		logger.LogEvent(fmt.Sprintf("Video downloaded successfully for URL %s, saved to %s", job.URL, videoPath))
+		job.LocalPath = videoPath
+		job.downloaded = true
+	}
+
+	// accept 会被多个检测帧的goroutine并发调用
+	var decisionsMu sync.Mutex
+	var decisions []string
+	var punishment *Punishment
+	scan, err := utils.ScanVideoLimit(job.LocalPath, groupconfig.Get(job.GroupID).QRLimit, func(qr utils.QRResult) bool {
+		decision := qrpolicy.Evaluate(job.GroupID, qr.Text)
+		decisionsMu.Lock()
+		decisions = append(decisions, decision.Rule)
+		// 多个撤回规则指定了处罚时取最重的
+		if p := rulePunishment(decision.Action); !decision.Allow && p != nil && (punishment == nil || p.severity() > punishment.severity()) {
+			punishment = p
+		}
+		decisionsMu.Unlock()
+		return !decision.Allow
+	})
+	if errors.Is(err, media.ErrNoFrameSource) && config.GetWithdrawWithoutFrames() {
+		// 无法抽帧时退回到只按视频长度判断,能走到这里说明视频长度已低于限制
+		logger.LogEvent(fmt.Sprintf("no frame source for video, withdraw by duration url:%s: %v", job.URL, err))
+		return Verdict{
+			Decision: DecisionHit,
+			Detector: d.Name(),
+			Reason:   "short video cannot be decoded without ffmpeg, withdraw by duration",
+			Kick:     groupconfig.Get(job.GroupID).SetGroupKick,
+		}, nil
+	}
+	if err != nil {
+		return Verdict{}, err
+	}
+	if !scan.Hit && scan.Inconclusive {
+		if verdict, ok := d.inconclusive(job, scan, decisions); ok {
+			return verdict, nil
+		}
+	}
+	if !scan.Hit && scan.Review {
+		logger.LogEvent(fmt.Sprintf("video QRcode needs review score:%.2f url:%s", scan.Score, job.URL))
+		return Verdict{
+			Decision: DecisionReview,
+			Detector: d.Name(),
+			Reason:   fmt.Sprintf("video QR code score %.2f is below withdraw threshold", scan.Score),
+			Details:  map[string]interface{}{"qr_rules": decisions, "qr_score": scan.Score},
+			HitMedia: scan.ReviewFrames,
+		}, nil
+	}
+	if !scan.Hit {
+		fmt.Printf("video not contain QRcode pass.\n")
+		logger.LogEvent(fmt.Sprintf("video not contain QRcode pass score:%.2f url:%s", scan.Score, job.URL))
+		return Verdict{Decision: DecisionPass, Detector: d.Name(), Details: map[string]interface{}{"qr_rules": decisions, "qr_score": scan.Score}}, nil
+	}
+
+	if scan.KnownHash != "" {
+		logger.LogEvent(fmt.Sprintf("video frame matches known ad image %s url:%s", scan.KnownHash, job.URL))
+		return Verdict{
+			Decision: DecisionHit,
+			Detector: d.Name(),
+			Reason:   fmt.Sprintf("video frame matches known ad image %s", scan.KnownHash),
+			Kick:     groupconfig.Get(job.GroupID).SetGroupKick,
+		}, nil
+	}
+
+	fmt.Printf("video contain QRcode!!\n")
+	logger.LogEvent(fmt.Sprintf("video contain QRcode!! score:%.2f url:%s", scan.Score, job.URL))
+	return Verdict{
+		Decision:   DecisionHit,
+		Detector:   d.Name(),
+		Reason:     fmt.Sprintf("video contains %s (score %.2f)", strings.Join(scan.Formats, ","), scan.Score),
+		Kick:       groupconfig.Get(job.GroupID).SetGroupKick,
+		Details:    map[string]interface{}{"qr_texts": scan.Payloads, "qr_rules": decisions, "qr_formats": scan.Formats, "qr_score": scan.Score},
+		HitMedia:   scan.HitFrames,
+		Punishment: punishment,
+	}, nil
+}
+
+// inconclusive 按inconclusive_action处理超时未得出结论的视频,pass时返回false交给后续的正常判断
+func (d VideoQRDetector) inconclusive(job *Job, scan utils.VideoScanResult, decisions []string) (Verdict, bool) {
+	action := strings.ToLower(config.GetInconclusiveAction())
+	logger.LogEvent(fmt.Sprintf("video scan inconclusive, action %s score:%.2f url:%s", action, scan.Score, job.URL))
+	details := map[string]interface{}{"qr_rules": decisions, "qr_score": scan.Score, "inconclusive": true}
+	reason := fmt.Sprintf("video scan timed out after %ds without a verdict", config.GetVideoScanTimeout())
+	switch action {
+	case "withdraw":
+		return Verdict{Decision: DecisionHit, Detector: d.Name(), Reason: reason, Kick: groupconfig.Get(job.GroupID).SetGroupKick, Details: details}, true
+	case "review":
+		return Verdict{Decision: DecisionReview, Detector: d.Name(), Reason: reason, Details: details, HitMedia: scan.ReviewFrames}, true
+	}
+	return Verdict{}, false
+}
+
+// PHashDetector 检查图片是否与已知广告图相似,相似则无需识别二维码直接撤回
+type PHashDetector struct{}
+
+func (PHashDetector) Name() string { return "phash" }
+
+func (d PHashDetector) Detect(job *Job) (Verdict, error) {
+	if !config.GetPhashEnabled() {
+		return Verdict{Decision: DecisionContinue, Detector: d.Name()}, nil
+	}
+	if err := downloadImage(job); err != nil {
+		return Verdict{}, err
+	}
+
+	entry, ok := utils.MatchKnownHash(job.LocalPath)
+	if !ok {
+		return Verdict{Decision: DecisionContinue, Detector: d.Name()}, nil
+	}
+	return Verdict{
+		Decision: DecisionHit,
+		Detector: d.Name(),
+		Reason:   fmt.Sprintf("image matches known ad image %s", entry.Hash),
+		Details:  map[string]interface{}{"phash": entry.Hash},
+	}, nil
+}
+
+// ImageQRDetector 下载图片并检查二维码
+type ImageQRDetector struct{}
+
+func (ImageQRDetector) Name() string { return "image_qrcode" }
+
+func (d ImageQRDetector) Detect(job *Job) (Verdict, error) {
+	if err := downloadImage(job); err != nil {
+		return Verdict{}, err
+	}
+
+	qr := utils.ScanQRCode(job.LocalPath)
+	scoreDetails := map[string]interface{}{"qr_score": qr.Score, "qr_evidence": qr.Evidence}
+	if qr.Review {
+		fmt.Printf("Image %s score %.2f needs review.\n", qr.Format, qr.Score)
+		scoreDetails["qr_format"] = qr.Format
+		return Verdict{
+			Decision: DecisionReview,
+			Detector: d.Name(),
+			Reason:   fmt.Sprintf("image may contain %s (score %.2f)", qr.Format, qr.Score),
+			Details:  scoreDetails,
+			HitMedia: []string{job.LocalPath},
+		}, nil
+	}
+	if !qr.Found {
+		return Verdict{Decision: DecisionPass, Detector: d.Name(), Details: scoreDetails}, nil
+	}
+
+	decision := qrpolicy.Evaluate(job.GroupID, qr.Text)
+	details := map[string]interface{}{"qr_text": qr.Text, "qr_rule": decision.Rule, "qr_format": qr.Format, "qr_score": qr.Score, "qr_evidence": qr.Evidence}
+	if decision.Allow {
+		fmt.Printf("Image %s [%s] allowed by %s.\n", qr.Format, qr.Text, decision.Rule)
+		return Verdict{Decision: DecisionPass, Detector: d.Name(), Details: details}, nil
+	}
+
+	fmt.Printf("Image contains a %s.\n", qr.Format)
+	return Verdict{
+		Decision:   DecisionHit,
+		Detector:   d.Name(),
+		Reason:     fmt.Sprintf("image contains %s [%s] (%s, score %.2f)", qr.Format, qr.Text, decision.Rule, qr.Score),
+		Details:    details,
+		HitMedia:   []string{job.LocalPath},
+		Punishment: rulePunishment(decision.Action),
+	}, nil
+}
+
+// downloadImage 图片任务尚未下载时下载到本地
+func downloadImage(job *Job) error {
+	if job.LocalPath != "" {
+		return nil
+	}
+	imagePath, err := media.Fetch(job.URL, media.TypeImage)
+	if err != nil {
+		return err
+	}
+	job.LocalPath = imagePath
+	job.downloaded = true
+	return nil
+}
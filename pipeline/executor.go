@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/onebot"
+)
+
+// TransportResolver 按self_id返回对应机器人的Transport
+type TransportResolver func(selfID string) onebot.Transport
+
+// Executor 根据检测结论执行撤回、提示和踢人
+type Executor struct {
+	Resolve TransportResolver
+}
+
+// Execute 撤回消息并at提示发送者,命中的规则指定了处罚时按该处罚执行,配置了违规阶梯时按违规次数处罚,否则verdict.Kick为true时踢出发送者
+// 撤回失败时直接返回错误,提示和处罚失败只记录日志
+func (e *Executor) Execute(job *Job, verdict Verdict) error {
+	transport := e.Resolve(job.SelfID)
+	if err := transport.DeleteMsg(job.MessageID); err != nil {
+		return err
+	}
+
+	// 规则指定处罚时违规次数照常记录,之后的违规仍按阶梯升级
+	count, punishment, ladder := punish(job, true)
+	settings := groupconfig.Get(job.GroupID)
+	notice := settings.WithdrawNotice
+	switch {
+	case verdict.Punishment != nil:
+		punishment = *verdict.Punishment
+		notice += " " + punishment.String()
+	case ladder:
+		notice += fmt.Sprintf(" 第%d次违规,%s", count, punishment)
+	case verdict.Kick:
+		// 根据配置决定是否拒绝此人的加群请求
+		punishment = Punishment{Action: PunishKick}
+		if settings.KickAndRejectAddRequest {
+			punishment.Action = PunishKickReject
+		}
+	default:
+		punishment = Punishment{Action: PunishWarn}
+	}
+	if err := transport.SendGroupMsg(job.GroupID, job.UserID, notice); err != nil {
+		log.Printf("Failed to send withdraw notice: %v\n", err)
+	}
+
+	e.apply(transport, job, punishment)
+	return nil
+}
+
+// apply 执行处罚,警告只需要撤回提示,无需额外动作
+func (e *Executor) apply(transport onebot.Transport, job *Job, p Punishment) {
+	var err error
+	switch p.Action {
+	case PunishBan:
+		err = transport.SetGroupBan(job.GroupID, job.UserID, p.Minutes*60)
+	case PunishKick, PunishKickReject:
+		err = transport.SetGroupKick(job.GroupID, job.UserID, p.Action == PunishKickReject)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to %s group member: %v\n", p.Action, err)
+	}
+}
+
+// Report 影子模式下不执行动作,把本应执行的撤回/踢人发到shadow_report_group,未配置时不发送
+func (e *Executor) Report(job *Job, verdict Verdict) {
+	group := config.GetShadowReportGroup()
+	if group == "" {
+		return
+	}
+	action := "撤回"
+	if verdict.Punishment != nil {
+		action = fmt.Sprintf("撤回(%s)", *verdict.Punishment)
+	} else if count, punishment, ladder := punish(job, false); ladder {
+		action = fmt.Sprintf("撤回(第%d次违规,%s)", count, punishment)
+	} else if verdict.Kick {
+		action = "撤回并踢出"
+	}
+	message := fmt.Sprintf("[影子模式] 群%s 用户%s 的消息%s 将被%s\n%s: %s", job.GroupID, job.UserID, job.MessageID, action, verdict.Detector, verdict.Reason)
+	// 图片和视频只附链接,不在管理群里再发一次广告
+	if job.URL != "" {
+		message += fmt.Sprintf("\n%s链接: %s", job.Kind, job.URL)
+	} else if job.RawMessage != "" {
+		message += "\n原消息: " + job.RawMessage
+	}
+	if err := e.Resolve(job.SelfID).SendGroupMsg(group, "", message); err != nil {
+		log.Printf("Failed to send shadow report: %v\n", err)
+	}
+}
+
+// Notify 把消息发到review_group和review_users中的每个管理员
+func (e *Executor) Notify(selfID, message string) {
+	transport := e.Resolve(selfID)
+	if group := config.GetReviewGroup(); group != "" {
+		if err := transport.SendGroupMsg(group, "", message); err != nil {
+			log.Printf("Failed to send review message to group %s: %v\n", group, err)
+		}
+	}
+	for _, user := range config.GetReviewUsers() {
+		if err := transport.SendPrivateMsg(user, message); err != nil {
+			log.Printf("Failed to send review message to user %s: %v\n", user, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
+)
+
+// Kind 表示任务所检测的内容类型
+type Kind string
+
+const (
+	KindText  Kind = "text"
+	KindImage Kind = "image"
+	KindVideo Kind = "video"
+)
+
+// Job 是一次待检测的内容,由群消息事件或http请求生成
+type Job struct {
+	Kind       Kind
+	SelfID     string
+	GroupID    string
+	UserID     string
+	MessageID  string
+	RawMessage string
+	// URL 是图片或视频的下载地址,文本任务为空
+	URL string
+	// LocalPath 是下载到本地的文件路径,由检测器按需填充
+	LocalPath string
+	// downloaded 表示LocalPath是检测器下载的临时文件,任务结束后删除
+	downloaded bool
+}
+
+var (
+	videoURLRegex = regexp.MustCompile(`\[CQ:video,file=.+?,url=(.+?)\]`)
+	imageURLRegex = regexp.MustCompile(`\[CQ:image,file=.+?,url=(.+?)\]`)
+)
+
+// JobsFromEvent 把群消息事件拆分为文本、视频、图片任务
+func JobsFromEvent(event structs.MessageEvent) []*Job {
+	base := Job{
+		SelfID:     fmt.Sprint(event.SelfID),
+		GroupID:    fmt.Sprint(event.GroupID),
+		UserID:     fmt.Sprint(event.UserID),
+		MessageID:  fmt.Sprint(event.MessageID),
+		RawMessage: event.RawMessage,
+	}
+
+	text := base
+	text.Kind = KindText
+	jobs := []*Job{&text}
+
+	for _, match := range videoURLRegex.FindAllStringSubmatch(event.RawMessage, -1) {
+		video := base
+		video.Kind = KindVideo
+		video.URL = unescapeURL(match[1])
+		jobs = append(jobs, &video)
+	}
+	for _, match := range imageURLRegex.FindAllStringSubmatch(event.RawMessage, -1) {
+		image := base
+		image.Kind = KindImage
+		image.URL = unescapeURL(match[1])
+		jobs = append(jobs, &image)
+	}
+	return jobs
+}
+
+// cleanup 删除检测器下载的文件和视频的帧目录,离线扫描传入的本地文件不删除
+func (j *Job) cleanup() {
+	if !j.downloaded {
+		return
+	}
+	if err := os.Remove(j.LocalPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove downloaded %s: %v", j.Kind, err)
+	}
+	if j.Kind == KindVideo {
+		if err := os.RemoveAll(utils.FramesDir(j.LocalPath)); err != nil {
+			log.Printf("Failed to remove frames directory: %v", err)
+		}
+	}
+}
+
+// unescapeURL 还原CQ码中被转义的&
+func unescapeURL(u string) string {
+	u = strings.Replace(u, "\\u0026amp;", "&", -1)
+	return strings.Replace(u, "&amp;", "&", -1)
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/onebot"
+)
+
+// maxMuteMinutes 是onebot禁言的最长时间(30天)
+const maxMuteMinutes = 30 * 24 * 60
+
+var (
+	muteMu sync.Mutex
+	// 全员禁言自动解除的定时器,按群号保存,手动解除时取消
+	wholeBanTimers = map[string]*time.Timer{}
+	// 每个群最近撤回的时间,用于判断刷屏
+	raidHits = map[string][]time.Time{}
+)
+
+// transport 返回全局Pipeline使用的Transport
+func transport(selfID string) (onebot.Transport, error) {
+	mu.Lock()
+	p := instance
+	mu.Unlock()
+	if p == nil {
+		return nil, fmt.Errorf("pipeline not initialized")
+	}
+	return p.executor.Resolve(selfID), nil
+}
+
+// Mute 禁言群成员minutes分钟,minutes为0时解除禁言
+func Mute(selfID, groupID, userID string, minutes int) error {
+	if minutes < 0 || minutes > maxMuteMinutes {
+		return fmt.Errorf("minutes must be between 0 and %d", maxMuteMinutes)
+	}
+	t, err := transport(selfID)
+	if err != nil {
+		return err
+	}
+	return t.SetGroupBan(groupID, userID, minutes*60)
+}
+
+// MuteAll 开启全员禁言,minutes大于0时到期自动解除,为0时直到手动解除
+func MuteAll(selfID, groupID string, minutes int) error {
+	if minutes < 0 || minutes > maxMuteMinutes {
+		return fmt.Errorf("minutes must be between 0 and %d", maxMuteMinutes)
+	}
+	t, err := transport(selfID)
+	if err != nil {
+		return err
+	}
+	if err := t.SetGroupWholeBan(groupID, true); err != nil {
+		return err
+	}
+
+	muteMu.Lock()
+	defer muteMu.Unlock()
+	if timer, ok := wholeBanTimers[groupID]; ok {
+		timer.Stop()
+		delete(wholeBanTimers, groupID)
+	}
+	if minutes > 0 {
+		wholeBanTimers[groupID] = time.AfterFunc(time.Duration(minutes)*time.Minute, func() {
+			muteMu.Lock()
+			delete(wholeBanTimers, groupID)
+			muteMu.Unlock()
+			if err := t.SetGroupWholeBan(groupID, false); err != nil {
+				log.Printf("Failed to lift whole group ban of %s: %v\n", groupID, err)
+			}
+		})
+	}
+	return nil
+}
+
+// UnmuteAll 解除全员禁言,并取消自动解除的定时器
+func UnmuteAll(selfID, groupID string) error {
+	t, err := transport(selfID)
+	if err != nil {
+		return err
+	}
+	muteMu.Lock()
+	if timer, ok := wholeBanTimers[groupID]; ok {
+		timer.Stop()
+		delete(wholeBanTimers, groupID)
+	}
+	muteMu.Unlock()
+	return t.SetGroupWholeBan(groupID, false)
+}
+
+// checkRaid 记录一次撤回,raid_window_seconds内撤回达到raid_threshold条时开启全员禁言
+// 已经处于自动解除的全员禁言中时不重复开启
+func checkRaid(job *Job) {
+	threshold := config.GetRaidThreshold()
+	if threshold <= 0 || job.GroupID == "" {
+		return
+	}
+	now := time.Now()
+	window := time.Duration(config.GetRaidWindowSeconds()) * time.Second
+
+	muteMu.Lock()
+	hits := raidHits[job.GroupID][:0]
+	for _, t := range raidHits[job.GroupID] {
+		if now.Sub(t) < window {
+			hits = append(hits, t)
+		}
+	}
+	hits = append(hits, now)
+	_, muted := wholeBanTimers[job.GroupID]
+	raid := len(hits) >= threshold && !muted
+	if raid {
+		delete(raidHits, job.GroupID)
+	} else {
+		raidHits[job.GroupID] = hits
+	}
+	muteMu.Unlock()
+	if !raid {
+		return
+	}
+
+	minutes := config.GetRaidMuteMinutes()
+	if err := MuteAll(job.SelfID, job.GroupID, minutes); err != nil {
+		logger.LogEvent(fmt.Sprintf("bot [%s] failed to mute group_id:%s during raid: %v", job.SelfID, job.GroupID, err))
+		return
+	}
+	logger.LogEvent(fmt.Sprintf("bot [%s] raid detected in group_id:%s, %d withdraws within %v, whole group muted for %d minutes", job.SelfID, job.GroupID, len(hits), window, minutes))
+	if t, err := transport(job.SelfID); err == nil {
+		if err := t.SendGroupMsg(job.GroupID, "", fmt.Sprintf("短时间内出现大量广告,已开启全员禁言%d分钟", minutes)); err != nil {
+			log.Printf("Failed to send raid notice: %v\n", err)
+		}
+	}
+}
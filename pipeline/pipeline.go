@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/phash"
+)
+
+// Result 是一个任务经过检测和处理后的结果
+type Result struct {
+	Verdict Verdict
+	// Actioned 表示已经执行了撤回
+	Actioned bool
+	// Shadow 表示检测命中,但群处于影子模式,只记录不撤回
+	Shadow bool
+	// Details 汇总了所有检测器给出的附加信息,例如视频时长
+	Details map[string]interface{}
+	Err     error
+}
+
+// Pipeline 把任务按类型路由到检测器链,并把结论交给Executor
+type Pipeline struct {
+	routes   map[Kind][]Detector
+	executor *Executor
+}
+
+var (
+	instance *Pipeline
+	pool     *Pool
+	mu       sync.Mutex
+)
+
+// New 创建带默认检测器链的Pipeline
+func New(resolve TransportResolver) *Pipeline {
+	return &Pipeline{
+		routes: map[Kind][]Detector{
+			KindText:  {KeywordDetector{}},
+			KindImage: {PHashDetector{}, ImageQRDetector{}},
+			KindVideo: {DurationDetector{}, VideoQRDetector{}},
+		},
+		executor: &Executor{Resolve: resolve},
+	}
+}
+
+// Init 创建全局Pipeline和工作池,需要在处理任何事件之前调用
+func Init(resolve TransportResolver) *Pipeline {
+	mu.Lock()
+	defer mu.Unlock()
+	instance = New(resolve)
+	pool = NewPool(instance)
+	return instance
+}
+
+// Submit 把任务交给全局工作池异步处理,队列满且策略为丢弃新任务时返回ErrQueueFull
+func Submit(job *Job, done func(Result)) error {
+	mu.Lock()
+	p := pool
+	mu.Unlock()
+	if p == nil {
+		return fmt.Errorf("pipeline not initialized")
+	}
+	return p.Submit(job, done)
+}
+
+// ProcessQueued 经由工作池处理任务并等待结果
+func ProcessQueued(job *Job) Result {
+	ch := make(chan Result, 1)
+	if err := Submit(job, func(result Result) { ch <- result }); err != nil {
+		return Result{Err: err}
+	}
+	return <-ch
+}
+
+// Stats 返回全局工作池的队列指标
+func Stats() []QueueStats {
+	mu.Lock()
+	p := pool
+	mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.Stats()
+}
+
+// Process 使用全局Pipeline处理任务
+func Process(job *Job) Result {
+	mu.Lock()
+	p := instance
+	mu.Unlock()
+	if p == nil {
+		return Result{Err: fmt.Errorf("pipeline not initialized")}
+	}
+	return p.Process(job)
+}
+
+// Evaluate 依次运行任务类型对应的检测器并返回结论,不执行撤回,供离线扫描使用
+func (p *Pipeline) Evaluate(job *Job) Result {
+	result := Result{Details: map[string]interface{}{}}
+
+	for _, detector := range p.routes[job.Kind] {
+		verdict, err := detector.Detect(job)
+		if err != nil {
+			result.Err = fmt.Errorf("%s detector failed: %w", detector.Name(), err)
+			return result
+		}
+		for k, v := range verdict.Details {
+			result.Details[k] = v
+		}
+		result.Verdict = verdict
+
+		if verdict.Decision == DecisionContinue {
+			continue
+		}
+		break
+	}
+	return result
+}
+
+// Process 依次运行任务类型对应的检测器,命中时执行处理,结束后删除下载的文件
+func (p *Pipeline) Process(job *Job) Result {
+	defer job.cleanup()
+	result := p.Evaluate(job)
+	if result.Err != nil {
+		return result
+	}
+
+	if result.Verdict.Decision == DecisionReview {
+		logger.LogEvent(fmt.Sprintf("bot [%s] review needed for group_id:%s user_id:%s message_id:%s by %s: %s", job.SelfID, job.GroupID, job.UserID, job.MessageID, result.Verdict.Detector, result.Verdict.Reason))
+		// 影子模式不会撤回,无需复核
+		if reviewEnabled() && !groupconfig.Get(job.GroupID).ShadowMode {
+			item, err := p.queueReview(job, result.Verdict)
+			if err != nil {
+				log.Printf("Failed to queue review: %v", err)
+			} else {
+				result.Details["review_id"] = item.ID
+			}
+		}
+		return result
+	}
+	if result.Verdict.Decision != DecisionHit {
+		return result
+	}
+
+	if groupconfig.Get(job.GroupID).ShadowMode {
+		result.Shadow = true
+		logger.LogEvent(fmt.Sprintf("bot [%s] shadow hit in group_id:%s user_id:%s message_id:%s by %s: %s kick[%v] messgae[%s]", job.SelfID, job.GroupID, job.UserID, job.MessageID, result.Verdict.Detector, result.Verdict.Reason, result.Verdict.Kick, job.RawMessage))
+		p.executor.Report(job, result.Verdict)
+		return result
+	}
+
+	if err := p.executor.Execute(job, result.Verdict); err != nil {
+		logger.LogEvent(fmt.Sprintf("bot [%s] failed to withdraw from group_id:%s user_id:%s message_id:%s: %v", job.SelfID, job.GroupID, job.UserID, job.MessageID, err))
+		result.Err = err
+		return result
+	}
+	result.Actioned = true
+	recordHashes(job, result.Verdict)
+	checkRaid(job)
+	logger.LogEvent(fmt.Sprintf("bot [%s] withdraw from group_id:%s user_id:%s message_id:%s by %s: %s messgae[%s]", job.SelfID, job.GroupID, job.UserID, job.MessageID, result.Verdict.Detector, result.Verdict.Reason, job.RawMessage))
+	return result
+}
+
+// recordHashes 把已撤回的图片或视频帧加入已知广告图黑名单
+func recordHashes(job *Job, verdict Verdict) {
+	if !config.GetPhashEnabled() {
+		return
+	}
+	for _, path := range verdict.HitMedia {
+		hash, err := phash.HashFile(path)
+		if err != nil {
+			log.Printf("Failed to hash withdrawn media: %v", err)
+			continue
+		}
+		source := fmt.Sprintf("%s group_id:%s user_id:%s message_id:%s", verdict.Detector, job.GroupID, job.UserID, job.MessageID)
+		if _, err := phash.GetInstance().Add(hash, source); err != nil {
+			log.Printf("Failed to save phash store: %v", err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+)
+
+// 队列满时的处理策略
+const (
+	// PolicyDropNewest 丢弃新提交的任务
+	PolicyDropNewest = "drop_newest"
+	// PolicyDropOldest 丢弃队列中最早的任务,为新任务腾出位置
+	PolicyDropOldest = "drop_oldest"
+	// PolicyBlock 阻塞提交方,直到队列有空位
+	PolicyBlock = "block"
+)
+
+// ErrQueueFull 表示任务因队列已满被丢弃
+var ErrQueueFull = errors.New("job queue is full")
+
+type queueItem struct {
+	job  *Job
+	done func(Result)
+}
+
+// queue 是某一类媒体任务的有界队列及其工作协程
+type queue struct {
+	kind    Kind
+	items   chan queueItem
+	policy  string
+	workers int
+
+	busy      atomic.Int64
+	enqueued  atomic.Int64
+	processed atomic.Int64
+	dropped   atomic.Int64
+}
+
+// QueueStats 是队列的运行指标
+type QueueStats struct {
+	Kind      Kind   `json:"kind"`
+	Depth     int    `json:"depth"`
+	Capacity  int    `json:"capacity"`
+	Workers   int    `json:"workers"`
+	Busy      int64  `json:"busy"`
+	Enqueued  int64  `json:"enqueued"`
+	Processed int64  `json:"processed"`
+	Dropped   int64  `json:"dropped"`
+	Policy    string `json:"policy"`
+}
+
+// Pool 为图片和视频分别维护有界队列,避免慢任务阻塞其它消息和无限制地启动ffmpeg
+type Pool struct {
+	pipeline *Pipeline
+	queues   map[Kind]*queue
+}
+
+// NewPool 按配置创建队列并启动工作协程
+func NewPool(p *Pipeline) *Pool {
+	policy := config.GetQueueFullPolicy()
+	pool := &Pool{
+		pipeline: p,
+		queues: map[Kind]*queue{
+			KindVideo: newQueue(KindVideo, config.GetVideoWorkers(), config.GetVideoQueueSize(), policy),
+			KindImage: newQueue(KindImage, config.GetImageWorkers(), config.GetImageQueueSize(), policy),
+		},
+	}
+	for _, q := range pool.queues {
+		for i := 0; i < q.workers; i++ {
+			go pool.work(q)
+		}
+	}
+	return pool
+}
+
+func newQueue(kind Kind, workers, size int, policy string) *queue {
+	return &queue{
+		kind:    kind,
+		items:   make(chan queueItem, size),
+		policy:  policy,
+		workers: workers,
+	}
+}
+
+func (pool *Pool) work(q *queue) {
+	for item := range q.items {
+		q.busy.Add(1)
+		result := pool.process(item.job)
+		q.busy.Add(-1)
+		q.processed.Add(1)
+		if item.done != nil {
+			item.done(result)
+		}
+	}
+}
+
+// process 处理一个任务,损坏的媒体文件导致的panic只让该任务失败,不影响工作协程
+func (pool *Pool) process(job *Job) (result Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.LogEvent(fmt.Sprintf("%s job panicked message_id:%s group_id:%s: %v\n%s", job.Kind, job.MessageID, job.GroupID, r, debug.Stack()))
+			result = Result{Err: fmt.Errorf("%s job panicked: %v", job.Kind, r)}
+		}
+	}()
+	return pool.pipeline.Process(job)
+}
+
+// Submit 把任务放入对应类型的队列,done在任务处理完或被丢弃时调用
+// 没有队列的任务类型(例如文本)直接在当前协程处理
+func (pool *Pool) Submit(job *Job, done func(Result)) error {
+	q, ok := pool.queues[job.Kind]
+	if !ok {
+		result := pool.pipeline.Process(job)
+		if done != nil {
+			done(result)
+		}
+		return nil
+	}
+
+	item := queueItem{job: job, done: done}
+	switch q.policy {
+	case PolicyBlock:
+		q.items <- item
+	case PolicyDropOldest:
+		for {
+			select {
+			case q.items <- item:
+				q.enqueued.Add(1)
+				return nil
+			default:
+			}
+			// 队列已满,丢弃最早的任务后重试
+			select {
+			case oldest := <-q.items:
+				q.drop(oldest)
+			default:
+			}
+		}
+	default:
+		select {
+		case q.items <- item:
+		default:
+			q.drop(item)
+			return ErrQueueFull
+		}
+	}
+	q.enqueued.Add(1)
+	return nil
+}
+
+func (q *queue) drop(item queueItem) {
+	q.dropped.Add(1)
+	logger.LogEvent(fmt.Sprintf("%s queue full, dropped job message_id:%s group_id:%s", q.kind, item.job.MessageID, item.job.GroupID))
+	if item.done != nil {
+		item.done(Result{Err: ErrQueueFull})
+	}
+}
+
+// Stats 返回所有队列的指标
+func (pool *Pool) Stats() []QueueStats {
+	stats := make([]QueueStats, 0, len(pool.queues))
+	for _, kind := range []Kind{KindVideo, KindImage} {
+		q := pool.queues[kind]
+		stats = append(stats, QueueStats{
+			Kind:      q.kind,
+			Depth:     len(q.items),
+			Capacity:  cap(q.items),
+			Workers:   q.workers,
+			Busy:      q.busy.Load(),
+			Enqueued:  q.enqueued.Load(),
+			Processed: q.processed.Load(),
+			Dropped:   q.dropped.Load(),
+			Policy:    q.policy,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
+)
+
+type panicDetector struct{}
+
+func (panicDetector) Name() string { return "panic" }
+
+func (panicDetector) Detect(job *Job) (Verdict, error) {
+	var data []byte
+	_ = data[len(job.URL)]
+	return Verdict{}, nil
+}
+
+// TestPoolRecoversPanic 检查检测器panic时任务失败,工作协程继续处理后续任务
+func TestPoolRecoversPanic(t *testing.T) {
+	// 事件日志写在当前目录下
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	p := &Pipeline{routes: map[Kind][]Detector{KindImage: {panicDetector{}}}, executor: &Executor{}}
+	q := newQueue(KindImage, 1, 2, PolicyBlock)
+	pool := &Pool{pipeline: p, queues: map[Kind]*queue{KindImage: q}}
+	go pool.work(q)
+
+	for i := 0; i < 2; i++ {
+		results := make(chan Result, 1)
+		if err := pool.Submit(&Job{Kind: KindImage, URL: "bad.mp4"}, func(r Result) { results <- r }); err != nil {
+			t.Fatal(err)
+		}
+		if r := <-results; r.Err == nil {
+			t.Errorf("job %d: got no error from a panicking detector", i)
+		}
+	}
+	close(q.items)
+}
+
+// fetchDetector 模拟下载视频并抽帧
+type fetchDetector struct{ dir string }
+
+func (fetchDetector) Name() string { return "fetch" }
+
+func (d fetchDetector) Detect(job *Job) (Verdict, error) {
+	if job.LocalPath == "" {
+		job.LocalPath = filepath.Join(d.dir, "video.mp4")
+		job.downloaded = true
+	}
+	if err := os.WriteFile(job.LocalPath, []byte("video"), 0644); err != nil {
+		return Verdict{}, err
+	}
+	if err := os.MkdirAll(utils.FramesDir(job.LocalPath), 0755); err != nil {
+		return Verdict{}, err
+	}
+	return Verdict{Decision: DecisionPass, Detector: "fetch"}, nil
+}
+
+// TestProcessRemovesDownloads 检查任务结束后删除下载的视频和帧目录,离线扫描的本地文件保留
+func TestProcessRemovesDownloads(t *testing.T) {
+	dir := t.TempDir()
+	p := &Pipeline{routes: map[Kind][]Detector{KindVideo: {fetchDetector{dir: dir}}}, executor: &Executor{}}
+
+	job := &Job{Kind: KindVideo, URL: "http://example.com/video.mp4"}
+	if r := p.Process(job); r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	for _, path := range []string{job.LocalPath, utils.FramesDir(job.LocalPath)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", path, err)
+		}
+	}
+
+	local := &Job{Kind: KindVideo, LocalPath: filepath.Join(dir, "local.mp4")}
+	if r := p.Process(local); r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if _, err := os.Stat(local.LocalPath); err != nil {
+		t.Errorf("local file was removed: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/offense"
+)
+
+// 违规阶梯中的处罚方式
+const (
+	PunishWarn       = "warn"
+	PunishBan        = "ban"
+	PunishKick       = "kick"
+	PunishKickReject = "kick_reject"
+)
+
+// Punishment 是违规阶梯中的一级处罚
+type Punishment struct {
+	Action string
+	// Minutes 是禁言的分钟数,仅ban使用
+	Minutes int
+}
+
+func (p Punishment) String() string {
+	switch p.Action {
+	case PunishBan:
+		return fmt.Sprintf("禁言%d分钟", p.Minutes)
+	case PunishKick:
+		return "踢出"
+	case PunishKickReject:
+		return "踢出并拒绝再次加群"
+	}
+	return "警告"
+}
+
+// ParsePunishment 解析 warn, ban:分钟, kick, kick_reject
+func ParsePunishment(step string) (Punishment, error) {
+	action, arg, hasArg := strings.Cut(strings.ToLower(strings.TrimSpace(step)), ":")
+	switch action {
+	case PunishWarn, PunishKick, PunishKickReject:
+		if hasArg {
+			return Punishment{}, fmt.Errorf("%s takes no argument", action)
+		}
+		return Punishment{Action: action}, nil
+	case PunishBan:
+		minutes, err := strconv.Atoi(arg)
+		if err != nil || minutes <= 0 {
+			return Punishment{}, fmt.Errorf("ban needs a positive number of minutes, e.g. ban:10")
+		}
+		// onebot禁言最长30天
+		if minutes > 30*24*60 {
+			minutes = 30 * 24 * 60
+		}
+		return Punishment{Action: PunishBan, Minutes: minutes}, nil
+	}
+	return Punishment{}, fmt.Errorf("unknown punishment %q", step)
+}
+
+// CheckPunishLadder 检查违规阶梯配置,返回无法识别的项,这些项按警告处理
+func CheckPunishLadder() []string {
+	var invalid []string
+	for _, step := range config.GetPunishLadder() {
+		if _, err := ParsePunishment(step); err != nil {
+			invalid = append(invalid, step)
+		}
+	}
+	if len(invalid) > 0 {
+		fmt.Printf("以下违规处罚无法识别,将按警告处理: %v (支持: warn, ban:分钟, kick, kick_reject)\n", invalid)
+	}
+	return invalid
+}
+
+// rulePunishment 解析撤回规则指定的处罚,未指定或无法识别时返回nil,按违规阶梯或踢人设置处理
+func rulePunishment(action string) *Punishment {
+	if action == "" {
+		return nil
+	}
+	p, err := ParsePunishment(action)
+	if err != nil {
+		log.Printf("Invalid rule punishment %q: %v", action, err)
+		return nil
+	}
+	return &p
+}
+
+// severity 返回处罚的轻重,用于多条规则同时命中时选出最重的处罚
+func (p Punishment) severity() int {
+	switch p.Action {
+	case PunishBan:
+		return p.Minutes
+	case PunishKick:
+		return 1 << 30
+	case PunishKickReject:
+		return 1<<30 + 1
+	}
+	return 0
+}
+
+// punishmentFor 返回第count次违规的处罚,超出阶梯时使用最后一级,未配置阶梯时返回false
+func punishmentFor(count int) (Punishment, bool) {
+	ladder := config.GetPunishLadder()
+	if len(ladder) == 0 {
+		return Punishment{}, false
+	}
+	if count > len(ladder) {
+		count = len(ladder)
+	}
+	p, err := ParsePunishment(ladder[count-1])
+	if err != nil {
+		return Punishment{Action: PunishWarn}, true
+	}
+	return p, true
+}
+
+// punish 记录一次违规并返回违规次数和对应的处罚,record为false时只计算不记录
+func punish(job *Job, record bool) (int, Punishment, bool) {
+	if len(config.GetPunishLadder()) == 0 {
+		return 0, Punishment{}, false
+	}
+	decay := time.Duration(config.GetPunishDecayHours()) * time.Hour
+	store := offense.GetInstance()
+	count := store.Peek(job.GroupID, job.UserID, decay)
+	if record {
+		var err error
+		if count, err = store.Add(job.GroupID, job.UserID, decay); err != nil {
+			log.Printf("Failed to save offense store: %v", err)
+		}
+	}
+	p, ok := punishmentFor(count)
+	return count, p, ok
+}
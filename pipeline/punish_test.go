@@ -0,0 +1,44 @@
+package pipeline
+
+import "testing"
+
+func TestParsePunishment(t *testing.T) {
+	cases := []struct {
+		step    string
+		want    Punishment
+		wantErr bool
+	}{
+		{"warn", Punishment{Action: PunishWarn}, false},
+		{" Ban:10 ", Punishment{Action: PunishBan, Minutes: 10}, false},
+		{"ban:999999", Punishment{Action: PunishBan, Minutes: 30 * 24 * 60}, false},
+		{"kick", Punishment{Action: PunishKick}, false},
+		{"kick_reject", Punishment{Action: PunishKickReject}, false},
+		{"ban", Punishment{}, true},
+		{"ban:0", Punishment{}, true},
+		{"kick:1", Punishment{}, true},
+		{"mute", Punishment{}, true},
+	}
+	for _, c := range cases {
+		got, err := ParsePunishment(c.step)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("ParsePunishment(%q) = %+v, %v", c.step, got, err)
+		}
+	}
+}
+
+func TestRulePunishment(t *testing.T) {
+	if p := rulePunishment(""); p != nil {
+		t.Errorf("empty action = %+v, want nil", p)
+	}
+	if p := rulePunishment("mute"); p != nil {
+		t.Errorf("invalid action = %+v, want nil", p)
+	}
+	// 多条规则命中时按轻重取最重的处罚
+	order := []string{"warn", "ban:10", "ban:60", "kick", "kick_reject"}
+	for i := 1; i < len(order); i++ {
+		lighter, heavier := rulePunishment(order[i-1]), rulePunishment(order[i])
+		if lighter.severity() >= heavier.severity() {
+			t.Errorf("%s should be lighter than %s", order[i-1], order[i])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/review"
+)
+
+// ErrReviewNotFound 表示待复核消息不存在或已过期
+var ErrReviewNotFound = errors.New("review item not found or expired")
+
+// reviewEnabled 配置了管理群或管理员时才把待复核消息放入队列
+func reviewEnabled() bool {
+	return config.GetReviewGroup() != "" || len(config.GetReviewUsers()) > 0
+}
+
+// queueReview 把待复核的任务放入复核队列并转发给管理员
+func (p *Pipeline) queueReview(job *Job, verdict Verdict) (review.Item, error) {
+	item, err := review.GetInstance().Add(review.Item{
+		SelfID:     job.SelfID,
+		GroupID:    job.GroupID,
+		UserID:     job.UserID,
+		MessageID:  job.MessageID,
+		Kind:       string(job.Kind),
+		URL:        job.URL,
+		RawMessage: job.RawMessage,
+		Detector:   verdict.Detector,
+		Reason:     verdict.Reason,
+		Kick:       groupconfig.Get(job.GroupID).SetGroupKick,
+	}, time.Duration(config.GetReviewExpireMinutes())*time.Minute)
+	if err != nil {
+		return item, err
+	}
+	p.executor.Notify(job.SelfID, reviewMessage(item))
+	return item, nil
+}
+
+// reviewMessage 生成转发给管理员的复核消息,图片直接附上以便判断
+func reviewMessage(item review.Item) string {
+	message := fmt.Sprintf("[待复核 #%s] 群%s 用户%s 的消息%s\n%s: %s", item.ID, item.GroupID, item.UserID, item.MessageID, item.Detector, item.Reason)
+	switch Kind(item.Kind) {
+	case KindImage:
+		message += fmt.Sprintf("\n[CQ:image,file=%s]", item.URL)
+	case KindVideo:
+		message += "\n视频链接: " + item.URL
+	default:
+		message += "\n原消息: " + item.RawMessage
+	}
+	return message + fmt.Sprintf("\n回复\"%s %s\"撤回,\"%s %s\"放行,%d分钟内有效",
+		config.GetReviewApproveCommand(), item.ID, config.GetReviewRejectCommand(), item.ID, config.GetReviewExpireMinutes())
+}
+
+// Decide 处理管理员对待复核消息的决定,approve为true时撤回消息,入队时配置了踢人的同时踢出发送者
+func Decide(id string, approve bool) (review.Item, error) {
+	item, ok, err := review.GetInstance().Take(id)
+	if err != nil {
+		log.Printf("Failed to save review queue: %v", err)
+	}
+	if !ok {
+		return item, ErrReviewNotFound
+	}
+	if !approve {
+		logger.LogEvent(fmt.Sprintf("bot [%s] review #%s rejected, keep message group_id:%s user_id:%s message_id:%s", item.SelfID, item.ID, item.GroupID, item.UserID, item.MessageID))
+		return item, nil
+	}
+
+	mu.Lock()
+	p := instance
+	mu.Unlock()
+	if p == nil {
+		return item, fmt.Errorf("pipeline not initialized")
+	}
+	job := &Job{Kind: Kind(item.Kind), SelfID: item.SelfID, GroupID: item.GroupID, UserID: item.UserID, MessageID: item.MessageID, RawMessage: item.RawMessage, URL: item.URL}
+	verdict := Verdict{Decision: DecisionHit, Detector: item.Detector, Reason: item.Reason, Kick: item.Kick}
+	if err := p.executor.Execute(job, verdict); err != nil {
+		logger.LogEvent(fmt.Sprintf("bot [%s] failed to withdraw reviewed message #%s from group_id:%s user_id:%s message_id:%s: %v", item.SelfID, item.ID, item.GroupID, item.UserID, item.MessageID, err))
+		return item, err
+	}
+	logger.LogEvent(fmt.Sprintf("bot [%s] review #%s approved, withdraw from group_id:%s user_id:%s message_id:%s by %s: %s", item.SelfID, item.ID, item.GroupID, item.UserID, item.MessageID, item.Detector, item.Reason))
+	return item, nil
+}
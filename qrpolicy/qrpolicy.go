@@ -0,0 +1,136 @@
+package qrpolicy
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// Decision 是二维码内容规则的判定结果
+type Decision struct {
+	Allow bool
+	// Rule 描述命中的规则,便于在日志和接口中说明原因
+	Rule string
+	// Action 是撤回规则指定的处罚,如 ban:10,未指定时为空
+	Action string
+}
+
+var (
+	regexCache   = make(map[string]*regexp.Regexp)
+	regexCacheMu sync.Mutex
+)
+
+// Evaluate 按群的规则判定二维码内容,text为空表示无法解码
+func Evaluate(groupID, text string) Decision {
+	return evaluate(config.GetQRPolicies(groupID), text)
+}
+
+// evaluate 按顺序逐个匹配规则,每组规则先匹配放行再匹配撤回,都未命中时使用第一个非空的default/undecoded
+func evaluate(policies []structs.QRPolicy, text string) Decision {
+	if text == "" {
+		undecoded := first(policies, func(p structs.QRPolicy) string { return p.Undecoded })
+		return Decision{Allow: undecoded == "allow", Rule: "undecoded:" + actionName(undecoded)}
+	}
+
+	text = strings.TrimSpace(text)
+	scheme, host := splitURL(text)
+
+	for i, policy := range policies {
+		scope := ""
+		if i < len(policies)-1 {
+			scope = "group "
+		}
+		if rule, _, ok := match(text, scheme, host, policy.AllowDomains, policy.AllowPrefixes, policy.AllowRegex, policy.AllowSchemes); ok {
+			return Decision{Allow: true, Rule: scope + "allow " + rule}
+		}
+		if rule, action, ok := match(text, scheme, host, policy.DenyDomains, policy.DenyPrefixes, policy.DenyRegex, policy.DenySchemes); ok {
+			return Decision{Allow: false, Rule: scope + "deny " + rule, Action: action}
+		}
+	}
+	def := first(policies, func(p structs.QRPolicy) string { return p.Default })
+	return Decision{Allow: def == "allow", Rule: "default:" + actionName(def)}
+}
+
+// first 返回第一个非空的设置
+func first(policies []structs.QRPolicy, get func(structs.QRPolicy) string) string {
+	for _, policy := range policies {
+		if value := get(policy); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// match 依次检查域名、前缀、正则和协议规则,返回命中的规则和规则指定的处罚
+func match(text, scheme, host string, domains, prefixes, patterns, schemes []string) (string, string, bool) {
+	for _, entry := range domains {
+		domain, action := config.SplitRuleAction(entry)
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return "domain " + domain, action, true
+		}
+	}
+	for _, entry := range prefixes {
+		prefix, action := config.SplitRuleAction(entry)
+		if prefix != "" && strings.HasPrefix(text, prefix) {
+			return "prefix " + prefix, action, true
+		}
+	}
+	for _, entry := range patterns {
+		pattern, action := config.SplitRuleAction(entry)
+		re := compile(pattern)
+		if re != nil && re.MatchString(text) {
+			return "regex " + pattern, action, true
+		}
+	}
+	for _, entry := range schemes {
+		s, action := config.SplitRuleAction(entry)
+		s = strings.ToLower(strings.TrimSuffix(s, "://"))
+		if s != "" && scheme == s {
+			return "scheme " + s, action, true
+		}
+	}
+	return "", "", false
+}
+
+// splitURL 解析出小写的协议和主机名,内容不是url时返回空
+func splitURL(text string) (string, string) {
+	u, err := url.Parse(text)
+	if err != nil {
+		return "", ""
+	}
+	return strings.ToLower(u.Scheme), strings.ToLower(u.Hostname())
+}
+
+// compile 编译并缓存正则,无效的正则只记录一次日志
+func compile(pattern string) *regexp.Regexp {
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("Invalid qr_policy regex %q: %v", pattern, err)
+	}
+	regexCache[pattern] = re
+	return re
+}
+
+func actionName(action string) string {
+	if action == "allow" {
+		return "allow"
+	}
+	return "withdraw"
+}
+
+// String 以可读形式描述判定结果
+func (d Decision) String() string {
+	return fmt.Sprintf("allow=%v rule=%s", d.Allow, d.Rule)
+}
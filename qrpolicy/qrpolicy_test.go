@@ -0,0 +1,50 @@
+package qrpolicy
+
+import (
+	"testing"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+func TestEvaluateGroupFirst(t *testing.T) {
+	global := structs.QRPolicy{
+		AllowDomains: []string{"qq.com"},
+		DenySchemes:  []string{"weixin"},
+		Default:      "withdraw",
+		Undecoded:    "withdraw",
+	}
+	group := structs.QRPolicy{
+		DenyDomains:   []string{"qun.qq.com => ban:10"},
+		AllowPrefixes: []string{"weixin://dl/business"},
+		Default:       "allow",
+	}
+	policies := []structs.QRPolicy{group, global}
+
+	cases := []struct {
+		text   string
+		allow  bool
+		rule   string
+		action string
+	}{
+		// 群规则可以撤回全局放行的内容
+		{"https://qun.qq.com/join", false, "group deny domain qun.qq.com", "ban:10"},
+		{"https://im.qq.com", true, "allow domain qq.com", ""},
+		// 群规则也可以放行全局撤回的内容
+		{"weixin://dl/business/?t=1", true, "group allow prefix weixin://dl/business", ""},
+		{"weixin://other", false, "deny scheme weixin", ""},
+		// default使用群设置,undecoded未设置时继承全局
+		{"https://example.com", true, "default:allow", ""},
+		{"", false, "undecoded:withdraw", ""},
+	}
+	for _, c := range cases {
+		got := evaluate(policies, c.text)
+		if got.Allow != c.allow || got.Rule != c.rule || got.Action != c.action {
+			t.Errorf("evaluate(%q) = %+v, want allow=%v rule=%q action=%q", c.text, got, c.allow, c.rule, c.action)
+		}
+	}
+
+	// 只有全局规则时保持原来的判定
+	if got := evaluate([]structs.QRPolicy{global}, "https://qun.qq.com/join"); !got.Allow || got.Rule != "allow domain qq.com" {
+		t.Errorf("global only: %+v", got)
+	}
+}
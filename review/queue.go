@@ -0,0 +1,141 @@
+// Package review 持久化保存等待管理员复核的检测结果
+package review
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/jsonfile"
+)
+
+// Item 是一条待复核的消息,保存了批准后撤回和踢人所需的全部信息
+type Item struct {
+	ID         string    `json:"id"`
+	SelfID     string    `json:"self_id"`
+	GroupID    string    `json:"group_id"`
+	UserID     string    `json:"user_id"`
+	MessageID  string    `json:"message_id"`
+	Kind       string    `json:"kind"`
+	URL        string    `json:"url,omitempty"`
+	RawMessage string    `json:"raw_message,omitempty"`
+	Detector   string    `json:"detector"`
+	Reason     string    `json:"reason"`
+	Kick       bool      `json:"kick"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Queue 持久化保存待复核的消息,过期的消息在每次访问时清除
+type Queue struct {
+	filePath string
+	nextID   int
+	items    []Item
+	mu       sync.Mutex
+}
+
+// file 是队列文件的内容
+type file struct {
+	NextID int    `json:"next_id"`
+	Items  []Item `json:"items"`
+}
+
+var global = jsonfile.NewGlobal("review.json", New)
+
+// GetInstance 返回全局复核队列,首次调用时从文件加载
+func GetInstance() *Queue {
+	return global.Get()
+}
+
+// Open 从filePath重新加载全局复核队列,需要在处理事件之前调用
+func Open(filePath string) *Queue {
+	return global.Open(filePath)
+}
+
+// New 从filePath加载复核队列,文件不存在时为空队列
+func New(filePath string) *Queue {
+	q := &Queue{filePath: filePath, nextID: 1}
+	var f file
+	found, err := jsonfile.Load(filePath, &f)
+	if err != nil {
+		log.Printf("Failed to load review queue: %v", err)
+		return q
+	}
+	if !found {
+		return q
+	}
+	q.items = f.Items
+	if f.NextID > q.nextID {
+		q.nextID = f.NextID
+	}
+	fmt.Printf("成功加载 %d 条待复核消息\n", len(q.items))
+	return q
+}
+
+// save 保存队列,调用者需持有锁
+func (q *Queue) save() error {
+	return jsonfile.Save(q.filePath, file{NextID: q.nextID, Items: q.items})
+}
+
+// expire 清除已过期的消息,返回是否有变化,调用者需持有锁
+func (q *Queue) expire(now time.Time) bool {
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if now.Before(item.ExpiresAt) {
+			kept = append(kept, item)
+		} else {
+			log.Printf("Review item %s expired: group_id:%s message_id:%s", item.ID, item.GroupID, item.MessageID)
+		}
+	}
+	changed := len(kept) != len(q.items)
+	q.items = kept
+	return changed
+}
+
+// Add 加入一条待复核消息,ttl后过期,返回分配了编号的条目
+func (q *Queue) Add(item Item, ttl time.Duration) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	q.expire(now)
+	item.ID = strconv.Itoa(q.nextID)
+	q.nextID++
+	item.CreatedAt = now
+	item.ExpiresAt = now.Add(ttl)
+	q.items = append(q.items, item)
+	return item, q.save()
+}
+
+// Take 取出并删除指定编号的消息,不存在或已过期时返回false
+func (q *Queue) Take(id string) (Item, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := q.expire(time.Now())
+	for i, item := range q.items {
+		if item.ID == id {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return item, true, q.save()
+		}
+	}
+	if changed {
+		return Item{}, false, q.save()
+	}
+	return Item{}, false, nil
+}
+
+// List 返回所有未过期的消息,按加入顺序排列
+func (q *Queue) List() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.expire(time.Now()) {
+		if err := q.save(); err != nil {
+			log.Printf("Failed to save review queue: %v", err)
+		}
+	}
+	return append([]Item(nil), q.items...)
+}
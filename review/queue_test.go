@@ -0,0 +1,51 @@
+package review
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "review.json")
+	q := New(path)
+
+	first, err := q.Add(Item{GroupID: "100", MessageID: "11", Reason: "score 0.5"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Add(Item{GroupID: "100", MessageID: "12"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Add(Item{GroupID: "100", MessageID: "13"}, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("items got the same id %q", first.ID)
+	}
+
+	// 重新加载后仍然保留未过期的消息,编号继续递增
+	q = New(path)
+	if items := q.List(); len(items) != 2 || items[0].ID != first.ID || items[1].ID != second.ID {
+		t.Fatalf("List after reload = %+v, want items %s and %s", items, first.ID, second.ID)
+	}
+	item, ok, err := q.Take(first.ID)
+	if err != nil || !ok || item.Reason != "score 0.5" {
+		t.Fatalf("Take(%s) = %+v, %v, %v", first.ID, item, ok, err)
+	}
+	if _, ok, _ := q.Take(first.ID); ok {
+		t.Errorf("Take(%s) succeeded twice", first.ID)
+	}
+	third, err := q.Add(Item{GroupID: "100", MessageID: "14"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == first.ID || third.ID == second.ID {
+		t.Errorf("id %s was reused", third.ID)
+	}
+
+	if items := New(path).List(); len(items) != 2 {
+		t.Errorf("got %d items after Take and Add, want 2: %+v", len(items), items)
+	}
+}
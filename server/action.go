@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// ErrActionTimeout 表示在超时时间内没有收到对应echo的响应
+var ErrActionTimeout = errors.New("timed out waiting for action response")
+
+var (
+	pendingMu sync.Mutex
+	// echo -> 等待响应的channel
+	pendingActions = map[string]chan *structs.ActionResponse{}
+)
+
+// CallAction 通过ws发送带echo的action,并等待对应的响应帧
+// 收到响应但retcode不为0时,同时返回响应和错误,便于调用方区分失败原因(例如没有管理员权限)
+func CallAction(selfID, action string, params map[string]interface{}) (*structs.ActionResponse, error) {
+	echo := uuid.New().String()
+	ch := make(chan *structs.ActionResponse, 1)
+
+	pendingMu.Lock()
+	pendingActions[echo] = ch
+	pendingMu.Unlock()
+	defer func() {
+		pendingMu.Lock()
+		delete(pendingActions, echo)
+		pendingMu.Unlock()
+	}()
+
+	message := structs.Message{
+		Action: action,
+		Params: params,
+		Echo:   echo,
+	}
+	if err := sendBySelfID(selfID, message); err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(config.GetActionTimeout()) * time.Second
+	select {
+	case resp := <-ch:
+		if resp.Retcode != 0 || resp.Status == "failed" {
+			return resp, fmt.Errorf("action %s failed: status=%s retcode=%d message=%s", action, resp.Status, resp.Retcode, resp.Message+resp.Wording)
+		}
+		return resp, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("action %s: %w", action, ErrActionTimeout)
+	}
+}
+
+// handleActionResponse 若msg是某个action的响应,则交给等待者并返回true
+func handleActionResponse(msg []byte) bool {
+	var probe struct {
+		PostType string      `json:"post_type"`
+		Echo     interface{} `json:"echo"`
+	}
+	if err := json.Unmarshal(msg, &probe); err != nil || probe.PostType != "" || probe.Echo == nil {
+		return false
+	}
+
+	var resp structs.ActionResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return false
+	}
+
+	echo := fmt.Sprint(resp.Echo)
+	pendingMu.Lock()
+	ch, ok := pendingActions[echo]
+	pendingMu.Unlock()
+	if !ok {
+		fmt.Printf("收到未知echo[%s]的响应,可能已超时\n", echo)
+		return true
+	}
+
+	select {
+	case ch <- &resp:
+	default:
+	}
+	return true
+}
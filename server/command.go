@@ -0,0 +1,239 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// command 是一条群内指令
+type command struct {
+	trigger     func() string // 配置的指令,为空时停用
+	args        string        // 帮助中显示的参数说明,为空时指令不带参数
+	description string
+	admin       bool // 只有群主、管理员和超级用户可以使用
+	// accept 检查指令后的参数,返回false时当作以指令开头的普通聊天,为nil时只接受不带参数的指令
+	accept func(args string) bool
+	run    func(c *commandContext)
+}
+
+// commandContext 是一次指令调用
+type commandContext struct {
+	event   structs.MessageEvent
+	jobs    []*pipeline.Job
+	selfID  string
+	groupID string
+	userID  string
+	args    string
+}
+
+func (c *commandContext) reply(message string) {
+	if err := transportFor(c.selfID).SendGroupMsg(c.groupID, c.userID, message); err != nil {
+		log.Printf("Failed to send group message: %v\n", err)
+	}
+}
+
+// groupCommands 返回所有群内指令,帮助按此顺序列出
+func groupCommands() []command {
+	return []command{
+		switchCommand(config.GetOnEnableVideoCheck, "video_check", "视频二维码检测", true),
+		switchCommand(config.GetOnDisableVideoCheck, "video_check", "视频二维码检测", false),
+		switchCommand(config.GetOnEnablePicCheck, "image_check", "图片二维码检测", true),
+		switchCommand(config.GetOnDisablePicCheck, "image_check", "图片二维码检测", false),
+		{trigger: config.GetStatusCommand, description: "查看本群的检测设置", run: runStatus},
+		{trigger: config.GetUnmuteCommand, args: "@成员或QQ号", description: "解除成员禁言,不带参数时解除全员禁言", admin: true,
+			accept: func(args string) bool { _, ok := unmuteTargets(args); return ok }, run: runUnmute},
+		{trigger: config.GetPhashAddCommand, args: "图片或哈希", description: "添加已知广告图", admin: true,
+			accept: func(string) bool { return true }, run: func(c *commandContext) { runPhash(c, true) }},
+		{trigger: config.GetPhashRemoveCommand, args: "哈希", description: "删除已知广告图", admin: true,
+			accept: func(string) bool { return true }, run: func(c *commandContext) { runPhash(c, false) }},
+		{trigger: config.GetSetCommand, args: "设置项 值", description: "修改本群的一项设置,设置项见检测状态", admin: true,
+			accept: func(args string) bool { _, value, ok := settingArgs(args); return ok && value != "" }, run: runSet},
+		{trigger: config.GetUnsetCommand, args: "设置项", description: "本群的该项设置恢复使用配置文件中的值", admin: true,
+			accept: func(args string) bool { _, value, ok := settingArgs(args); return ok && value == "" }, run: runUnset},
+		{trigger: config.GetHelpCommand, description: "列出可用的指令", run: runHelp},
+	}
+}
+
+// settingArgs 拆分 设置项 值,设置项不存在时返回false,值可以包含空格
+func settingArgs(args string) (groupconfig.Key, string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return groupconfig.Key{}, "", false
+	}
+	k, ok := groupconfig.Lookup(fields[0])
+	return k, strings.TrimSpace(strings.TrimPrefix(args, fields[0])), ok
+}
+
+// runSet 修改本群的一项设置
+func runSet(c *commandContext) {
+	k, value, _ := settingArgs(c.args)
+	if err := groupconfig.Set(c.groupID, k.Name, value); err != nil {
+		log.Printf("Failed to save group setting: %v\n", err)
+		if errors.Is(err, groupconfig.ErrInvalid) {
+			c.reply(fmt.Sprintf("%s设置失败: %v", k.Description, err))
+		} else {
+			c.reply(k.Description + "设置失败")
+		}
+		return
+	}
+	c.reply(fmt.Sprintf("%s(%s)已设置为 %s", k.Description, k.Name, k.Value(groupconfig.Get(c.groupID))))
+}
+
+// runUnset 取消本群对一项设置的覆盖
+func runUnset(c *commandContext) {
+	k, _, _ := settingArgs(c.args)
+	if err := groupconfig.Unset(c.groupID, k.Name); err != nil {
+		log.Printf("Failed to save group setting: %v\n", err)
+		c.reply(k.Description + "恢复失败")
+		return
+	}
+	c.reply(fmt.Sprintf("%s(%s)已恢复为配置文件中的值 %s", k.Description, k.Name, k.Value(groupconfig.Get(c.groupID))))
+}
+
+// switchCommand 生成开启或关闭本群一项检测的指令,重复发送不会反转开关
+func switchCommand(trigger func() string, key, name string, enable bool) command {
+	state := "关闭"
+	if enable {
+		state = "开启"
+	}
+	return command{
+		trigger:     trigger,
+		description: state + "本群" + name,
+		admin:       true,
+		run: func(c *commandContext) {
+			k, _ := groupconfig.Lookup(key)
+			if k.Value(groupconfig.Get(c.groupID)) == strconv.FormatBool(enable) {
+				c.reply(name + "已经是" + state + "状态")
+				return
+			}
+			if err := groupconfig.Set(c.groupID, key, strconv.FormatBool(enable)); err != nil {
+				log.Printf("Failed to save group setting: %v\n", err)
+				c.reply(name + state + "失败")
+				return
+			}
+			c.reply(name + "已" + state)
+		},
+	}
+}
+
+// trimCommandPrefix 去掉配置的指令前缀,没有前缀的消息不是指令
+func trimCommandPrefix(rawMessage string) (string, bool) {
+	rawMessage = strings.TrimSpace(rawMessage)
+	prefix := config.GetCommandPrefix()
+	if !strings.HasPrefix(rawMessage, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(rawMessage, prefix)), true
+}
+
+// matchCommand 找到消息对应的指令,多条指令都匹配时取最长的
+func matchCommand(text string) (command, string, bool) {
+	var matched command
+	var length int
+	for _, cmd := range groupCommands() {
+		trigger := cmd.trigger()
+		if trigger != "" && len(trigger) > length && strings.HasPrefix(text, trigger) {
+			matched, length = cmd, len(trigger)
+		}
+	}
+	if length == 0 {
+		return matched, "", false
+	}
+	args := strings.TrimSpace(text[length:])
+	if matched.accept == nil {
+		return matched, args, args == ""
+	}
+	return matched, args, matched.accept(args)
+}
+
+// isGroupAdmin 群主、管理员和配置的超级用户可以使用管理指令
+func isGroupAdmin(event structs.MessageEvent) bool {
+	if event.Sender.Role == "owner" || event.Sender.Role == "admin" {
+		return true
+	}
+	userID := fmt.Sprint(event.UserID)
+	for _, user := range config.GetSuperUsers() {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGroupCommand 处理群内指令,返回消息是否为指令
+func handleGroupCommand(event structs.MessageEvent, jobs []*pipeline.Job) bool {
+	if event.MessageType != "group" {
+		return false
+	}
+	text, ok := trimCommandPrefix(event.RawMessage)
+	if !ok {
+		return false
+	}
+	cmd, args, ok := matchCommand(text)
+	if !ok {
+		return false
+	}
+
+	c := &commandContext{
+		event:   event,
+		jobs:    jobs,
+		selfID:  fmt.Sprint(event.SelfID),
+		groupID: fmt.Sprint(event.GroupID),
+		userID:  fmt.Sprint(event.UserID),
+		args:    args,
+	}
+	if cmd.admin && !isGroupAdmin(event) {
+		c.reply("只有群主或管理员可以使用该指令")
+		return true
+	}
+	cmd.run(c)
+	return true
+}
+
+// runStatus 列出本群生效的检测设置,标出本群单独设置过的项
+func runStatus(c *commandContext) {
+	settings := groupconfig.Get(c.groupID)
+	overridden := map[string]bool{}
+	for _, name := range groupconfig.GetInstance().Overridden(c.groupID) {
+		overridden[name] = true
+	}
+	lines := []string{"本群检测设置:"}
+	for _, k := range groupconfig.Keys {
+		line := fmt.Sprintf("%s(%s): %s", k.Description, k.Name, k.Value(settings))
+		if overridden[k.Name] {
+			line += " [本群]"
+		}
+		lines = append(lines, line)
+	}
+	c.reply(strings.Join(lines, "\n"))
+}
+
+// runHelp 列出已启用的指令
+func runHelp(c *commandContext) {
+	prefix := config.GetCommandPrefix()
+	lines := []string{"可用指令:"}
+	for _, cmd := range groupCommands() {
+		trigger := cmd.trigger()
+		if trigger == "" {
+			continue
+		}
+		line := prefix + trigger
+		if cmd.args != "" {
+			line += " " + cmd.args
+		}
+		line += ": " + cmd.description
+		if cmd.admin {
+			line += "(管理员)"
+		}
+		lines = append(lines, line)
+	}
+	c.reply(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+)
+
+type eventItem struct {
+	msg  []byte
+	conf *config.Config
+}
+
+// events 是待处理事件的有界队列,由固定数量的协程处理,刷屏时不会无限制地创建协程
+var events struct {
+	once    sync.Once
+	items   chan eventItem
+	dropped atomic.Int64
+}
+
+// dispatchEvent 把事件交给处理协程,不会阻塞读循环
+// 事件处理会等待action响应,而响应只能由读循环收取,所以队列满时丢弃新事件而不是等待
+func dispatchEvent(msg []byte, conf *config.Config) {
+	events.once.Do(func() {
+		events.items = make(chan eventItem, config.GetEventQueueSize())
+		for i := 0; i < config.GetEventWorkers(); i++ {
+			go eventWorker()
+		}
+	})
+	select {
+	case events.items <- eventItem{msg: msg, conf: conf}:
+	default:
+		fmt.Printf("事件队列已满,丢弃事件(累计%d条): %.200s\n", events.dropped.Add(1), msg)
+	}
+}
+
+func eventWorker() {
+	for item := range events.items {
+		processEvent(item)
+	}
+}
+
+// processEvent 处理一条事件,panic只记录日志,不影响处理协程
+func processEvent(item eventItem) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("处理事件时panic: %v\n%s\n", r, debug.Stack())
+		}
+	}()
+	processWSMessage(item.msg, item.conf)
+}
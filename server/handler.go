@@ -1,79 +1,34 @@
 package server
 
 import (
-	"bytes"
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
-	"regexp"
-	"strings"
+	"sync"
 
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
 )
 
-func handleVideoMessage(config *config.Config, rawMessage string, messageEvent structs.MessageEvent) {
-	re := regexp.MustCompile(`\[CQ:video,file=.+?,url=(.+?)\]`)
-	matches := re.FindStringSubmatch(rawMessage)
-	if len(matches) < 2 {
-		// log.Println("No video URL found in the message.")
-		return
-	}
-
-	videoURL := strings.Replace(matches[1], "\\u0026amp;", "&", -1)
-	videoURL = strings.Replace(videoURL, "&amp;", "&", -1)
-	fmt.Printf("提取到视频链接:%v\n", videoURL)
-	encodedURL := url.QueryEscape(videoURL)
-
-	port := config.Settings.Port
-	selfID := fmt.Sprint(messageEvent.SelfID)
-	messageID := fmt.Sprint(messageEvent.MessageID)
-	userID := fmt.Sprint(messageEvent.UserID)
-	groupID := fmt.Sprint(messageEvent.GroupID)
-	apiURL := fmt.Sprintf("http://127.0.0.1:%s/videoDuration?videourl=%s&self_id=%s&message_id=%s&user_id=%s&group_id=%s", port, encodedURL, selfID, messageID, userID, groupID)
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		log.Printf("Failed to invoke internal API: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-	var buf bytes.Buffer
-	buf.ReadFrom(resp.Body)
-	fmt.Println("Internal API response:", buf.String())
-}
-
-func handleImageMessage(config *config.Config, rawMessage string, messageEvent structs.MessageEvent) {
-	re := regexp.MustCompile(`\[CQ:image,file=.+?,url=(.+?)\]`)
-	matches := re.FindAllStringSubmatch(rawMessage, -1)
-	if len(matches) == 0 {
-		// log.Println("No image URL found in the message.")
-		return
-	}
-
-	port := config.Settings.Port
-	selfID := fmt.Sprint(messageEvent.SelfID)
-	messageID := fmt.Sprint(messageEvent.MessageID)
-	userID := fmt.Sprint(messageEvent.UserID)
-	groupID := fmt.Sprint(messageEvent.GroupID)
-
-	for _, match := range matches {
-		imageURL := strings.Replace(match[1], "\\u0026amp;", "&", -1)
-		imageURL = strings.Replace(imageURL, "&amp;", "&", -1)
-		fmt.Printf("提取到图片链接:%v\n", imageURL)
-		encodedURL := url.QueryEscape(imageURL)
-
-		apiURL := fmt.Sprintf("http://127.0.0.1:%s/picheck?imageurl=%s&self_id=%s&message_id=%s&user_id=%s&group_id=%s", port, encodedURL, selfID, messageID, userID, groupID)
-
-		resp, err := http.Get(apiURL)
-		if err != nil {
-			log.Printf("Failed to invoke internal API: %v\n", err)
-			continue
+// mediaJobs 统计尚未完成的图片和视频任务,回放事件时据此等待
+var mediaJobs sync.WaitGroup
+
+// handleMediaJob 把图片或视频任务放入检测队列,不阻塞ws读循环
+func handleMediaJob(job *pipeline.Job) {
+	fmt.Printf("提取到%s链接:%v\n", job.Kind, job.URL)
+
+	// 任务被丢弃时done会被调用且Submit同时返回错误,只能计一次完成
+	var once sync.Once
+	finish := func() { once.Do(mediaJobs.Done) }
+	mediaJobs.Add(1)
+	err := pipeline.Submit(job, func(result pipeline.Result) {
+		defer finish()
+		if result.Err != nil {
+			log.Printf("Failed to process %s job: %v\n", job.Kind, result.Err)
+			return
 		}
-		defer resp.Body.Close()
-		var buf bytes.Buffer
-		buf.ReadFrom(resp.Body)
-		fmt.Println("Internal API response:", buf.String())
+		fmt.Printf("检测结果: withdrawn[%v] shadow[%v] detector[%s] reason[%s] details%v\n", result.Actioned, result.Shadow, result.Verdict.Detector, result.Verdict.Reason, result.Details)
+	})
+	if err != nil {
+		finish()
+		log.Printf("Failed to submit %s job: %v\n", job.Kind, err)
 	}
 }
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+)
+
+var (
+	atRegex     = regexp.MustCompile(`\[CQ:at,qq=(\d+)[^\]]*\]`)
+	userIDRegex = regexp.MustCompile(`^\d{5,}$`)
+)
+
+// unmuteTargets 解析解除禁言指令的参数,参数只能是@成员或QQ号
+func unmuteTargets(args string) ([]string, bool) {
+	var targets []string
+	for _, match := range atRegex.FindAllStringSubmatch(args, -1) {
+		targets = append(targets, match[1])
+	}
+	for _, field := range strings.Fields(atRegex.ReplaceAllString(args, " ")) {
+		if !userIDRegex.MatchString(field) {
+			return nil, false
+		}
+		targets = append(targets, field)
+	}
+	return targets, true
+}
+
+// runUnmute 解除指令中成员的禁言, 不带参数时解除全员禁言
+func runUnmute(c *commandContext) {
+	targets, _ := unmuteTargets(c.args)
+	if len(targets) == 0 {
+		if err := pipeline.UnmuteAll(c.selfID, c.groupID); err != nil {
+			c.reply(fmt.Sprintf("解除全员禁言失败: %v", err))
+			return
+		}
+		c.reply("已解除全员禁言")
+		return
+	}
+
+	var results []string
+	for _, target := range targets {
+		if err := pipeline.Mute(c.selfID, c.groupID, target, 0); err != nil {
+			results = append(results, fmt.Sprintf("%s 解除禁言失败: %v", target, err))
+		} else {
+			results = append(results, fmt.Sprintf("%s 已解除禁言", target))
+		}
+	}
+	c.reply(strings.Join(results, "\n"))
+}
@@ -1,141 +1,50 @@
 package server
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"net/url"
+	"sync"
 
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/onebot"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
 )
 
-// sendDeleteMessageViaWebSocket sends a delete message via WebSocket for the given selfID and messageID.
-func SendDeleteMessageViaWebSocket(selfID, messageID string) error {
-	message := map[string]interface{}{
-		"action": "delete_msg",
-		"params": map[string]string{
-			"message_id": messageID,
-		},
-	}
-
-	if err := SendMessageBySelfID(selfID, message); err != nil {
-		log.Printf("Failed to send delete message via websocket: %v\n", err)
-		return err
-	}
-
-	return nil
+// wsCaller 通过已建立的ws连接调用action
+type wsCaller struct {
+	selfID string
 }
 
-// sendDeleteRequest sends a delete request via HTTP to the given URL token.
-func SendDeleteRequest(urlToken struct {
-	BaseURL     string
-	AccessToken string
-}, messageID string) error {
-	deleteURL := fmt.Sprintf("%s/delete_msg?message_id=%s", urlToken.BaseURL, messageID)
-	if urlToken.AccessToken != "" {
-		deleteURL += fmt.Sprintf("&access_token=%s", urlToken.AccessToken)
-	}
-
-	resp, err := http.Get(deleteURL)
-	if err != nil {
-		return fmt.Errorf("failed to delete message: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to delete message, status code: %d", resp.StatusCode)
-	}
-
-	return nil
+func (w *wsCaller) CallAction(action string, params map[string]interface{}) (*structs.ActionResponse, error) {
+	return CallAction(w.selfID, action, params)
 }
 
-// sendGroupMsgHttp sends a POST request to the fixed endpoint with the given group_id, user_id and message.
-func SendGroupMsgHttp(urlToken struct {
-	BaseURL     string
-	AccessToken string
-}, groupID, userID, message string) error {
-	// 定义固定的endpoint
-	const endpoint = "send_group_msg"
-
-	// 构建完整的URL
-	postURL := fmt.Sprintf("%s/%s", urlToken.BaseURL, endpoint)
-	u, err := url.Parse(postURL)
-	if err != nil {
-		return fmt.Errorf("URL parsing failed: %v", err)
-	}
-
-	// 添加access_token参数
-	query := u.Query()
-	if urlToken.AccessToken != "" {
-		query.Set("access_token", urlToken.AccessToken)
-	}
-	u.RawQuery = query.Encode()
-
-	// 构造请求体
-	payload := map[string]interface{}{
-		"group_id": groupID,
-		"user_id":  userID,
-		"message":  "[CQ:at,qq=" + userID + "]" + message, //at触发者
+// GetTransport 按self_id选择连接方式:配置了http地址的机器人走http,否则走ws连接
+func GetTransport(selfID string) onebot.Transport {
+	if urlToken, exists := utils.GetBaseURLByUserID(selfID); exists {
+		return onebot.NewTransport(&onebot.HTTPCaller{
+			BaseURL:     urlToken.BaseURL,
+			AccessToken: urlToken.AccessToken,
+		})
 	}
-
-	requestBody, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	// 发送POST请求
-	resp, err := http.Post(u.String(), "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return fmt.Errorf("failed to send POST request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-OK response status: %s", resp.Status)
-	}
-
-	return nil
+	return onebot.NewTransport(&wsCaller{selfID: selfID})
 }
 
-// SendGroupMessageViaWebSocket sends a group message via WebSocket for the given selfID, groupID, userID, and message.
-func SendGroupMessageViaWebSocket(selfID, groupID, userID, message string) error {
-	wsMessage := map[string]interface{}{
-		"action": "send_group_msg",
-		"params": map[string]interface{}{
-			"group_id": groupID,
-			"user_id":  userID,
-			"message":  "[CQ:at,qq=" + userID + "]" + message, //at触发者
-		},
-	}
-
-	if err := SendMessageBySelfID(selfID, wsMessage); err != nil {
-		log.Printf("Failed to send group message via websocket: %v\n", err)
-		return err
-	}
+var (
+	resolverMu sync.Mutex
+	resolver   pipeline.TransportResolver = GetTransport
+)
 
-	return nil
+// SetTransportResolver 替换事件处理中回复指令等动作使用的Transport,回放事件时用于截获动作
+func SetTransportResolver(resolve pipeline.TransportResolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolver = resolve
 }
 
-// KickGroupMemberViaWebSocket kicks a group member and optionally rejects their re-add requests based on config.
-func KickGroupMemberViaWebSocket(selfID, groupID, userID string) error {
-	rejectAddRequest := config.GetKickAndRejectAddRequest() // 获取是否拒绝加群请求的配置
-
-	wsMessage := map[string]interface{}{
-		"action": "set_group_kick",
-		"params": map[string]interface{}{
-			"group_id":           groupID,
-			"user_id":            userID,
-			"reject_add_request": rejectAddRequest, // 根据配置决定是否拒绝此人的加群请求
-		},
-	}
-
-	if err := SendMessageBySelfID(selfID, wsMessage); err != nil {
-		log.Printf("Failed to kick group member via websocket: %v\n", err)
-		return err
-	}
-
-	return nil
+// transportFor 返回处理事件时使用的Transport
+func transportFor(selfID string) onebot.Transport {
+	resolverMu.Lock()
+	resolve := resolver
+	resolverMu.Unlock()
+	return resolve(selfID)
 }
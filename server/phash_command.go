@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/phash"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+)
+
+var hexHashLen = len(phash.Format(0))
+
+// runPhash 添加或删除已知广告图
+// 指令格式: 添加指令+图片 或 添加指令+哈希, 删除指令+哈希
+func runPhash(c *commandContext, adding bool) {
+	store := phash.GetInstance()
+	source := fmt.Sprintf("command group_id:%s user_id:%s", c.groupID, c.userID)
+	var results []string
+
+	if adding {
+		for _, job := range c.jobs {
+			if job.Kind != pipeline.KindImage {
+				continue
+			}
+			imagePath, err := media.Fetch(job.URL, media.TypeImage)
+			if err != nil {
+				results = append(results, fmt.Sprintf("图片下载失败: %v", err))
+				continue
+			}
+			hash, added, err := store.AddFile(imagePath, source)
+			results = append(results, describeHashChange(hash, added, err, "已添加", "已存在"))
+		}
+	}
+
+	for _, field := range strings.Fields(c.args) {
+		if len(field) != hexHashLen {
+			continue
+		}
+		hash, err := phash.Parse(field)
+		if err != nil {
+			results = append(results, err.Error())
+			continue
+		}
+		var changed bool
+		if adding {
+			changed, err = store.Add(hash, source)
+			results = append(results, describeHashChange(hash, changed, err, "已添加", "已存在"))
+		} else {
+			changed, err = store.Remove(hash)
+			results = append(results, describeHashChange(hash, changed, err, "已删除", "不存在"))
+		}
+	}
+
+	if len(results) == 0 {
+		c.reply("请在指令后附带图片或16位十六进制哈希")
+		return
+	}
+	c.reply(strings.Join(results, "\n"))
+}
+
+func describeHashChange(hash uint64, changed bool, err error, changedText, unchangedText string) string {
+	if err != nil {
+		return fmt.Sprintf("%s 保存失败: %v", phash.Format(hash), err)
+	}
+	if changed {
+		return fmt.Sprintf("%s %s", phash.Format(hash), changedText)
+	}
+	return fmt.Sprintf("%s %s", phash.Format(hash), unchangedText)
+}
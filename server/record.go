@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+)
+
+// RecordedEvent 是录制文件中的一行,Raw为收到的原始帧
+type RecordedEvent struct {
+	ReceivedAt time.Time       `json:"received_at"`
+	SelfID     string          `json:"self_id"`
+	Raw        json.RawMessage `json:"raw"`
+}
+
+var (
+	recordMu   sync.Mutex
+	recordFile *os.File
+	recordPath string
+)
+
+// recordFrame 在配置了record_events时,把收到的帧追加写入录制文件
+func recordFrame(selfID string, msg []byte) {
+	path := config.GetRecordEvents()
+	if path == "" || !json.Valid(msg) {
+		return
+	}
+	line, err := json.Marshal(RecordedEvent{ReceivedAt: time.Now(), SelfID: selfID, Raw: msg})
+	if err != nil {
+		log.Printf("Failed to marshal recorded event: %v\n", err)
+		return
+	}
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recordFile == nil || recordPath != path {
+		if recordFile != nil {
+			recordFile.Close()
+		}
+		recordFile, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			recordFile = nil
+			log.Printf("Failed to open event record file: %v\n", err)
+			return
+		}
+		recordPath = path
+	}
+	if _, err := recordFile.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to record event: %v\n", err)
+	}
+}
+
+// ReplayEvent 同步处理一条录制的事件,等到其中的图片和视频检测完成后才返回
+// 调用前需要用SetTransportResolver和pipeline.Init换成不真正发送的Transport
+func ReplayEvent(msg []byte) {
+	processWSMessage(msg, nil)
+	mediaJobs.Wait()
+}
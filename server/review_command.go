@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/review"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// handleReviewCommand 处理管理群或管理员私聊中的复核指令,返回消息是否为此类指令
+// 指令格式: 通过+编号 撤回, 驳回+编号 放行, 只发指令时列出待复核消息
+// 管理群中需要是群主、管理员、超级用户或review_users中的用户
+func handleReviewCommand(event structs.MessageEvent) bool {
+	selfID := fmt.Sprint(event.SelfID)
+	groupID := fmt.Sprint(event.GroupID)
+	userID := fmt.Sprint(event.UserID)
+
+	var reply func(message string)
+	switch {
+	case event.MessageType == "group" && groupID == config.GetReviewGroup():
+		reply = func(message string) {
+			if err := transportFor(selfID).SendGroupMsg(groupID, userID, message); err != nil {
+				log.Printf("Failed to send group message: %v\n", err)
+			}
+		}
+	case event.MessageType == "private" && isReviewUser(userID):
+		reply = func(message string) {
+			if err := transportFor(selfID).SendPrivateMsg(userID, message); err != nil {
+				log.Printf("Failed to send private message: %v\n", err)
+			}
+		}
+	default:
+		return false
+	}
+
+	rawMessage, ok := trimCommandPrefix(event.RawMessage)
+	if !ok {
+		return false
+	}
+	var approve bool
+	var args string
+	switch approveCommand, rejectCommand := config.GetReviewApproveCommand(), config.GetReviewRejectCommand(); {
+	case strings.HasPrefix(rawMessage, approveCommand):
+		approve = true
+		args = strings.TrimPrefix(rawMessage, approveCommand)
+	case strings.HasPrefix(rawMessage, rejectCommand):
+		args = strings.TrimPrefix(rawMessage, rejectCommand)
+	default:
+		return false
+	}
+
+	fields := strings.Fields(strings.NewReplacer("#", " ", ",", " ", "，", " ").Replace(args))
+	// 先检查全部编号,含有非数字时整条消息当作以指令开头的普通聊天,不处理其中任何编号
+	for _, id := range fields {
+		if _, err := strconv.Atoi(id); err != nil {
+			return false
+		}
+	}
+	// 管理群中只有群主、管理员、超级用户和review_users可以复核
+	if event.MessageType == "group" && !isGroupAdmin(event) && !isReviewUser(userID) {
+		reply("只有群主、管理员或复核管理员可以复核")
+		return true
+	}
+	if len(fields) == 0 {
+		reply(listReviews())
+		return true
+	}
+
+	var results []string
+	for _, id := range fields {
+		item, err := pipeline.Decide(id, approve)
+		switch {
+		case errors.Is(err, pipeline.ErrReviewNotFound):
+			results = append(results, fmt.Sprintf("#%s 不存在或已过期", id))
+		case err != nil:
+			results = append(results, fmt.Sprintf("#%s 撤回失败: %v", id, err))
+		case approve:
+			results = append(results, fmt.Sprintf("#%s 已撤回群%s 用户%s 的消息", id, item.GroupID, item.UserID))
+		default:
+			results = append(results, fmt.Sprintf("#%s 已放行", id))
+		}
+	}
+	reply(strings.Join(results, "\n"))
+	return true
+}
+
+func isReviewUser(userID string) bool {
+	for _, user := range config.GetReviewUsers() {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// listReviews 列出待复核消息及剩余有效时间
+func listReviews() string {
+	items := review.GetInstance().List()
+	if len(items) == 0 {
+		return "没有待复核的消息"
+	}
+	lines := []string{fmt.Sprintf("待复核消息%d条:", len(items))}
+	for _, item := range items {
+		remaining := time.Until(item.ExpiresAt).Round(time.Minute)
+		lines = append(lines, fmt.Sprintf("#%s 群%s 用户%s %s: %s 剩余%v", item.ID, item.GroupID, item.UserID, item.Detector, item.Reason, remaining))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -12,16 +12,19 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/superini"
 )
 
 type WebSocketServerClient struct {
 	SelfID string
 	Conn   *websocket.Conn
+	// writeMu 保证同一连接不会并发写,不同连接互不阻塞
+	writeMu sync.Mutex
 }
 
+// lock 保护clients和各连接的SelfID
 var lock sync.Mutex
 
 // 维护所有活跃连接的切片
@@ -90,17 +93,13 @@ func wsHandler(c *gin.Context, config *config.Config) {
 
 	// 创建WebSocketServerClient实例
 	client := &WebSocketServerClient{
-		Conn: conn,
+		SelfID: selfID,
+		Conn:   conn,
 	}
 
 	botID := selfID
 
-	lock.Lock()
-	clients = append(clients, &WebSocketServerClient{
-		SelfID: selfID,
-		Conn:   conn,
-	})
-	lock.Unlock()
+	addClient(client)
 
 	// 发送连接成功的消息
 	message := map[string]interface{}{
@@ -118,20 +117,56 @@ func wsHandler(c *gin.Context, config *config.Config) {
 	//退出时候的清理
 	defer conn.Close()
 
+	readLoop(client, config)
+}
+
+// readLoop 持续读取连接上的消息,直到连接出错,正向ws与主动连接共用
+func readLoop(client *WebSocketServerClient, config *config.Config) error {
 	for {
-		messageType, p, err := conn.ReadMessage()
+		messageType, p, err := client.Conn.ReadMessage()
 		if err != nil {
 			fmt.Printf("Error reading message: %v\n", err)
-			removeFromClients(conn) // Remove the faulty connection
-			return
+			removeFromClients(client.Conn) // Remove the faulty connection
+			return err
 		}
 
 		if messageType == websocket.TextMessage {
-			processWSMessage(p, config)
+			learnSelfID(client, p)
+			recordFrame(client.SelfID, p)
+			// action的响应直接交给等待者,不能阻塞在事件处理里
+			if handleActionResponse(p) {
+				continue
+			}
+			// 事件处理中会调用action并等待响应,因此不能占用读循环
+			dispatchEvent(p, config)
 		}
 	}
 }
 
+func addClient(client *WebSocketServerClient) {
+	lock.Lock()
+	defer lock.Unlock()
+	clients = append(clients, client)
+}
+
+// learnSelfID 当连接时未提供X-Self-ID时,从收到的事件中补全self_id
+func learnSelfID(client *WebSocketServerClient, msg []byte) {
+	lock.Lock()
+	defer lock.Unlock()
+	if client.SelfID != "" {
+		return
+	}
+
+	var event struct {
+		SelfID json.Number `json:"self_id"`
+	}
+	if err := json.Unmarshal(msg, &event); err != nil || event.SelfID == "" {
+		return
+	}
+	client.SelfID = event.SelfID.String()
+	fmt.Printf("从事件中获取到机器人self_id[%v]\n", client.SelfID)
+}
+
 func removeFromClients(conn *websocket.Conn) {
 	lock.Lock()
 	defer lock.Unlock()
@@ -160,74 +195,30 @@ func processWSMessage(msg []byte, conf *config.Config) {
 			return
 		}
 
-		rawMessage := messageEvent.RawMessage
-		groupID := fmt.Sprint(messageEvent.GroupID)
-		selfID := fmt.Sprint(messageEvent.SelfID)
-		userID := fmt.Sprint(messageEvent.UserID)
-		messageID := fmt.Sprint(messageEvent.MessageID)
-
-		// 获取需要撤回的关键词列表
-		withdrawWords := config.GetWithdrawWords()
-
-		// 检查rawMessage是否包含任何撤回关键词
-		for _, word := range withdrawWords {
-			if strings.Contains(rawMessage, word) {
-				// 如果找到匹配的词，则发送删除消息请求
-				SendDeleteMessageViaWebSocket(selfID, messageID)
-				// 撤回 & 提示
-				logger.LogEvent(fmt.Sprintf("bot [%s] withdraw from group_id:%s user_id:%s messgae[%s]", selfID, groupID, userID, rawMessage))
-				// 发送提示消息
-				withdrawNotice := config.GetWithdrawNotice()
-				SendGroupMessageViaWebSocket(selfID, groupID, userID, withdrawNotice)
-
-				// 如果设置了踢出群成员
-				if config.GetSetGroupKick() {
-					KickGroupMemberViaWebSocket(selfID, groupID, userID)
-				}
-
-				// 处理完毕后退出循环
-				break
-			}
+		// 管理员复核待定的检测结果
+		if handleReviewCommand(messageEvent) {
+			return
 		}
 
-		handleConfigToggle := func(currentStatus string, enableMessage, disableMessage string, section string) {
-			newStatus := "true"
-			if currentStatus == "true" {
-				newStatus = "false"
-			}
-			superini.WriteConfig(groupID, section, newStatus)
-			message := disableMessage
-			if newStatus == "true" {
-				message = enableMessage
-			}
-			SendGroupMessageViaWebSocket(selfID, groupID, userID, message)
+		// 第一个任务是文本任务,检查撤回关键词
+		jobs := pipeline.JobsFromEvent(messageEvent)
+		// 影子模式下同样到此为止,与正式撤回时的处理保持一致
+		if result := pipeline.Process(jobs[0]); result.Actioned || result.Shadow {
+			return
 		}
 
-		switch rawMessage {
-		case config.GetOnEnableVideoCheck():
-			currentStatus := superini.ReadConfig(groupID, "handleVideoMessage")
-			handleConfigToggle(currentStatus, "视频二维码检测已开启", "视频二维码检测已关闭", "handleVideoMessage")
-
-		case config.GetOnDisableVideoCheck():
-			currentStatus := superini.ReadConfig(groupID, "handleVideoMessage")
-			handleConfigToggle(currentStatus, "视频二维码检测已开启", "视频二维码检测已关闭", "handleVideoMessage")
-
-		case config.GetOnEnablePicCheck():
-			currentStatus := superini.ReadConfig(groupID, "handleImageMessage")
-			handleConfigToggle(currentStatus, "图片二维码检测已开启", "图片二维码检测已关闭", "handleImageMessage")
-
-		case config.GetOnDisablePicCheck():
-			currentStatus := superini.ReadConfig(groupID, "handleImageMessage")
-			handleConfigToggle(currentStatus, "图片二维码检测已开启", "图片二维码检测已关闭", "handleImageMessage")
-
-		default:
-			videoCheckEnabled := superini.ReadConfig(groupID, "handleVideoMessage")
-			imageCheckEnabled := superini.ReadConfig(groupID, "handleImageMessage")
+		// 开关检测、解除禁言、维护黑名单等群内指令
+		if handleGroupCommand(messageEvent, jobs[1:]) {
+			return
+		}
 
-			if strings.Contains(rawMessage, "[CQ:video") && videoCheckEnabled == "true" {
-				handleVideoMessage(conf, rawMessage, messageEvent)
-			} else if strings.Contains(rawMessage, "[CQ:image") && imageCheckEnabled == "true" {
-				handleImageMessage(conf, rawMessage, messageEvent)
+		settings := groupconfig.Get(fmt.Sprint(messageEvent.GroupID))
+		// 影子模式不会撤回,群内未开启检测时也检测,便于先观察效果再开启
+		for _, job := range jobs[1:] {
+			if job.Kind == pipeline.KindVideo && (settings.VideoCheck || settings.ShadowMode) {
+				handleMediaJob(job)
+			} else if job.Kind == pipeline.KindImage && (settings.ImageCheck || settings.ShadowMode) {
+				handleMediaJob(job)
 			}
 		}
 	}
@@ -240,7 +231,14 @@ func (c *WebSocketServerClient) SendMessage(message map[string]interface{}) erro
 		fmt.Println("Error marshalling message:", err)
 		return err
 	}
-	return c.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+	return c.write(msgBytes)
+}
+
+// write 向连接写入一条文本消息
+func (c *WebSocketServerClient) write(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(websocket.TextMessage, msg)
 }
 
 func (client *WebSocketServerClient) Close() error {
@@ -249,18 +247,30 @@ func (client *WebSocketServerClient) Close() error {
 
 // 发信息给client
 func SendMessageBySelfID(selfID string, message map[string]interface{}) error {
+	return sendBySelfID(selfID, message)
+}
+
+// sendBySelfID 将任意可序列化的消息发给指定self_id的连接
+func sendBySelfID(selfID string, message interface{}) error {
+	client := findClient(selfID)
+	if client == nil {
+		return fmt.Errorf("no connection found for selfID: %s", selfID)
+	}
+	msgBytes, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error marshalling message: %v", err)
+	}
+	return client.write(msgBytes)
+}
+
+// findClient 返回self_id对应的连接,只在查找时持有lock,写入不阻塞其他连接
+func findClient(selfID string) *WebSocketServerClient {
 	lock.Lock()
 	defer lock.Unlock()
-
 	for _, client := range clients {
 		if client.SelfID == selfID {
-			msgBytes, err := json.Marshal(message)
-			if err != nil {
-				return fmt.Errorf("error marshalling message: %v", err)
-			}
-			return client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+			return client
 		}
 	}
-
-	return fmt.Errorf("no connection found for selfID: %s", selfID)
+	return nil
 }
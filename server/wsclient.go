@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/structs"
+)
+
+// StartReverseWsClients 为每个配置的onebot ws地址启动一个主动连接的客户端
+func StartReverseWsClients(conf *config.Config) {
+	for _, target := range config.GetReverseWs() {
+		if target.URL == "" {
+			continue
+		}
+		go runReverseWsClient(target, conf)
+	}
+}
+
+// runReverseWsClient 保持与目标地址的连接,断线后按指数退避重连
+func runReverseWsClient(target structs.ReverseWsTarget, conf *config.Config) {
+	initial := time.Duration(config.GetReconnectInterval()) * time.Second
+	maxInterval := time.Duration(config.GetReconnectMaxInterval()) * time.Second
+	interval := initial
+
+	for {
+		connectedAt := time.Now()
+		err := dialAndServe(target, conf)
+		// 连接维持得足够久,说明不是连续失败,重置退避间隔
+		if time.Since(connectedAt) > maxInterval {
+			interval = initial
+		}
+		fmt.Printf("主动连接[%s]已断开: %v, %v后重连\n", target.URL, err, interval)
+		time.Sleep(interval)
+
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// dialAndServe 连接目标地址并注册到clients,阻塞直到连接断开
+func dialAndServe(target structs.ReverseWsTarget, conf *config.Config) error {
+	header := http.Header{}
+	if target.Token != "" {
+		header.Set("Authorization", "Bearer "+target.Token)
+	}
+	if target.SelfID != "" {
+		header.Set("X-Self-ID", target.SelfID)
+	}
+	header.Set("X-Client-Role", "Universal")
+
+	conn, _, err := websocket.DefaultDialer.Dial(target.URL, header)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %v", target.URL, err)
+	}
+	defer conn.Close()
+	fmt.Printf("主动连接[%s]成功,X-Self-ID[%v]\n", target.URL, target.SelfID)
+
+	client := &WebSocketServerClient{
+		SelfID: target.SelfID,
+		Conn:   conn,
+	}
+	addClient(client)
+
+	return readLoop(client, conf)
+}
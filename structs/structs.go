@@ -1,10 +1,36 @@
 package structs
 
+import "encoding/json"
+
 type AccessToken struct {
 	SelfID string `yaml:"self_id"`
 	Token  string `yaml:"token"`
 }
 
+// ReverseWsTarget 描述一个需要本程序主动连接的onebot v11 ws地址
+type ReverseWsTarget struct {
+	URL    string `yaml:"url"`
+	Token  string `yaml:"token"`
+	SelfID string `yaml:"self_id"`
+}
+
+// QRPolicy 根据二维码内容决定放行还是撤回,先匹配放行规则,再匹配撤回规则,群规则先于全局规则匹配
+// 撤回规则可以用 "规则 => 处罚" 指定命中后的处罚,如 "evil.com => ban:10"
+type QRPolicy struct {
+	AllowDomains  []string `yaml:"allow_domains"`
+	DenyDomains   []string `yaml:"deny_domains"`
+	AllowPrefixes []string `yaml:"allow_prefixes"`
+	DenyPrefixes  []string `yaml:"deny_prefixes"`
+	AllowRegex    []string `yaml:"allow_regex"`
+	DenyRegex     []string `yaml:"deny_regex"`
+	AllowSchemes  []string `yaml:"allow_schemes"`
+	DenySchemes   []string `yaml:"deny_schemes"`
+	// Default 未匹配任何规则时的处理 withdraw/allow
+	Default string `yaml:"default"`
+	// Undecoded 只检测到二维码特征但无法解码内容时的处理 withdraw/allow
+	Undecoded string `yaml:"undecoded"`
+}
+
 type Settings struct {
 	Port                    string        `yaml:"port"`
 	WsPath                  string        `yaml:"wspath"`
@@ -22,6 +48,87 @@ type Settings struct {
 	SetGroupKick            bool          `yaml:"set_group_kick"`
 	KickAndRejectAddRequest bool          `yaml:"kick_and_reject_add_request"`
 	WithdrawWords           []string      `yaml:"withdraw_words"`
+
+	ReverseWs            []ReverseWsTarget `yaml:"reverse_ws"`
+	ReconnectInterval    int               `yaml:"reconnect_interval"`
+	ReconnectMaxInterval int               `yaml:"reconnect_max_interval"`
+	ActionTimeout        int               `yaml:"action_timeout"`
+
+	VideoWorkers    int    `yaml:"video_workers"`
+	VideoQueueSize  int    `yaml:"video_queue_size"`
+	ImageWorkers    int    `yaml:"image_workers"`
+	ImageQueueSize  int    `yaml:"image_queue_size"`
+	QueueFullPolicy string `yaml:"queue_full_policy"`
+	EventWorkers    int    `yaml:"event_workers"`
+	EventQueueSize  int    `yaml:"event_queue_size"`
+
+	PhashEnabled       bool   `yaml:"phash_enabled"`
+	PhashThreshold     int    `yaml:"phash_threshold"`
+	PhashAddCommand    string `yaml:"phash_add_command"`
+	PhashRemoveCommand string `yaml:"phash_remove_command"`
+
+	QRPolicy       QRPolicy            `yaml:"qr_policy"`
+	QRPolicyGroups map[string]QRPolicy `yaml:"qr_policy_groups"`
+
+	BarcodeFormats []string `yaml:"barcode_formats"`
+
+	SunCodeEnabled   bool    `yaml:"suncode_enabled"`
+	SunCodeThreshold float64 `yaml:"suncode_threshold"`
+
+	QRWithdrawThreshold float64 `yaml:"qr_withdraw_threshold"`
+	// 用指针区分未配置和配置为0,0表示关闭复核
+	QRReviewThreshold *float64 `yaml:"qr_review_threshold"`
+
+	MaxVideoSizeMB  int `yaml:"max_video_size_mb"`
+	MaxImageSizeMB  int `yaml:"max_image_size_mb"`
+	DownloadTimeout int `yaml:"download_timeout"`
+
+	FFmpegPath            string `yaml:"ffmpeg_path"`
+	WithdrawWithoutFrames bool   `yaml:"withdraw_without_frames"`
+
+	FrameSampling       string  `yaml:"frame_sampling"`
+	FrameFPS            float64 `yaml:"frame_fps"`
+	FrameSceneThreshold float64 `yaml:"frame_scene_threshold"`
+	FrameEdgeSeconds    float64 `yaml:"frame_edge_seconds"`
+	FrameCount          int     `yaml:"frame_count"`
+	FrameMax            int     `yaml:"frame_max"`
+
+	ScanWorkers        int    `yaml:"scan_workers"`
+	VideoScanTimeout   int    `yaml:"video_scan_timeout"`
+	InconclusiveAction string `yaml:"inconclusive_action"`
+
+	QRSearchProfile string `yaml:"qr_search_profile"`
+
+	RecordEvents string `yaml:"record_events"`
+
+	ShadowMode        bool     `yaml:"shadow_mode"`
+	ShadowGroups      []string `yaml:"shadow_groups"`
+	ShadowReportGroup string   `yaml:"shadow_report_group"`
+
+	ReviewGroup          string   `yaml:"review_group"`
+	ReviewUsers          []string `yaml:"review_users"`
+	ReviewApproveCommand string   `yaml:"review_approve_command"`
+	ReviewRejectCommand  string   `yaml:"review_reject_command"`
+	ReviewExpireMinutes  int      `yaml:"review_expire_minutes"`
+
+	PunishLadder     []string `yaml:"punish_ladder"`
+	PunishDecayHours int      `yaml:"punish_decay_hours"`
+
+	RaidThreshold     int    `yaml:"raid_threshold"`
+	RaidWindowSeconds int    `yaml:"raid_window_seconds"`
+	RaidMuteMinutes   int    `yaml:"raid_mute_minutes"`
+	UnmuteCommand     string `yaml:"unmute_command"`
+	AdminToken        string `yaml:"admin_token"`
+
+	VideoCheck bool `yaml:"video_check"`
+	ImageCheck bool `yaml:"image_check"`
+
+	CommandPrefix string   `yaml:"command_prefix"`
+	SuperUsers    []string `yaml:"super_users"`
+	StatusCommand string   `yaml:"status_command"`
+	HelpCommand   string   `yaml:"help_command"`
+	SetCommand    string   `yaml:"set_command"`
+	UnsetCommand  string   `yaml:"unset_command"`
 }
 
 // Message represents a standardized structure for the incoming messages.
@@ -31,6 +138,30 @@ type Message struct {
 	Echo   interface{}            `json:"echo,omitempty"`
 }
 
+// ActionResponse 是onebot对带echo的action调用返回的响应
+type ActionResponse struct {
+	Status  string          `json:"status"`
+	Retcode int             `json:"retcode"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message,omitempty"`
+	Wording string          `json:"wording,omitempty"`
+	Echo    interface{}     `json:"echo"`
+}
+
+// GroupMemberInfo 是get_group_member_info返回的群成员信息
+type GroupMemberInfo struct {
+	GroupID         int64  `json:"group_id"`
+	UserID          int64  `json:"user_id"`
+	Nickname        string `json:"nickname"`
+	Card            string `json:"card"`
+	Role            string `json:"role"`
+	Level           string `json:"level"`
+	Title           string `json:"title"`
+	JoinTime        int64  `json:"join_time"`
+	LastSentTime    int64  `json:"last_sent_time"`
+	ShutUpTimestamp int64  `json:"shut_up_timestamp"`
+}
+
 type MessageEvent struct {
 	PostType    string      `json:"post_type"`
 	MessageType string      `json:"message_type"`
@@ -14,13 +14,104 @@ settings:
   set_group_kick : false                        #检测到符合条件的视频在撤回后踢掉发送者.
   kick_and_reject_add_request : false           #踢掉后禁止再次加群
   qr_limit : 1                                  #逐帧检查视频,包含1帧二维码就撤回.
+  ffmpeg_path : ""                              #ffmpeg路径,为空时依次查找程序目录下的ffmpeg/ffmpeg、ffmpeg和环境变量PATH
+  withdraw_without_frames : false               #没有ffmpeg且视频无法用内置方式抽帧(如H.264)时,按视频长度直接撤回短视频
+  frame_sampling : "fps"                        #抽帧策略 fps固定帧率 scene画面变化 edges只看开头和结尾 count均匀抽取固定帧数 adaptive按视频长度自动选择
+  frame_fps : 1                                 #fps和edges策略每秒抽取的帧数
+  frame_scene_threshold : 0.3                   #scene策略画面变化阈值(0-1),越小抽取的帧越多
+  frame_edge_seconds : 3                        #edges策略检查开头和结尾各多少秒
+  frame_count : 8                               #count策略在整个视频中均匀抽取的帧数
+  frame_max : 60                                #单个视频最多检查的帧数,检测到二维码后会立即停止抽帧
+  scan_workers : 2                              #单个视频同时检测的帧数,达到qr_limit后立即停止其余帧
+  video_scan_timeout : 30                       #单个视频逐帧检测的时间上限(秒),超时视为无法判断
+  inconclusive_action : "review"                #超时无法判断时的处理 pass放行 withdraw撤回 review记录待复核
+  barcode_formats : ["qr_code"]                 #检测的条码格式,可选 qr_code data_matrix aztec,暂不支持pdf417
+  suncode_enabled : true                        #检测微信小程序码(圆形太阳码),图片和视频帧均生效
+  suncode_threshold : 0.75                      #小程序码置信度阈值(0-1),越高越不容易误判
+  qr_withdraw_threshold : 0.6                   #二维码置信度(0-1)达到该值时撤回,完整解码为1.0,仅有特征时得分较低
+  qr_review_threshold : 0.4                     #二维码置信度介于该值和撤回阈值之间时只记录待复核,不撤回;设为0关闭复核
+  qr_search_profile : "balanced"                #二维码搜索档位 fast只查整图和上下裁剪 balanced增加左右裁剪、分块和小图放大 thorough再增加细分块和对比度/二值化处理(最慢)
   withdraw_notice : "撤回了一条广告."                          #撤回广告时的回复.
-  on_enable_video_check : "视频广告撤回on"       #视频二维码广告撤回开启指令(默认关闭)需手动发指令开启
-  on_disable_video_check : "视频广告撤回off"     #视频二维码广告撤回关闭指令
-  on_enable_pic_check : "图片广告撤回on"         #图片二维码广告撤回开启指令(默认关闭)需手动发指令开启
-  on_disable_pic_check : "图片广告撤回off"       #图片二维码广告撤回关闭指令
-  withdraw_words : [""]                         #该配置无开关,请将你最讨厌的广告关键词放进去,比如"免费收徒\抖音引流\保证一天",检测到就会自动撤回
+  video_check : false                           #各群默认是否检测视频,群内可用指令单独开关
+  image_check : false                           #各群默认是否检测图片,群内可用指令单独开关
+  withdraw_words : [""]                         #该配置无开关,请将你最讨厌的广告关键词放进去,比如"免费收徒\抖音引流\保证一天",检测到就会自动撤回,可写成"免费收徒 => ban:10"指定命中后的处罚(warn, ban:分钟, kick, kick_reject)
   access_tokens:
   - self_id: ""
     token: ""
+
+  #主动连接(反向ws客户端)配置,用于本程序无法对外放通端口时,由本程序去连接onebotv11实现的正向ws地址
+  reverse_ws: []                                #示例: [{url: "ws://127.0.0.1:8080", token: "", self_id: "123456"}] self_id可空,将从事件中获取
+  reconnect_interval : 3                        #断线重连初始间隔(秒),每次失败后翻倍
+  reconnect_max_interval : 60                   #断线重连最大间隔(秒)
+  action_timeout : 10                           #通过ws调用撤回/踢人等action时,等待响应的超时时间(秒)
+  record_events : ""                            #把收到的onebot事件原样追加写入该文件(每行一条json),可用replay子命令回放排查,为空时不录制
+
+  #检测队列配置,防止刷屏时阻塞其它消息的检测
+  video_workers : 2                             #同时检测视频的数量(每个视频会启动一个ffmpeg)
+  video_queue_size : 32                         #等待检测的视频队列长度
+  image_workers : 4                             #同时检测图片的数量
+  image_queue_size : 64                         #等待检测的图片队列长度
+  queue_full_policy : "drop_newest"             #队列满时的策略 drop_newest丢弃新任务 drop_oldest丢弃最早的任务 block等待
+  event_workers : 16                            #同时处理的onebot事件数(关键词检测、群指令、提交检测任务)
+  event_queue_size : 256                        #等待处理的事件队列长度,满时丢弃新事件(读取连接不能等待,否则收不到action响应)
+
+  #媒体下载配置,先用HEAD/Range请求检查大小和类型,避免超大文件占满磁盘
+  max_video_size_mb : 64                        #视频超过该大小(MB)不下载,也不逐帧检测
+  max_image_size_mb : 10                        #图片超过该大小(MB)不下载
+  download_timeout : 60                         #下载单个文件的超时时间(秒)
+
+  #已知广告图黑名单,撤回过的图片/视频帧会记录感知哈希,相似的图片无需再识别二维码直接撤回
+  phash_enabled : true                          #是否启用
+  phash_threshold : 6                           #两张图哈希的汉明距离(0-64)不超过该值视为同一张图
+  phash_add_command : "广告图添加"               #管理员发送 指令+图片 或 指令+哈希 添加到黑名单
+  phash_remove_command : "广告图删除"            #管理员发送 指令+哈希 从黑名单删除
+
+  #违规阶梯处罚,按发送者在本群的违规次数逐级处罚,配置后代替set_group_kick
+  punish_ladder : []                            #如 ["warn", "ban:10", "kick", "kick_reject"] 依次为警告、禁言10分钟、踢出、踢出并拒绝再次加群,超出后按最后一级处理
+  punish_decay_hours : 72                       #每隔多少小时没有违规,违规次数减少一次
+
+  #群内指令,除帮助和检测状态外只有群主、管理员和super_users可以使用
+  command_prefix : ""                           #指令前缀,如 "/" 时需发送 /视频广告撤回on,为空时直接发送指令
+  super_users : []                              #在所有群都可以使用管理指令的QQ,如 ["10001"]
+  on_enable_video_check : "视频广告撤回on"       #开启本群视频二维码广告撤回
+  on_disable_video_check : "视频广告撤回off"     #关闭本群视频二维码广告撤回
+  on_enable_pic_check : "图片广告撤回on"         #开启本群图片二维码广告撤回
+  on_disable_pic_check : "图片广告撤回off"       #关闭本群图片二维码广告撤回
+  status_command : "检测状态"                    #查看本群的检测设置
+  help_command : "帮助"                          #列出可用的指令
+  set_command : "设置"                           #发送 指令+设置项+值 修改本群的一项设置,如"设置 video_second_limit 10",设置项见检测状态
+  unset_command : "恢复设置"                     #发送 指令+设置项 让本群的该项恢复使用config.yml中的值
+
+  #禁言,违规阶梯中的ban:分钟为单人禁言,短时间内大量撤回时开启全员禁言
+  raid_threshold : 0                            #raid_window_seconds秒内撤回达到该条数时视为刷屏,开启全员禁言,0为关闭
+  raid_window_seconds : 60                      #统计刷屏的时间窗口(秒)
+  raid_mute_minutes : 10                        #刷屏时全员禁言的分钟数,到期自动解除
+  unmute_command : "解除禁言"                    #群主或管理员发送 指令+@成员或QQ号 解除该成员禁言,只发指令时解除全员禁言
+  admin_token : ""                              #/mute、/mute/all、/group/settings和POST/DELETE /phash接口的token,请求头Authorization: Bearer <token>或参数access_token,为空时接口不可用
+
+  #影子模式,检测照常进行并记录判定,但不撤回也不踢人,用于在活跃的群里试运行新规则
+  shadow_mode : false                           #所有群都使用影子模式
+  shadow_groups : []                            #只对这些群使用影子模式,如 ["123456"],群内未开启图片/视频检测时也会检测
+  shadow_report_group : ""                      #把影子模式下本应执行的撤回/踢人发到该群,为空时只写日志
+
+  #人工复核,置信度介于复核阈值和撤回阈值之间等无法确定的消息先不撤回,转发给管理员决定
+  review_group : ""                             #接收待复核消息的管理群,为空且review_users为空时只写日志
+  review_users : []                             #私聊接收待复核消息的管理员QQ,如 ["10001"]
+  review_approve_command : "通过"                #在管理群或私聊中发送 指令+编号 撤回该消息(配置了踢人时同时踢出),只发指令时列出待复核消息
+  review_reject_command : "驳回"                 #发送 指令+编号 放行该消息
+  review_expire_minutes : 60                    #待复核消息的有效期(分钟),超过后消息已无法撤回,自动丢弃
+
+  #二维码内容规则,先匹配allow放行规则,再匹配deny撤回规则,都未匹配时按default处理
+  qr_policy:
+    allow_domains : []                          #放行的域名(含子域名),如 ["qq.com"]
+    deny_domains : []                           #撤回的域名(含子域名),撤回规则都可写成"evil.com => ban:10"指定命中后的处罚
+    allow_prefixes : []                         #放行的内容前缀,如本群收款码 ["wxp://f2f0xxxx"]
+    deny_prefixes : []                          #撤回的内容前缀
+    allow_regex : []                            #放行的正则
+    deny_regex : []                             #撤回的正则
+    allow_schemes : []                          #放行的协议,如 ["alipays", "weixin", "wxp"]
+    deny_schemes : []                           #撤回的协议
+    default : "withdraw"                        #未匹配任何规则时 withdraw撤回 allow放行
+    undecoded : "withdraw"                      #检测到二维码但无法解码内容时 withdraw撤回 allow放行
+  qr_policy_groups: {}                          #按群设置规则,先于全局规则匹配,可以放行或撤回全局规则的结果,如 {"123456": {deny_domains: ["qq.com"], default: "allow"}}
 `
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+)
+
+// Capability 是一项检测能力及其在当前环境下是否可用
+type Capability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Detail    string `json:"detail"`
+}
+
+// Capabilities 检查当前环境实际可用的检测能力
+func Capabilities() []Capability {
+	var caps []Capability
+
+	ffmpegPath := media.FFmpegPath()
+	ffmpegDetail := ffmpegPath
+	if ffmpegPath == "" {
+		ffmpegDetail = "未找到ffmpeg,H.264视频只检测关键帧,H.265视频无法逐帧检测"
+		if config.GetWithdrawWithoutFrames() {
+			ffmpegDetail += ",将按视频长度直接撤回短视频"
+		}
+	}
+	caps = append(caps, Capability{Name: "ffmpeg", Available: ffmpegPath != "", Detail: ffmpegDetail})
+	sampling := config.GetFrameSampling()
+	samplingDetail := sampling
+	if !media.ValidSampling(sampling) {
+		samplingDetail = fmt.Sprintf("未知的抽帧策略[%s],使用fps", sampling)
+	}
+	caps = append(caps, Capability{Name: "sampling", Available: media.ValidSampling(sampling), Detail: samplingDetail})
+	caps = append(caps, Capability{Name: "h264", Available: true, Detail: "内置,解码H.264视频的关键帧(8位4:2:0逐行)"})
+	caps = append(caps, Capability{Name: "mjpeg", Available: true, Detail: "内置,直接取出MJPEG视频中的JPEG帧"})
+	caps = append(caps, Capability{Name: "cover_art", Available: true, Detail: "内置,检查视频封面图"})
+
+	formats := ""
+	for _, sym := range enabledSymbologies() {
+		if formats != "" {
+			formats += ","
+		}
+		formats += sym.format.String()
+	}
+	caps = append(caps, Capability{Name: "barcode", Available: formats != "", Detail: formats})
+	profile := config.GetQRSearchProfile()
+	profileDetail := profile
+	if !ValidSearchProfile(profile) {
+		profileDetail = fmt.Sprintf("未知的搜索档位[%s],使用balanced", profile)
+	}
+	caps = append(caps, Capability{Name: "qr_search", Available: ValidSearchProfile(profile), Detail: profileDetail})
+	caps = append(caps, Capability{Name: "suncode", Available: config.GetSunCodeEnabled(), Detail: fmt.Sprintf("threshold %.2f", config.GetSunCodeThreshold())})
+	caps = append(caps, Capability{Name: "phash", Available: config.GetPhashEnabled(), Detail: fmt.Sprintf("threshold %d", config.GetPhashThreshold())})
+	return caps
+}
+
+// ReportCapabilities 启动时打印可用的检测能力
+func ReportCapabilities() {
+	fmt.Println("检测能力:")
+	for _, c := range Capabilities() {
+		status := "可用"
+		if !c.Available {
+			status = "不可用"
+		}
+		fmt.Printf("  %-10s %s %s\n", c.Name, status, c.Detail)
+	}
+}
@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/disintegration/imaging"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode/detector"
+)
+
+// QRResult 是图片二维码(及其它已启用条码格式)检测的结果
+type QRResult struct {
+	// Found 表示置信度达到撤回阈值
+	Found bool
+	// Review 表示置信度介于复核阈值和撤回阈值之间,需要人工确认
+	Review bool
+	// Score 是合并各项证据后的置信度(0-1)
+	Score float64
+	// Evidence 是得分的证据来源,如 decoded、finder_patterns
+	Evidence []string
+	// Text 是解码出的二维码内容,只检测到二维码特征而无法解码时为空
+	Text string
+	// Format 是命中的条码格式,如 QR_CODE、DATA_MATRIX
+	Format string
+}
+
+// 各类证据的置信度,同类证据在不同裁剪中取最高分,不同类证据按 1-Π(1-s) 合并
+const (
+	EvidenceDecoded        = "decoded"         // 完整解码
+	EvidenceErrorHint      = "error_hint"      // 定位成功但格式、校验或纠错失败
+	EvidenceFinderPatterns = "finder_patterns" // 找到位置合理的定位图案
+	EvidenceBoundary       = "boundary"        // 纯条码模式下找到了边界
+	EvidenceSunCode        = "suncode"         // 按形状识别的小程序码
+
+	scoreDecoded        = 1.0
+	scoreFinderPatterns = 0.7 // 三个定位图案位置合理且定位图案之间的时序图案黑白交替
+	scorePartialFinder  = 0.2 // 三个定位图案位置合理,但时序图案对不上
+	scoreErrorHint      = 0.2 // 纹理丰富的照片也常出现,单独不足以进入复核
+	scoreBoundary       = 0.2
+)
+
+// qrEvidence 记录每类证据的最高分及对应格式
+type qrEvidence struct {
+	scores  map[string]float64
+	formats map[string]string
+}
+
+func (e *qrEvidence) add(kind, format string, score float64) {
+	if score <= e.scores[kind] {
+		return
+	}
+	e.scores[kind] = score
+	e.formats[kind] = format
+}
+
+// combine 合并各项证据,返回总分和得分最高的证据对应的格式
+func (e *qrEvidence) combine() (float64, string, []string) {
+	miss := 1.0
+	best, format := 0.0, ""
+	var evidence []string
+	for kind, score := range e.scores {
+		miss *= 1 - score
+		if score > best {
+			best, format = score, e.formats[kind]
+		}
+		evidence = append(evidence, fmt.Sprintf("%s:%.2f", kind, score))
+	}
+	sort.Strings(evidence)
+	return math.Round((1-miss)*100) / 100, format, evidence
+}
+
+func ContainsQRCode(framePath string) bool {
+	return ScanQRCode(framePath).Found
+}
+
+// ScanQRCode 检测图片中的二维码,给出置信度并尽可能解码出内容
+func ScanQRCode(framePath string) QRResult {
+	return ScanQRCodeContext(context.Background(), framePath)
+}
+
+// ScanQRCodeContext 同ScanQRCode,ctx取消时不再尝试其余裁剪,按已有证据给出结果
+func ScanQRCodeContext(ctx context.Context, framePath string) QRResult {
+	var result QRResult
+	file, err := os.Open(framePath)
+	if err != nil {
+		log.Printf("Failed to open frame file: %v", err)
+		return result
+	}
+	defer file.Close()
+
+	img, err := imaging.Decode(file)
+	if err != nil {
+		log.Printf("Failed to decode image: %v", err)
+		return result
+	}
+
+	// 图像预处理：转换为灰度图像
+	grayImg := imaging.Grayscale(img)
+
+	// 按搜索档位依次检查各个区域,解码出内容立即返回,只检测到特征时累积证据并继续尝试其它区域
+	evidence := &qrEvidence{scores: map[string]float64{}, formats: map[string]string{}}
+	symbologies := enabledSymbologies()
+	var decoded *QRResult
+	currentSearchProfile().candidates(grayImg, func(candidate *image.NRGBA, label string) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		source, err := luminanceSource(candidate)
+		if err != nil {
+			log.Printf("Failed to create luminance source: %v", err)
+			return true
+		}
+		for _, sym := range symbologies {
+			pureKind, text := tryDecodeBarcode(source, sym)
+			kind := pureKind
+			if kind != EvidenceDecoded {
+				kind, text = detectBarcodePresence(source, sym)
+			}
+			if kind == EvidenceDecoded {
+				log.Printf("%s decoded in region %s.", sym.format, label)
+				decoded = &QRResult{Score: scoreDecoded, Evidence: []string{EvidenceDecoded}, Text: text, Format: sym.format.String()}
+				return false
+			}
+			for _, k := range []string{pureKind, kind} {
+				if k != "" {
+					evidence.add(k, sym.format.String(), hintScore(k))
+				}
+			}
+			if sym.format == gozxing.BarcodeFormat_QR_CODE {
+				if score := findFinderPatterns(source); score > 0 {
+					evidence.add(EvidenceFinderPatterns, sym.format.String(), score)
+				}
+			}
+		}
+		return true
+	})
+	if decoded != nil {
+		return finishQRResult(*decoded)
+	}
+
+	result.Score, result.Format, result.Evidence = evidence.combine()
+
+	// 小程序码无法解码,只在其它格式未达到撤回阈值时按形状识别
+	if result.Score < config.GetQRWithdrawThreshold() && config.GetSunCodeEnabled() && ctx.Err() == nil {
+		score := DetectSunCode(img)
+		if score >= config.GetSunCodeThreshold() {
+			log.Printf("%s detected, score %.2f.", SunCodeFormat, score)
+			evidence.add(EvidenceSunCode, SunCodeFormat, score)
+			result.Score, result.Format, result.Evidence = evidence.combine()
+		}
+	}
+
+	return finishQRResult(result)
+}
+
+// finishQRResult 按阈值判定撤回或复核
+func finishQRResult(result QRResult) QRResult {
+	withdraw := config.GetQRWithdrawThreshold()
+	result.Found = result.Score >= withdraw
+	review := config.GetQRReviewThreshold()
+	result.Review = !result.Found && review > 0 && result.Score >= review
+	if result.Score > 0 {
+		log.Printf("%s score %.2f %v found=%v review=%v", result.Format, result.Score, result.Evidence, result.Found, result.Review)
+	}
+	return result
+}
+
+// hintScore 返回错误信息类证据的置信度
+func hintScore(kind string) float64 {
+	switch kind {
+	case EvidenceErrorHint:
+		return scoreErrorHint
+	case EvidenceBoundary:
+		return scoreBoundary
+	}
+	return 0
+}
+
+// findFinderPatterns 查找二维码的三个定位图案并校验其几何关系和时序图案
+// 纹理丰富的照片中也能找到类似定位图案的结构,因此只有时序图案吻合时才给出较高分数
+func findFinderPatterns(source gozxing.LuminanceSource) float64 {
+	bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		return 0
+	}
+	matrix, err := bmp.GetBlackMatrix()
+	if err != nil {
+		return 0
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	info, err := detector.NewFinderPatternFinder(matrix, nil).Find(hints)
+	if err != nil {
+		return 0
+	}
+
+	tl, tr, bl := info.GetTopLeft(), info.GetTopRight(), info.GetBottomLeft()
+	dTop := gozxing.ResultPoint_Distance(tl, tr)
+	dLeft := gozxing.ResultPoint_Distance(tl, bl)
+	if dTop == 0 || dLeft == 0 {
+		return 0
+	}
+	// 两条边长度相近且接近直角
+	if ratio := dTop / dLeft; ratio < 0.8 || ratio > 1.25 {
+		return 0
+	}
+	cos := ((tr.GetX()-tl.GetX())*(bl.GetX()-tl.GetX()) + (tr.GetY()-tl.GetY())*(bl.GetY()-tl.GetY())) / (dTop * dLeft)
+	if math.Abs(cos) > 0.2 {
+		return 0
+	}
+	// 三个定位图案的模块大小应当一致
+	sizes := []float64{tl.GetEstimatedModuleSize(), tr.GetEstimatedModuleSize(), bl.GetEstimatedModuleSize()}
+	minSize, maxSize := sizes[0], sizes[0]
+	for _, size := range sizes[1:] {
+		minSize = math.Min(minSize, size)
+		maxSize = math.Max(maxSize, size)
+	}
+	if maxSize > minSize*1.5 {
+		return 0
+	}
+
+	moduleSize := (sizes[0] + sizes[1] + sizes[2]) / 3
+	dimension := int(math.Round((dTop+dLeft)/2/moduleSize)) + 7
+	switch dimension & 0x03 {
+	case 0:
+		dimension++
+	case 2:
+		dimension--
+	case 3:
+		dimension -= 2
+	}
+	if dimension < 21 {
+		return 0
+	}
+
+	if timingPatternMatches(matrix, tl, tr, bl, dimension) {
+		return scoreFinderPatterns
+	}
+	return scorePartialFinder
+}
+
+// timingPatternMatches 检查第6行和第6列的时序图案是否黑白交替
+func timingPatternMatches(matrix *gozxing.BitMatrix, tl, tr, bl gozxing.ResultPoint, dimension int) bool {
+	// 定位图案中心位于模块坐标(3.5,3.5),两个定位图案中心相距 dimension-7 个模块
+	span := float64(dimension - 7)
+	ux, uy := (tr.GetX()-tl.GetX())/span, (tr.GetY()-tl.GetY())/span
+	vx, vy := (bl.GetX()-tl.GetX())/span, (bl.GetY()-tl.GetY())/span
+	sample := func(col, row int) (bool, bool) {
+		dx, dy := float64(col)-3, float64(row)-3
+		x := int(math.Round(tl.GetX() + dx*ux + dy*vx))
+		y := int(math.Round(tl.GetY() + dx*uy + dy*vy))
+		if x < 0 || y < 0 || x >= matrix.GetWidth() || y >= matrix.GetHeight() {
+			return false, false
+		}
+		return matrix.Get(x, y), true
+	}
+
+	total, matched := 0, 0
+	for i := 8; i <= dimension-9; i++ {
+		for _, pos := range [][2]int{{i, 6}, {6, i}} {
+			dark, ok := sample(pos[0], pos[1])
+			if !ok {
+				continue
+			}
+			total++
+			if dark == (i%2 == 0) {
+				matched++
+			}
+		}
+	}
+	return total >= 4 && float64(matched) >= float64(total)*0.8
+}
+
+// 尝试按指定格式解码,返回证据类型及解码出的内容
+func tryDecodeBarcode(source gozxing.LuminanceSource, sym symbology) (string, string) {
+	bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		log.Printf("Failed to create binary bitmap: %v", err)
+		return "", ""
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER:       true,
+		gozxing.DecodeHintType_PURE_BARCODE:     true, // 假设图像是纯粹的二维码
+		gozxing.DecodeHintType_POSSIBLE_FORMATS: []gozxing.BarcodeFormat{sym.format},
+	}
+	decoded, err := sym.newReader().Decode(bmp, hints)
+	if err != nil {
+		// 检查错误消息中是否包含边界信息
+		if matchBoundaryInfo(err.Error()) {
+			log.Printf("%s boundaries detected: %v", sym.format, err)
+			return EvidenceBoundary, ""
+		}
+		log.Printf("Failed to decode %s: %v", sym.format, err)
+		return "", ""
+	}
+
+	return EvidenceDecoded, decoded.GetText()
+}
+
+// 检测错误信息中是否含有可能表示二维码存在的信息
+func matchQRCodeErrorInfo(errorMessage string) bool {
+	// 匹配可能表示二维码部分成功识别的错误消息
+	var re = regexp.MustCompile(`FormatException|ChecksumException|ReedSolomonException`)
+	return re.MatchString(errorMessage)
+}
+
+// detectBarcodePresence tries to detect a barcode of the given symbology and returns the evidence kind and its text when decodable.
+func detectBarcodePresence(source gozxing.LuminanceSource, sym symbology) (string, string) {
+	var zz gozxing.GlobalHistogramBinarizer
+	binarizer := zz.CreateBinarizer(source)
+	bmp, err := gozxing.NewBinaryBitmap(binarizer)
+	if err != nil {
+		log.Printf("Failed to create binary bitmap: %v", err)
+		return "", ""
+	}
+
+	decoded, err := sym.newReader().Decode(bmp, nil)
+	if err != nil {
+		log.Printf("Failed to detect %s: %v", sym.format, err)
+		// 检查错误信息是否包含可能表明条码存在的信息
+		if matchQRCodeErrorInfo(err.Error()) {
+			log.Printf("Potential %s features detected despite the error: %v", sym.format, err)
+			return EvidenceErrorHint, ""
+		}
+		return "", ""
+	}
+
+	log.Printf("%s successfully detected.", sym.format)
+	return EvidenceDecoded, decoded.GetText()
+}
+
+// 检测错误信息中是否含有边界位置信息
+func matchBoundaryInfo(errorMessage string) bool {
+	// 正则表达式匹配类似 "(left,right)=(287,241), (top,bottom)=(44,1022)" 的信息
+	re := regexp.MustCompile(`\(left,right\)=\((\d+),(\d+)\), \(top,bottom\)=\((\d+),(\d+)\)`)
+	return re.MatchString(errorMessage)
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/template"
+)
+
+var (
+	update   = flag.Bool("update", false, "rewrite golden files in testdata")
+	profiles = flag.Bool("profiles", false, "also run the corpus with the thorough search profile")
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// gozxing每次解码失败都会打印日志,测试时只看结果
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// useConfig 加载默认配置模板,并按overrides替换其中的配置项
+func useConfig(t *testing.T, overrides map[string]string) {
+	t.Helper()
+	content := template.ConfigTemplate
+	for key, value := range overrides {
+		re := regexp.MustCompile(`(?m)^(\s*` + regexp.QuoteMeta(key) + `\s*:\s*)\S+`)
+		if !re.MatchString(content) {
+			t.Fatalf("config template has no %s", key)
+		}
+		content = re.ReplaceAllString(content, "${1}"+value)
+	}
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkGolden 比较输出与testdata中的golden文件,-update时改为重写golden文件
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// TestQRCorpus 在合成图片上运行二维码检测,逐张结果和准确率/召回率记录在golden文件中
+// 检测逻辑改动后用 -update 重新生成golden文件,通过diff判断改动的效果
+func TestQRCorpus(t *testing.T) {
+	dir := t.TempDir()
+	cases := corpus.Images()
+	paths := make([]string, len(cases))
+	for i, c := range cases {
+		path, err := c.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[i] = path
+	}
+
+	run := []string{"fast", "balanced"}
+	if *profiles {
+		run = append(run, "thorough")
+	}
+	for _, profile := range run {
+		t.Run(profile, func(t *testing.T) {
+			useConfig(t, map[string]string{"qr_search_profile": `"` + profile + `"`})
+			var out bytes.Buffer
+			var tally corpus.Tally
+			start := time.Now()
+			for i, c := range cases {
+				result := ScanQRCode(paths[i])
+				tally.Add(c.QR, result.Found)
+				format := result.Format
+				if format == "" {
+					format = "-"
+				}
+				fmt.Fprintf(&out, "%-24s qr=%-5v found=%-5v review=%-5v score=%.2f %s\n",
+					c.Name, c.QR, result.Found, result.Review, result.Score, format)
+			}
+			fmt.Fprintf(&out, "%s\n", tally)
+			t.Logf("%s: %s in %v", profile, tally, time.Since(start).Round(time.Millisecond))
+			checkGolden(t, "qrcode_"+profile+".golden", out.Bytes())
+		})
+	}
+}
+
+func TestContainsQRCode(t *testing.T) {
+	useConfig(t, nil)
+	dir := t.TempDir()
+	for _, c := range corpus.Images() {
+		if c.Name != "qr_center" && c.Name != "gradient" {
+			continue
+		}
+		path, err := c.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ContainsQRCode(path); got != c.QR {
+			t.Errorf("%s: ContainsQRCode = %v, want %v", c.Name, got, c.QR)
+		}
+	}
+}
+
+// TestQRReviewThreshold qr_review_threshold为0时关闭复核,低分结果也不进入复核
+func TestQRReviewThreshold(t *testing.T) {
+	cases := []struct {
+		threshold string
+		score     float64
+		review    bool
+	}{
+		{"0.4", 0.5, true},
+		{"0.4", 0.3, false},
+		{"0", 0.5, false},
+		{"0", 0, false},
+	}
+	for _, c := range cases {
+		useConfig(t, map[string]string{"qr_review_threshold": c.threshold})
+		result := finishQRResult(QRResult{Score: c.score})
+		if result.Found || result.Review != c.review {
+			t.Errorf("qr_review_threshold=%s score=%.1f: found=%v review=%v, want review=%v",
+				c.threshold, c.score, result.Found, result.Review, c.review)
+		}
+	}
+}
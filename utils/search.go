@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/makiuchi-d/gozxing"
+)
+
+// searchProfile 决定在图片的哪些区域、以什么尺度和预处理方式查找二维码
+type searchProfile struct {
+	// bands 是上下裁剪的比例
+	bands []cropRatio
+	// columns 为true时额外尝试左右裁剪,用于宽海报
+	columns bool
+	// grid 大于0时把图片切成 grid×grid 块,相邻块重叠一半,用于角落里的小二维码
+	grid int
+	// upscale 大于0时把短边小于该值的区域放大到该值,太小的二维码模块不足以被识别
+	upscale int
+	// variants 为true时对每个区域再尝试增强对比度和Otsu二值化两种预处理
+	variants bool
+}
+
+type cropRatio struct {
+	top    float32
+	bottom float32
+}
+
+// 原有的上下裁剪区域
+var verticalBands = []cropRatio{
+	{0.0, 0.0}, // 完整图像
+	{0.2, 0.0}, // 上方裁剪20%，下方不裁剪
+	{0.3, 0.0}, // 上方裁剪30%，下方不裁剪
+	{0.4, 0.0}, // 上方裁剪40%，下方不裁剪
+	{0.0, 0.2}, // 上方不裁剪，下方裁剪20%
+	{0.0, 0.3}, // 上方不裁剪，下方裁剪30%
+	{0.0, 0.4}, // 上方不裁剪，下方裁剪40%
+	{0.1, 0.1}, // 上下都裁剪
+	{0.2, 0.2}, // 上下都裁剪
+	{0.3, 0.3}, // 上下都裁剪
+	{0.4, 0.4}, // 上下都裁剪
+	{0.5, 0.5}, // 上下都裁剪
+}
+
+var searchProfiles = map[string]searchProfile{
+	// fast 只尝试完整图像和几个主要的上下裁剪
+	"fast": {
+		bands: []cropRatio{{0.0, 0.0}, {0.4, 0.0}, {0.0, 0.4}, {0.2, 0.2}},
+	},
+	// balanced 在原有裁剪的基础上增加左右裁剪、2×2分块和小图放大
+	"balanced": {
+		bands:   verticalBands,
+		columns: true,
+		grid:    2,
+		upscale: 600,
+	},
+	// thorough 增加3×3分块和对比度/二值化预处理,耗时约为balanced的数倍
+	"thorough": {
+		bands:    verticalBands,
+		columns:  true,
+		grid:     3,
+		upscale:  1000,
+		variants: true,
+	},
+}
+
+// currentSearchProfile 返回配置的搜索档位,未知的档位按balanced处理
+func currentSearchProfile() searchProfile {
+	name := strings.ToLower(config.GetQRSearchProfile())
+	if profile, ok := searchProfiles[name]; ok {
+		return profile
+	}
+	return searchProfiles["balanced"]
+}
+
+// ValidSearchProfile 报告搜索档位名是否有效
+func ValidSearchProfile(name string) bool {
+	_, ok := searchProfiles[strings.ToLower(name)]
+	return ok
+}
+
+// regions 返回需要检查的区域,按从大到小的顺序,整图最先检查
+func (p searchProfile) regions(bounds image.Rectangle) []image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	var rects []image.Rectangle
+	add := func(r image.Rectangle) {
+		r = r.Add(bounds.Min).Intersect(bounds)
+		if r.Dx() < 16 || r.Dy() < 16 {
+			return
+		}
+		for _, existing := range rects {
+			if existing == r {
+				return
+			}
+		}
+		rects = append(rects, r)
+	}
+
+	for _, band := range p.bands {
+		top := int(float32(h) * band.top)
+		bottom := int(float32(h) * band.bottom)
+		add(image.Rect(0, top, w, h-bottom))
+	}
+	if p.columns {
+		for _, ratio := range []float32{0.5, 0.3} {
+			cut := int(float32(w) * ratio)
+			add(image.Rect(cut, 0, w, h))   // 裁掉左侧
+			add(image.Rect(0, 0, w-cut, h)) // 裁掉右侧
+		}
+	}
+	for n := 2; n <= p.grid; n++ {
+		tileW, tileH := 2*w/(n+1), 2*h/(n+1)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				x, y := j*w/(n+1), i*h/(n+1)
+				add(image.Rect(x, y, x+tileW, y+tileH))
+			}
+		}
+	}
+	return rects
+}
+
+// candidates 依次产出待检测的图像,yield返回false时停止
+// 先检查区域原图,小区域再检查放大后的版本,预处理基于最后一个版本
+func (p searchProfile) candidates(gray *image.NRGBA, yield func(img *image.NRGBA, label string) bool) {
+	for _, rect := range p.regions(gray.Bounds()) {
+		region := imaging.Crop(gray, rect)
+		label := fmt.Sprintf("%dx%d+%d+%d", rect.Dx(), rect.Dy(), rect.Min.X, rect.Min.Y)
+		if !yield(region, label) {
+			return
+		}
+		if scale := p.upscaleFactor(rect.Dx(), rect.Dy()); scale > 0 {
+			region = imaging.Resize(region, int(float64(rect.Dx())*scale), 0, imaging.Linear)
+			label += fmt.Sprintf("@%.1fx", scale)
+			if !yield(region, label) {
+				return
+			}
+		}
+		if !p.variants {
+			continue
+		}
+		if !yield(imaging.AdjustContrast(region, 50), label+"+contrast") {
+			return
+		}
+		if !yield(thresholdImage(region), label+"+otsu") {
+			return
+		}
+	}
+}
+
+// 放大的上限,避免细长或极小的图片被放大成数百MB
+const (
+	maxUpscale       = 4.0
+	maxUpscalePixels = 4000000
+	// 长边超过短边的该倍数时不放大,二维码是方形的,放大细长区域只会浪费内存
+	maxUpscaleAspect = 4
+)
+
+// upscaleFactor 返回w×h区域的放大倍数,不需要放大时返回0
+func (p searchProfile) upscaleFactor(w, h int) float64 {
+	short, long := minInt(w, h), maxInt(w, h)
+	if p.upscale <= 0 || short <= 0 || short >= p.upscale || long > short*maxUpscaleAspect {
+		return 0
+	}
+	scale := math.Min(float64(p.upscale)/float64(short), maxUpscale)
+	if pixels := float64(w) * float64(h); pixels*scale*scale > maxUpscalePixels {
+		scale = math.Sqrt(maxUpscalePixels / pixels)
+	}
+	if scale < 1.1 {
+		return 0
+	}
+	return scale
+}
+
+// thresholdImage 使用Otsu阈值把灰度图变成纯黑白,去掉背景纹理和渐变
+func thresholdImage(gray *image.NRGBA) *image.NRGBA {
+	threshold := uint8(otsuThreshold(gray))
+	return imaging.AdjustFunc(gray, func(c color.NRGBA) color.NRGBA {
+		if c.R <= threshold {
+			return color.NRGBA{A: c.A}
+		}
+		return color.NRGBA{R: 255, G: 255, B: 255, A: c.A}
+	})
+}
+
+// luminanceSource 直接取灰度图的像素生成亮度数据,每个候选图像只生成一次供所有解码器共用
+// gozxing.NewLuminanceSourceFromImage 逐像素调用At,在大图上占去大部分耗时
+func luminanceSource(gray *image.NRGBA) (gozxing.LuminanceSource, error) {
+	b := gray.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		row := gray.Pix[(y+b.Min.Y-gray.Rect.Min.Y)*gray.Stride+(b.Min.X-gray.Rect.Min.X)*4:]
+		for x := 0; x < w; x++ {
+			// 完全透明的像素按白色处理,与gozxing一致
+			if row[x*4+3] == 0 {
+				lum[y*w+x] = 0xFF
+			} else {
+				lum[y*w+x] = row[x*4]
+			}
+		}
+	}
+	return gozxing.NewPlanarYUVLuminanceSource(lum, w, h, 0, 0, w, h, false)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
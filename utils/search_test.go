@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// TestCandidatesBounded 检查细长和极小的图片不会被放大成超大图像
+func TestCandidatesBounded(t *testing.T) {
+	profile := searchProfiles["thorough"]
+	for _, size := range [][2]int{{16, 10000}, {10000, 16}, {40, 40}, {300, 2000}} {
+		w, h := size[0], size[1]
+		gray := imaging.New(w, h, color.NRGBA{128, 128, 128, 255})
+		limit := maxInt(w*h, maxUpscalePixels)
+		count := 0
+		profile.candidates(gray, func(img *image.NRGBA, label string) bool {
+			count++
+			b := img.Bounds()
+			if pixels := b.Dx() * b.Dy(); pixels > limit {
+				t.Errorf("%dx%d: candidate %s has %d pixels, limit %d", w, h, label, pixels, limit)
+			}
+			return true
+		})
+		if count == 0 {
+			t.Errorf("%dx%d: no candidates", w, h)
+		}
+	}
+
+	for _, c := range []struct {
+		w, h int
+		want float64
+	}{
+		{16, 10000, 0}, // 细长区域不放大
+		{40, 40, 4},    // 放大倍数不超过4倍
+		{300, 400, 1000.0 / 300},
+		{1200, 1500, 0}, // 已经足够大
+	} {
+		if got := profile.upscaleFactor(c.w, c.h); got != c.want {
+			t.Errorf("upscaleFactor(%d, %d) = %v, want %v", c.w, c.h, got, c.want)
+		}
+	}
+}
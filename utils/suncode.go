@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// 小程序码(太阳码)检测
+//
+// 小程序码无法用gozxing解码,这里按形状识别:
+//  1. 二值化后逐行寻找 黑-白-黑-白-黑 的同心圆定位点,并每隔22.5度复核一次,
+//     各方向宽度接近才算圆形(二维码的方形定位点对角线宽度约为边长的1.41倍,旋转后也会被排除);
+//  2. 三个大小相近的定位点构成近似等腰直角三角形;
+//  3. 以斜边中点为圆心,在定位点外侧的环带上采样,放射状的码条会在整圈产生大量黑白交替。
+
+// SunCodeFormat 是小程序码在检测结果中的格式名
+const SunCodeFormat = "MINIPROGRAM_CODE"
+
+// sunCodeMaxSide 检测前把图像缩放到的最大边长,兼顾速度和小码的识别
+const sunCodeMaxSide = 800
+
+type eyeCandidate struct {
+	x, y float64
+	size float64
+	hits int
+}
+
+// DetectSunCode 检测图像中是否存在小程序码,返回0-1之间的置信度
+func DetectSunCode(img image.Image) float64 {
+	gray := imaging.Grayscale(img)
+	bounds := gray.Bounds()
+	if bounds.Dx() > sunCodeMaxSide || bounds.Dy() > sunCodeMaxSide {
+		gray = imaging.Fit(gray, sunCodeMaxSide, sunCodeMaxSide, imaging.Box)
+	}
+
+	bin := binarize(gray)
+	eyes := findCircularEyes(bin)
+	if len(eyes) < 3 {
+		return 0
+	}
+
+	best := 0.0
+	for i := 0; i < len(eyes); i++ {
+		for j := i + 1; j < len(eyes); j++ {
+			for k := j + 1; k < len(eyes); k++ {
+				corner, a, b, ok := rightIsoscelesCorner(eyes[i], eyes[j], eyes[k])
+				if !ok {
+					continue
+				}
+				texture := radialTexture(bin, corner, a, b)
+				if score := 0.5 + 0.5*texture; score > best {
+					best = score
+				}
+			}
+		}
+	}
+	return best
+}
+
+// bitmap 是二值化后的图像,true表示黑色
+type bitmap struct {
+	w, h int
+	dark []bool
+}
+
+func (b *bitmap) at(x, y int) (bool, bool) {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return false, false
+	}
+	return b.dark[y*b.w+x], true
+}
+
+// binarize 使用Otsu阈值二值化灰度图
+func binarize(gray *image.NRGBA) *bitmap {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	threshold := otsuThreshold(gray)
+
+	b := &bitmap{w: w, h: h, dark: make([]bool, w*h)}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			b.dark[y*w+x] = int(gray.Pix[y*gray.Stride+x*4]) <= threshold
+		}
+	}
+	return b
+}
+
+// otsuThreshold 按类间方差最大计算灰度图的二值化阈值
+func otsuThreshold(gray *image.NRGBA) int {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			hist[gray.Pix[y*gray.Stride+x*4]]++
+		}
+	}
+
+	total := w * h
+	sum := 0.0
+	for i, c := range hist {
+		sum += float64(i * c)
+	}
+	var sumB, wB float64
+	maxVar, threshold := 0.0, 128
+	for i, c := range hist {
+		wB += float64(c)
+		if wB == 0 {
+			continue
+		}
+		wF := float64(total) - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(i * c)
+		mB := sumB / wB
+		mF := (sum - sumB) / wF
+		if v := wB * wF * (mB - mF) * (mB - mF); v > maxVar {
+			maxVar = v
+			threshold = i
+		}
+	}
+	return threshold
+}
+
+// findCircularEyes 逐行寻找同心圆定位点并聚类
+func findCircularEyes(b *bitmap) []eyeCandidate {
+	var candidates []eyeCandidate
+	for y := 0; y < b.h; y++ {
+		var runs [5]int
+		state := 0
+		for x := 0; x < b.w; x++ {
+			dark, _ := b.at(x, y)
+			// state为偶数时在黑色段,奇数时在白色段
+			if dark == (state%2 == 0) {
+				runs[state]++
+				continue
+			}
+			if state == 0 && runs[0] == 0 {
+				continue
+			}
+			if state < 4 {
+				state++
+				runs[state] = 1
+				continue
+			}
+			// 已凑齐五段,检查比例
+			if ringRatio(runs) {
+				total := runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+				cx := float64(x-runs[4]-runs[3]) - float64(runs[2])/2
+				// 五段总宽度过小时无法区分圆形和方形
+				if total >= 10 {
+					if ex, ey, size, ok := checkCircle(b, cx, float64(y)); ok {
+						candidates = mergeEye(candidates, eyeCandidate{x: ex, y: ey, size: size, hits: 1})
+					}
+				}
+			}
+			// 向后滑动两段,继续寻找
+			runs = [5]int{runs[2], runs[3], runs[4], 1, 0}
+			state = 3
+		}
+	}
+
+	var eyes []eyeCandidate
+	for _, c := range candidates {
+		if c.hits >= 2 {
+			eyes = append(eyes, c)
+		}
+	}
+	return eyes
+}
+
+// ringRatio 判断五段宽度是否符合 环:间隙:中心:间隙:环
+// 两侧对称,中心明显宽于环;二值化后黑色容易外扩,因此对环与间隙的比例放得较宽
+func ringRatio(runs [5]int) bool {
+	ring := float64(runs[0]+runs[4]) / 2
+	gap := float64(runs[1]+runs[3]) / 2
+	if ring < 1 || gap < 1 {
+		return false
+	}
+	if math.Abs(float64(runs[0]-runs[4])) > math.Max(1, ring*0.5) ||
+		math.Abs(float64(runs[1]-runs[3])) > math.Max(1, gap*0.6) {
+		return false
+	}
+	if gap < ring*0.25 || gap > ring*3 {
+		return false
+	}
+	center := float64(runs[2])
+	unit := (ring + gap) / 2
+	return center >= unit*1.5 && center <= unit*6
+}
+
+// checkCircle 先在竖直和水平方向校正圆心,再在四个方向复核五段结构
+// 四个方向宽度接近时认为是圆形,返回圆心和平均宽度
+// 小尺寸时校正后的圆心可能因量化误差偏离一个像素,因此也会尝试周围一个像素内的点
+func checkCircle(b *bitmap, cx, cy float64) (float64, float64, float64, bool) {
+	_, dy, ok := crossCheck(b, cx, cy, 0, 1)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	cy += dy
+	_, dx, ok := crossCheck(b, cx, cy, 1, 0)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	cx += dx
+
+	for _, offset := range [][2]float64{{0, 0}, {-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		x, y := cx+offset[0], cy+offset[1]
+		if size, ok := circleWidth(b, x, y); ok {
+			return x, y, size, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// circleWidth 每隔22.5度测量一次五段结构,宽度接近时返回平均宽度
+// 只测水平、竖直和对角线时,旋转约20度的方形定位点四个方向宽度也接近,会被当成圆形
+func circleWidth(b *bitmap, cx, cy float64) (float64, bool) {
+	var widths []float64
+	for i := 0; i < 8; i++ {
+		angle := math.Pi * float64(i) / 8
+		if w, _, ok := crossCheck(b, cx, cy, math.Cos(angle), math.Sin(angle)); ok {
+			widths = append(widths, w)
+		}
+	}
+	// 小尺寸时斜向行走的量化误差可能打乱五段比例,允许少数方向失败
+	if len(widths) < 6 {
+		return 0, false
+	}
+
+	mean, minWidth, maxWidth := 0.0, widths[0], widths[0]
+	for _, w := range widths {
+		mean += w
+		minWidth = math.Min(minWidth, w)
+		maxWidth = math.Max(maxWidth, w)
+	}
+	// 小尺寸时允许几个像素的量化误差
+	if maxWidth-minWidth > math.Max(minWidth*0.15, 3) {
+		return 0, false
+	}
+	return mean / float64(len(widths)), true
+}
+
+// crossCheck 从中心沿(dx,dy)双向行走,返回五段结构的总宽度,以及中心段中点相对起点的偏移
+func crossCheck(b *bitmap, cx, cy, dx, dy float64) (float64, float64, bool) {
+	if dark, ok := b.at(int(math.Round(cx)), int(math.Round(cy))); !ok || !dark {
+		return 0, 0, false
+	}
+
+	var runs [5]int
+	var centerExtent [2]int
+	for i, sign := range []float64{1, -1} {
+		state := 2
+		for step := 0; ; step++ {
+			x := int(math.Round(cx + sign*dx*float64(step)))
+			y := int(math.Round(cy + sign*dy*float64(step)))
+			dark, ok := b.at(x, y)
+			if !ok {
+				return 0, 0, false
+			}
+			if dark != (state%2 == 0) {
+				if sign > 0 {
+					state++
+				} else {
+					state--
+				}
+				if state > 4 || state < 0 {
+					break
+				}
+			}
+			runs[state]++
+			if state == 2 {
+				centerExtent[i] = step
+			}
+		}
+	}
+	// 中心段被双向各计数一次
+	runs[2]--
+	if !ringRatio(runs) {
+		return 0, 0, false
+	}
+	total := runs[0] + runs[1] + runs[2] + runs[3] + runs[4]
+	return float64(total), float64(centerExtent[0]-centerExtent[1]) / 2, true
+}
+
+// mergeEye 与已有的相近候选合并,位置和大小取平均
+func mergeEye(candidates []eyeCandidate, c eyeCandidate) []eyeCandidate {
+	for i, e := range candidates {
+		if math.Hypot(e.x-c.x, e.y-c.y) < e.size/2 && math.Abs(e.size-c.size) < e.size*0.3 {
+			n := float64(e.hits)
+			candidates[i] = eyeCandidate{
+				x:    (e.x*n + c.x) / (n + 1),
+				y:    (e.y*n + c.y) / (n + 1),
+				size: (e.size*n + c.size) / (n + 1),
+				hits: e.hits + 1,
+			}
+			return candidates
+		}
+	}
+	return append(candidates, c)
+}
+
+// rightIsoscelesCorner 判断三点是否构成等腰直角三角形,返回直角顶点和另外两点
+func rightIsoscelesCorner(p, q, r eyeCandidate) (eyeCandidate, eyeCandidate, eyeCandidate, bool) {
+	sizes := []float64{p.size, q.size, r.size}
+	minSize, maxSize := sizes[0], sizes[0]
+	for _, s := range sizes {
+		minSize = math.Min(minSize, s)
+		maxSize = math.Max(maxSize, s)
+	}
+	if maxSize > minSize*1.4 {
+		return eyeCandidate{}, eyeCandidate{}, eyeCandidate{}, false
+	}
+
+	for _, t := range [][3]eyeCandidate{{p, q, r}, {q, p, r}, {r, p, q}} {
+		corner, a, b := t[0], t[1], t[2]
+		da := math.Hypot(a.x-corner.x, a.y-corner.y)
+		db := math.Hypot(b.x-corner.x, b.y-corner.y)
+		dab := math.Hypot(a.x-b.x, a.y-b.y)
+		// 定位点之间至少相隔两个定位点的宽度
+		if da < maxSize*2 || db < maxSize*2 {
+			continue
+		}
+		if math.Abs(da-db) > math.Max(da, db)*0.15 {
+			continue
+		}
+		if math.Abs(dab-math.Sqrt2*(da+db)/2) > dab*0.15 {
+			continue
+		}
+		return corner, a, b, true
+	}
+	return eyeCandidate{}, eyeCandidate{}, eyeCandidate{}, false
+}
+
+// radialTexture 在码的环带上采样黑白交替次数,返回0-1的纹理得分
+// 码条布满整圈,交替集中在少数方向时(如成片的同心圆图标)按覆盖的扇区比例降低得分
+func radialTexture(b *bitmap, corner, a, c eyeCandidate) float64 {
+	// 圆心取斜边中点,定位点位于内切于圆的正方形角上
+	ox, oy := (a.x+c.x)/2, (a.y+c.y)/2
+	eyeDistance := math.Hypot(corner.x-ox, corner.y-oy)
+
+	const samples = 720
+	const sectors = 24
+	// 小程序码一圈通常有数十根码条,每根产生两次交替
+	const expected = 60.0
+	best := 0.0
+	for _, ratio := range []float64{0.75, 0.95, 1.15} {
+		radius := eyeDistance * ratio
+		transitions := 0
+		var covered [sectors]bool
+		var prev, started, outside bool
+		for i := 0; i < samples && !outside; i++ {
+			angle := 2 * math.Pi * float64(i) / samples
+			dark, ok := b.at(int(ox+radius*math.Cos(angle)), int(oy+radius*math.Sin(angle)))
+			if !ok {
+				// 环带超出图像,跳过这一圈
+				outside = true
+				transitions = 0
+				continue
+			}
+			if started && dark != prev {
+				transitions++
+				covered[i*sectors/samples] = true
+			}
+			prev, started = dark, true
+		}
+		if outside {
+			continue
+		}
+
+		count := 0
+		for _, hit := range covered {
+			if hit {
+				count++
+			}
+		}
+		// 四分之三以上的扇区有交替即视为布满整圈
+		score := math.Min(1, float64(transitions)/expected) * math.Min(1, float64(count)/(sectors*0.75))
+		best = math.Max(best, score)
+	}
+	return best
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+)
+
+// TestSunCodeCorpus 小程序码用例应达到阈值,形状相近的图案和二维码语料中的图片都不应被当成小程序码
+func TestSunCodeCorpus(t *testing.T) {
+	useConfig(t, nil)
+	threshold := config.GetSunCodeThreshold()
+	dir := t.TempDir()
+
+	cases := corpus.SunCodes()
+	for _, c := range corpus.Images() {
+		// 二维码的定位点是方形的,不是小程序码
+		c.QR = false
+		cases = append(cases, c)
+	}
+	for _, c := range cases {
+		path, err := c.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := imaging.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		score := DetectSunCode(img)
+		if got := score >= threshold; got != c.QR {
+			t.Errorf("%s: DetectSunCode = %.2f, want suncode=%v (threshold %.2f)", c.Name, score, c.QR, threshold)
+		}
+	}
+}
+
+// TestScanQRCodeSunCode 小程序码无法解码,按形状识别后应以MINIPROGRAM_CODE撤回
+func TestScanQRCodeSunCode(t *testing.T) {
+	useConfig(t, nil)
+	dir := t.TempDir()
+	for _, c := range corpus.SunCodes() {
+		if c.Name != "suncode_center" && c.Name != "bullseyes" {
+			continue
+		}
+		path, err := c.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := ScanQRCode(path)
+		if got := result.Found && result.Format == SunCodeFormat; got != c.QR {
+			t.Errorf("%s: ScanQRCode = %+v, want suncode=%v", c.Name, result, c.QR)
+		}
+	}
+
+	useConfig(t, map[string]string{"suncode_enabled": "false"})
+	for _, c := range corpus.SunCodes() {
+		if c.Name != "suncode_center" {
+			continue
+		}
+		path, err := c.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := ScanQRCode(path); result.Format == SunCodeFormat {
+			t.Errorf("suncode_enabled=false: ScanQRCode = %+v", result)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/aztec"
+	"github.com/makiuchi-d/gozxing/datamatrix"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// symbology 描述一种可检测的条码格式及其解码器
+type symbology struct {
+	name      string
+	format    gozxing.BarcodeFormat
+	newReader func() gozxing.Reader
+}
+
+// supportedSymbologies 是可在barcode_formats中启用的格式
+// gozxing没有PDF417解码器,pdf417会被CheckBarcodeFormats报告为不支持
+var supportedSymbologies = []symbology{
+	{"qr_code", gozxing.BarcodeFormat_QR_CODE, func() gozxing.Reader { return qrcode.NewQRCodeReader() }},
+	{"data_matrix", gozxing.BarcodeFormat_DATA_MATRIX, func() gozxing.Reader { return datamatrix.NewDataMatrixReader() }},
+	{"aztec", gozxing.BarcodeFormat_AZTEC, func() gozxing.Reader { return aztec.NewAztecReader() }},
+}
+
+// enabledSymbologies 返回配置中启用且支持的格式,顺序与supportedSymbologies一致
+func enabledSymbologies() []symbology {
+	enabled := make(map[string]bool)
+	for _, name := range config.GetBarcodeFormats() {
+		enabled[strings.ToLower(name)] = true
+	}
+
+	var result []symbology
+	for _, s := range supportedSymbologies {
+		if enabled[s.name] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// CheckBarcodeFormats 检查barcode_formats配置,返回不支持的格式名
+func CheckBarcodeFormats() []string {
+	var unsupported []string
+	for _, name := range config.GetBarcodeFormats() {
+		found := false
+		for _, s := range supportedSymbologies {
+			if strings.ToLower(name) == s.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unsupported = append(unsupported, name)
+		}
+	}
+	if len(unsupported) > 0 {
+		fmt.Printf("以下条码格式暂不支持,将被忽略: %v (支持: qr_code, data_matrix, aztec)\n", unsupported)
+	}
+	return unsupported
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/phash"
+)
+
+// VideoScanResult 是视频逐帧检测的结果
+type VideoScanResult struct {
+	Hit bool
+	// HitFrames 是检测到二维码或命中已知广告图的帧文件
+	HitFrames []string
+	// KnownHash 不为空时表示命中了黑名单中的已知广告图
+	KnownHash string
+	// Payloads 是计入命中的帧中解码出的二维码内容
+	Payloads []string
+	// Formats 是计入命中的帧中检测到的条码格式(去重)
+	Formats []string
+	// Score 是所有帧中最高的二维码置信度
+	Score float64
+	// Review 表示有帧的置信度落在复核区间,未命中时由调用方决定是否人工复核
+	Review bool
+	// ReviewFrames 是置信度落在复核区间的帧文件
+	ReviewFrames []string
+	// FrameSource 是实际使用的帧来源,如 ffmpeg、mjpeg
+	FrameSource string
+	// Inconclusive 表示超过检测时间上限仍未命中,未检查的帧中可能还有二维码
+	Inconclusive bool
+	// FrameErrors 是检测时发生panic的帧及原因,这些帧按未检测到二维码处理
+	FrameErrors []string
+}
+
+func CheckVideoForQRCode(videoPath string) bool {
+	result, _ := ScanVideo(videoPath, nil)
+	return result.Hit
+}
+
+// ScanVideo 抽帧后由scan_workers个goroutine并行检查,命中已知广告图哈希的帧直接判定,其余帧检查二维码
+// 达到qr_limit后立即取消其余帧;超过video_scan_timeout仍未命中时结果为Inconclusive
+// accept 决定检测到的二维码是否计入命中(例如按内容放行本群的收款码),为nil时全部计入,会被并发调用
+// 没有可用的帧来源时返回的错误包含 media.ErrNoFrameSource
+func ScanVideo(videoPath string, accept func(QRResult) bool) (VideoScanResult, error) {
+	return ScanVideoLimit(videoPath, config.GetQRLimit(), accept)
+}
+
+// FramesDir 返回视频抽帧使用的目录,与视频文件同名但不含扩展名
+func FramesDir(videoPath string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+}
+
+// ScanVideoLimit 与ScanVideo相同,但包含二维码的帧数达到qrlimit时判定命中,用于按群设置qr_limit
+func ScanVideoLimit(videoPath string, qrlimit int, accept func(QRResult) bool) (VideoScanResult, error) {
+	var result VideoScanResult
+	framesDir := FramesDir(videoPath)
+	if err := os.MkdirAll(framesDir, os.ModePerm); err != nil {
+		logger.LogEvent(fmt.Sprintf("Failed to create directory for frames: %v", err))
+		return result, err
+	}
+
+	timeout := time.Duration(config.GetVideoScanTimeout()) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Scan frames for QR codes
+	var mu sync.Mutex
+	qrCount := 0
+
+	scanFrame := func(frame string) {
+		if entry, ok := MatchKnownHash(frame); ok {
+			fmt.Printf("视频帧命中已知广告图[%s]!\n", entry.Hash)
+			mu.Lock()
+			if !result.Hit {
+				result.Hit = true
+				result.KnownHash = entry.Hash
+				result.HitFrames = append(result.HitFrames, frame)
+			}
+			mu.Unlock()
+			cancel()
+			return
+		}
+		qr := ScanQRCodeContext(ctx, frame)
+		counted := qr.Found && (accept == nil || accept(qr))
+
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Hit {
+			return
+		}
+		if qr.Score > result.Score {
+			result.Score = qr.Score
+		}
+		if qr.Review {
+			fmt.Printf("视频帧二维码置信度%.2f,待复核\n", qr.Score)
+			result.Review = true
+			result.ReviewFrames = append(result.ReviewFrames, frame)
+		} else if qr.Found && !counted {
+			fmt.Printf("视频帧二维码[%s]被放行\n", qr.Text)
+		} else if qr.Found {
+			fmt.Printf("检测到视频帧包含%s!\n", qr.Format)
+			result.HitFrames = append(result.HitFrames, frame)
+			if !containsString(result.Formats, qr.Format) {
+				result.Formats = append(result.Formats, qr.Format)
+			}
+			if qr.Text != "" {
+				result.Payloads = append(result.Payloads, qr.Text)
+			}
+			qrCount++
+			if qrCount >= qrlimit {
+				result.Hit = true
+				cancel()
+			}
+		} else {
+			fmt.Printf("未检测到视频帧包含二维码\n")
+		}
+	}
+
+	// safeScan 损坏的帧让gozxing或小程序码检测panic时只记录该帧的错误,不影响其余帧和整个进程
+	safeScan := func(frame string) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogEvent(fmt.Sprintf("Frame scan panicked %s: %v\n%s", frame, r, debug.Stack()))
+				mu.Lock()
+				result.FrameErrors = append(result.FrameErrors, fmt.Sprintf("%s: %v", filepath.Base(frame), r))
+				mu.Unlock()
+			}
+		}()
+		scanFrame(frame)
+	}
+
+	frames := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < config.GetScanWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for frame := range frames {
+				if ctx.Err() == nil {
+					safeScan(frame)
+				}
+			}
+		}()
+	}
+
+	source, err := media.ExtractFrames(ctx, videoPath, framesDir, func(f media.Frame) bool {
+		select {
+		case frames <- f.Path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(frames)
+	wg.Wait()
+
+	result.FrameSource = source
+	if err != nil {
+		logger.LogEvent(fmt.Sprintf("Frame extraction failed: %v", err))
+		return result, err
+	}
+	if !result.Hit && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.LogEvent(fmt.Sprintf("Video scan exceeded %v without a verdict: %s", timeout, videoPath))
+		result.Inconclusive = true
+	}
+	return result, nil
+}
+
+// MatchKnownHash 检查图片是否与黑名单中的已知广告图相似
+func MatchKnownHash(imagePath string) (phash.Entry, bool) {
+	if !config.GetPhashEnabled() {
+		return phash.Entry{}, false
+	}
+	hash, err := phash.HashFile(imagePath)
+	if err != nil {
+		log.Printf("Failed to hash image: %v", err)
+		return phash.Entry{}, false
+	}
+	entry, _, ok := phash.GetInstance().Match(hash, config.GetPhashThreshold())
+	return entry, ok
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/internal/corpus"
+)
+
+// writeMJPEG 生成每秒一帧的MJPEG视频,qrFrame为二维码所在的帧,小于0时不含二维码
+// MJPEG的帧不经解码即可取出,没有ffmpeg的环境中也能测试逐帧检测
+func writeMJPEG(t *testing.T, frames, qrFrame int) string {
+	t.Helper()
+	samples := make([][]byte, frames)
+	for i := range samples {
+		frame := corpus.Texture(480, 360, int64(100+i))
+		if i == qrFrame {
+			corpus.Paste(frame, corpus.QR(corpus.AdText, 180, color.Black, color.White), 280, 160)
+		}
+		samples[i] = corpus.JPEG(frame)
+	}
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 1000, Samples: samples, Codec: "jpeg", Width: 480, Height: 360}.Bytes()
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeH264 生成H.264视频,每个关键帧后跟两个无法单独解码的P帧,qrKey为二维码所在的关键帧
+// 关键帧由内置解码器解码,没有ffmpeg的环境中也能测试
+func writeH264(t *testing.T, keys, qrKey int) string {
+	t.Helper()
+	var w corpus.BitWriter
+	w.UE(0) // first_mb_in_slice
+	w.UE(5) // slice_type P
+	pFrame := corpus.AVCSample(corpus.NAL(0x41, w.Trailing()))
+
+	var samples [][]byte
+	var sync []uint32
+	var config []byte
+	for i := 0; i < keys; i++ {
+		frame := corpus.Texture(320, 240, int64(200+i))
+		if i == qrKey {
+			corpus.Paste(frame, corpus.QR(corpus.AdText, 160, color.Black, color.White), 150, 70)
+		}
+		var sample []byte
+		config, sample = corpus.H264(frame)
+		sync = append(sync, uint32(len(samples)+1))
+		samples = append(samples, sample, pFrame, pFrame)
+	}
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 1000, Samples: samples, Codec: "avc1", Width: 320, Height: 240,
+		AVCC: config, SyncSamples: sync}.Bytes()
+	path := filepath.Join(t.TempDir(), "h264.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckVideoForQRCode(t *testing.T) {
+	useConfig(t, nil)
+	cases := []struct {
+		name    string
+		qrFrame int
+		want    bool
+	}{
+		{"qr_in_last_frame", 3, true},
+		{"qr_in_first_frame", 0, true},
+		{"no_qr", -1, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := writeMJPEG(t, 4, c.qrFrame)
+			if got := CheckVideoForQRCode(path); got != c.want {
+				t.Errorf("CheckVideoForQRCode = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// TestScanVideoRecoversPanic 检查帧检测时的panic只记为该帧的错误
+func TestScanVideoRecoversPanic(t *testing.T) {
+	useConfig(t, nil)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 事件日志写在当前目录下
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	path := writeMJPEG(t, 4, 1)
+	result, err := ScanVideo(path, func(QRResult) bool { panic("bad frame") })
+	if err != nil || result.Hit || len(result.FrameErrors) != 1 {
+		t.Errorf("ScanVideo = %+v, %v, want one frame error and no hit", result, err)
+	}
+}
+
+func TestScanVideoH264(t *testing.T) {
+	useConfig(t, nil)
+	for _, c := range []struct {
+		name  string
+		qrKey int
+		want  bool
+	}{
+		{"qr_in_key_frame", 2, true},
+		{"no_qr", -1, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := ScanVideo(writeH264(t, 3, c.qrKey), nil)
+			if result.FrameSource != "h264" {
+				t.Skipf("frames came from %q (%v), the built-in decoder is only used without ffmpeg", result.FrameSource, err)
+			}
+			if err != nil || result.Hit != c.want {
+				t.Errorf("ScanVideo = %+v, %v, want hit=%v", result, err, c.want)
+			}
+		})
+	}
+}
+
+func TestScanVideoCoverArt(t *testing.T) {
+	useConfig(t, nil)
+	cover := imaging.New(400, 400, color.White)
+	corpus.Paste(cover, corpus.QR(corpus.AdText, 300, color.Black, color.White), 50, 50)
+	// 没有样本的H.264视频,没有ffmpeg时只能检查封面
+	data := corpus.MP4{Timescale: 1000, SampleDelta: 1000, Samples: make([][]byte, 3), Codec: "avc1", Width: 480, Height: 360, Cover: corpus.JPEG(cover)}.Bytes()
+	path := filepath.Join(t.TempDir(), "cover.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ScanVideo(path, nil)
+	if result.FrameSource != "cover_art" {
+		t.Skipf("frames came from %q (%v), cover art is only used without ffmpeg", result.FrameSource, err)
+	}
+	if err != nil || !result.Hit {
+		t.Errorf("ScanVideo = %+v, %v, want a hit from the cover art", result, err)
+	}
+}
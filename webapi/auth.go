@@ -0,0 +1,34 @@
+package webapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
+)
+
+// RequireAdminToken 校验admin_token,token从请求头Authorization(Bearer/Token)或参数access_token读取
+// 未配置admin_token时拒绝所有请求,避免禁言和修改黑名单的接口对外开放
+func RequireAdminToken(c *gin.Context) {
+	valid := config.GetAdminToken()
+	if valid == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin_token is not configured"})
+		return
+	}
+
+	token := c.Query("access_token")
+	if header := c.GetHeader("Authorization"); header != "" {
+		token = strings.TrimPrefix(strings.TrimPrefix(header, "Bearer "), "Token ")
+	}
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(valid)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Incorrect token"})
+		return
+	}
+	c.Next()
+}
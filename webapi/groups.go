@@ -0,0 +1,68 @@
+package webapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/groupconfig"
+)
+
+// GetGroupSettings 返回群生效的设置和本群覆盖了的设置项,参数 group_id
+func GetGroupSettings(c *gin.Context) {
+	groupID := c.Query("group_id")
+	if groupID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id parameter is required"})
+		return
+	}
+	c.JSON(http.StatusOK, groupSettings(groupID))
+}
+
+// SetGroupSetting 覆盖群的一项设置,参数 group_id key value
+func SetGroupSetting(c *gin.Context) {
+	groupID, key, value := c.Query("group_id"), c.Query("key"), c.Query("value")
+	if groupID == "" || key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id and key parameters are required"})
+		return
+	}
+	if err := groupconfig.Set(groupID, key, value); err != nil {
+		c.JSON(groupSettingStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, groupSettings(groupID))
+}
+
+// UnsetGroupSetting 取消群对一项设置的覆盖,参数 group_id key
+func UnsetGroupSetting(c *gin.Context) {
+	groupID, key := c.Query("group_id"), c.Query("key")
+	if groupID == "" || key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id and key parameters are required"})
+		return
+	}
+	if err := groupconfig.Unset(groupID, key); err != nil {
+		c.JSON(groupSettingStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, groupSettings(groupID))
+}
+
+func groupSettings(groupID string) gin.H {
+	settings := groupconfig.Get(groupID)
+	values := gin.H{}
+	for _, k := range groupconfig.Keys {
+		values[k.Name] = k.Value(settings)
+	}
+	overridden := groupconfig.GetInstance().Overridden(groupID)
+	if overridden == nil {
+		overridden = []string{}
+	}
+	return gin.H{"group_id": groupID, "settings": values, "overridden": overridden}
+}
+
+// groupSettingStatus 设置项或值无效时为400,保存失败时为500
+func groupSettingStatus(err error) int {
+	if errors.Is(err, groupconfig.ErrInvalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,78 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
+)
+
+// Mute 禁言群成员,参数 self_id group_id user_id minutes
+func Mute(c *gin.Context) {
+	selfID, groupID, userID := c.Query("self_id"), c.Query("group_id"), c.Query("user_id")
+	if selfID == "" || groupID == "" || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "self_id, group_id and user_id parameters are required"})
+		return
+	}
+	minutes, err := strconv.Atoi(c.Query("minutes"))
+	if err != nil || minutes <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minutes must be a positive number"})
+		return
+	}
+	if err := pipeline.Mute(selfID, groupID, userID, minutes); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": true, "minutes": minutes})
+}
+
+// Unmute 解除群成员禁言,参数 self_id group_id user_id
+func Unmute(c *gin.Context) {
+	selfID, groupID, userID := c.Query("self_id"), c.Query("group_id"), c.Query("user_id")
+	if selfID == "" || groupID == "" || userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "self_id, group_id and user_id parameters are required"})
+		return
+	}
+	if err := pipeline.Mute(selfID, groupID, userID, 0); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": false})
+}
+
+// MuteAll 开启全员禁言,参数 self_id group_id,可选minutes,到期自动解除
+func MuteAll(c *gin.Context) {
+	selfID, groupID := c.Query("self_id"), c.Query("group_id")
+	if selfID == "" || groupID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "self_id and group_id parameters are required"})
+		return
+	}
+	minutes := 0
+	if text := c.Query("minutes"); text != "" {
+		var err error
+		if minutes, err = strconv.Atoi(text); err != nil || minutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minutes must be a non-negative number"})
+			return
+		}
+	}
+	if err := pipeline.MuteAll(selfID, groupID, minutes); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": true, "minutes": minutes})
+}
+
+// UnmuteAll 解除全员禁言,参数 self_id group_id
+func UnmuteAll(c *gin.Context) {
+	selfID, groupID := c.Query("self_id"), c.Query("group_id")
+	if selfID == "" || groupID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "self_id and group_id parameters are required"})
+		return
+	}
+	if err := pipeline.UnmuteAll(selfID, groupID); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"muted": false})
+}
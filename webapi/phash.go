@@ -0,0 +1,66 @@
+package webapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/phash"
+)
+
+// ListPhash 列出已知广告图哈希
+func ListPhash(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"hashes": phash.GetInstance().List()})
+}
+
+// AddPhash 通过hash参数或imageurl参数添加已知广告图
+func AddPhash(c *gin.Context) {
+	hashText := c.Query("hash")
+	imageURL := c.Query("imageurl")
+	store := phash.GetInstance()
+
+	var hash uint64
+	var added bool
+	var err error
+	switch {
+	case hashText != "":
+		hash, err = phash.Parse(hashText)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		added, err = store.Add(hash, "http")
+	case imageURL != "":
+		imagePath, downloadErr := media.Fetch(imageURL, media.TypeImage)
+		if downloadErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": downloadErr.Error()})
+			return
+		}
+		hash, added, err = store.AddFile(imagePath, "http "+imageURL)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hash or imageurl parameter is required"})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hash": phash.Format(hash), "added": added})
+}
+
+// RemovePhash 通过hash参数删除已知广告图
+func RemovePhash(c *gin.Context) {
+	hash, err := phash.Parse(c.Query("hash"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	removed, err := phash.GetInstance().Remove(hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hash": phash.Format(hash), "removed": removed})
+}
@@ -1,21 +1,13 @@
 package webapi
 
 import (
-	"crypto/tls"
-	"encoding/binary"
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/config"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/logger"
-	"github.com/hoshinonyaruko/auto-withdraw-advideo/server"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/media"
+	"github.com/hoshinonyaruko/auto-withdraw-advideo/pipeline"
 	"github.com/hoshinonyaruko/auto-withdraw-advideo/utils"
 )
 
@@ -23,8 +15,6 @@ func GetVideoPlaylist(c *gin.Context) {
 	videoURL := c.Query("videourl")
 	selfID := c.Query("self_id")
 	messageID := c.Query("message_id")
-	userID := c.Query("user_id")
-	GroupID := c.Query("group_id")
 
 	if videoURL == "" || selfID == "" || messageID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "videourl, self_id, and message_id parameters are required"})
@@ -37,140 +27,31 @@ func GetVideoPlaylist(c *gin.Context) {
 		return
 	}
 
-	duration, err := fetchVideoDuration(decodedURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	result := pipeline.ProcessQueued(jobFromQuery(c, pipeline.KindVideo, decodedURL))
+	if result.Err != nil {
+		c.JSON(statusForResult(result), gin.H{"error": result.Err.Error()})
 		return
 	}
 
-	fmt.Printf("检测到视频,长度 %f\n", duration)
-
-	videoSecondLimit := config.GetVideoSecondLimit()
-	if duration < float64(videoSecondLimit) {
-		fmt.Printf("Video duration %f is less than limit %d, deleting message_id %s for self_id %s\n", duration, videoSecondLimit, messageID, selfID)
-		// 记录日志
-		logger.LogEvent(fmt.Sprintf("Video duration %f is less than limit %d, deleting message_id %s for self_id %s", duration, videoSecondLimit, messageID, selfID))
-		videopath := logger.DownloadVideo(decodedURL, selfID)
-
-		if config.GetCheckVideoQRCode() {
-			// 检查视频是否包含二维码
-			if !utils.CheckVideoForQRCode(videopath) {
-				fmt.Printf("video not contain QRcode pass.\n")
-				logger.LogEvent(fmt.Sprintf("video not contain QRcode pass url:%s", decodedURL))
-				c.JSON(http.StatusOK, gin.H{
-					"duration": duration,
-				})
-				// 返回 不做处理
-				return
-			} else {
-				fmt.Printf("video contain QRcode!!\n")
-				logger.LogEvent(fmt.Sprintf("video contain QRcode!! url:%s", decodedURL))
-				// 撤回 & 提示
-				logger.LogEvent(fmt.Sprintf("bot [%s] ad from group_id:%s user_id:%s", selfID, GroupID, userID))
-			}
-		}
-
-		urlToken, exists := utils.GetBaseURLByUserID(selfID)
-		if !exists {
-			// Reverse WS request logic here
-			server.SendDeleteMessageViaWebSocket(selfID, messageID)
-			// 发提示
-			server.SendGroupMessageViaWebSocket(selfID, GroupID, userID, config.GetWithdrawNotice())
-			if config.GetSetGroupKick() {
-				// 移除群员
-				server.KickGroupMemberViaWebSocket(selfID, GroupID, userID)
-			}
-		} else {
-			server.SendDeleteRequest(urlToken, messageID)
-			// 发提示
-			server.SendGroupMsgHttp(urlToken, GroupID, userID, config.GetWithdrawNotice())
-		}
-
+	if result.Actioned {
 		// 可以根据需要输出更多响应细节
-		c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
+		c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully", "duration": result.Details["duration"]})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"duration": duration,
-	})
-}
-
-func fetchVideoDuration(videoURL string) (float64, error) {
-	// 创建自定义的HTTP客户端，忽略证书验证
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: tr,
-		Timeout:   10 * time.Second, // 设置超时
-	}
-
-	// 使用自定义的客户端发起请求
-	resp, err := client.Get(videoURL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get video: %v", err)
-	}
-	defer resp.Body.Close()
-
-	buffer := make([]byte, 1024*1024*4) // 4MB buffer to find mvhd
-	totalRead := 0
-	for {
-		n, err := resp.Body.Read(buffer[totalRead:])
-		if err != nil {
-			break
-		}
-		totalRead += n
-		if totalRead >= len(buffer) {
-			break
-		}
-	}
-
-	mvhdIndex := findMvhd(buffer[:totalRead])
-	if mvhdIndex == -1 {
-		return 0, fmt.Errorf("mvhd box not found in the first %d bytes of the video", totalRead)
-	}
-
-	return parseDuration(buffer[mvhdIndex:])
-}
-
-func findMvhd(data []byte) int {
-	const sizeOfLengthAndType = 8 // Length (4 bytes) + Type (4 bytes)
-	index := 0
-
-	for index+sizeOfLengthAndType <= len(data) {
-		size := int(binary.BigEndian.Uint32(data[index : index+4]))
-		boxType := string(data[index+4 : index+8])
-		if boxType == "moov" {
-			// Look for mvhd within moov
-			endIndex := index + size
-			index += sizeOfLengthAndType
-			for index+sizeOfLengthAndType <= endIndex {
-				subSize := int(binary.BigEndian.Uint32(data[index : index+4]))
-				subBoxType := string(data[index+4 : index+8])
-				if subBoxType == "mvhd" {
-					return index
-				}
-				index += subSize
-			}
-		}
-		index += size
-	}
-	return -1
-}
-
-func parseDuration(data []byte) (float64, error) {
-	if len(data) < 24 {
-		return 0, fmt.Errorf("insufficient data for duration calculation")
+	if result.Shadow {
+		c.JSON(http.StatusOK, gin.H{"message": "Shadow mode, message would be deleted.", "shadow": true, "reason": result.Verdict.Reason, "duration": result.Details["duration"], "qr_score": result.Details["qr_score"]})
+		return
 	}
-	timeScale := binary.BigEndian.Uint32(data[20:24])
-	duration := binary.BigEndian.Uint32(data[24:28])
 
-	if timeScale == 0 {
-		return 0, fmt.Errorf("invalid time scale value")
+	if result.Verdict.Decision == pipeline.DecisionReview {
+		c.JSON(http.StatusOK, gin.H{"message": "Video needs review.", "review_id": result.Details["review_id"], "reason": result.Verdict.Reason, "duration": result.Details["duration"], "qr_score": result.Details["qr_score"]})
+		return
 	}
 
-	return float64(duration) / float64(timeScale), nil
+	c.JSON(http.StatusOK, gin.H{
+		"duration": result.Details["duration"],
+		"qr_score": result.Details["qr_score"],
+	})
 }
 
 // GetImageAndCheckQRCode handles the incoming request, downloads the image and checks for QR code.
@@ -178,87 +59,78 @@ func GetImageAndCheckQRCode(c *gin.Context) {
 	imageURL := c.Query("imageurl")
 	selfID := c.Query("self_id")
 	messageID := c.Query("message_id")
-	userID := c.Query("user_id")
-	GroupID := c.Query("group_id")
 
 	if imageURL == "" || selfID == "" || messageID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "imageurl, self_id, and message_id parameters are required"})
 		return
 	}
 
-	// Create a custom HTTP client to ignore SSL certificate verification
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Transport: tr,
-		Timeout:   10 * time.Second,
+	result := pipeline.ProcessQueued(jobFromQuery(c, pipeline.KindImage, imageURL))
+	if result.Err != nil {
+		c.JSON(statusForResult(result), gin.H{"error": result.Err.Error()})
+		return
 	}
 
-	// Download the image
-	resp, err := client.Get(imageURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to download image: %v", err)})
+	if result.Actioned {
+		c.JSON(http.StatusOK, gin.H{"message": "Image contains QR code, message deleted.", "qr_text": result.Details["qr_text"], "qr_rule": result.Details["qr_rule"], "qr_format": result.Details["qr_format"], "qr_score": result.Details["qr_score"], "qr_evidence": result.Details["qr_evidence"]})
 		return
 	}
-	defer resp.Body.Close()
-
-	// Assuming the function to save the downloaded image and return the path
-	imagePath, err := saveImage(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save image: %v", err)})
+	if result.Shadow {
+		c.JSON(http.StatusOK, gin.H{"message": "Shadow mode, message would be deleted.", "shadow": true, "reason": result.Verdict.Reason, "qr_text": result.Details["qr_text"], "qr_rule": result.Details["qr_rule"], "qr_format": result.Details["qr_format"], "qr_score": result.Details["qr_score"], "qr_evidence": result.Details["qr_evidence"]})
 		return
 	}
 
-	// Check for QR code in the image
-	if utils.ContainsQRCode(imagePath) {
-		fmt.Println("Image contains a QR code.")
-
-		urlToken, exists := utils.GetBaseURLByUserID(selfID)
-		if !exists {
-			// Reverse WS request logic here
-			server.SendDeleteMessageViaWebSocket(selfID, messageID)
-			// 发提示
-			server.SendGroupMessageViaWebSocket(selfID, GroupID, userID, config.GetWithdrawNotice())
-		} else {
-			server.SendDeleteRequest(urlToken, messageID)
-			// 发提示
-			server.SendGroupMsgHttp(urlToken, GroupID, userID, config.GetWithdrawNotice())
-		}
+	if result.Verdict.Decision == pipeline.DecisionReview {
+		c.JSON(http.StatusOK, gin.H{"message": "Possible QR code needs review.", "review_id": result.Details["review_id"], "qr_format": result.Details["qr_format"], "qr_score": result.Details["qr_score"], "qr_evidence": result.Details["qr_evidence"]})
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Image contains QR code, message deleted."})
+	if _, found := result.Details["qr_text"]; found {
+		c.JSON(http.StatusOK, gin.H{"message": "QR code allowed by policy.", "qr_text": result.Details["qr_text"], "qr_rule": result.Details["qr_rule"], "qr_format": result.Details["qr_format"], "qr_score": result.Details["qr_score"], "qr_evidence": result.Details["qr_evidence"]})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "No QR code detected in image.",
+		"message":     "No QR code detected in image.",
+		"qr_score":    result.Details["qr_score"],
+		"qr_evidence": result.Details["qr_evidence"],
 	})
 }
 
-// saveImage saves the image from the given reader to the local file system and returns the file path.
-func saveImage(imageData io.Reader) (string, error) {
-	// Generate a unique file name using UUID
-	fileName := fmt.Sprintf("%s.jpg", uuid.New().String())
-	filePath := filepath.Join("images", fileName) // Ensure the "images" directory exists
-
-	// Create the "images" directory if it does not exist
-	err := os.MkdirAll("images", os.ModePerm)
-	if err != nil {
-		return "", fmt.Errorf("failed to create directory: %v", err)
+// jobFromQuery 用请求参数构造检测任务
+func jobFromQuery(c *gin.Context, kind pipeline.Kind, mediaURL string) *pipeline.Job {
+	return &pipeline.Job{
+		Kind:      kind,
+		SelfID:    c.Query("self_id"),
+		GroupID:   c.Query("group_id"),
+		UserID:    c.Query("user_id"),
+		MessageID: c.Query("message_id"),
+		URL:       mediaURL,
 	}
+}
 
-	// Create the file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
-	}
-	defer file.Close()
+// GetQueueStats 返回检测队列的深度等指标
+func GetQueueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"queues": pipeline.Stats()})
+}
 
-	// Copy the image data to the file
-	_, err = io.Copy(file, imageData)
-	if err != nil {
-		return "", fmt.Errorf("failed to save image: %v", err)
+// statusForResult 队列已满返回503,文件过大返回413,类型不符返回415,检测命中但撤回失败时返回502,检测本身失败时返回500
+func statusForResult(result pipeline.Result) int {
+	switch {
+	case errors.Is(result.Err, pipeline.ErrQueueFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(result.Err, media.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(result.Err, media.ErrContentType), errors.Is(result.Err, media.ErrBadMagic):
+		return http.StatusUnsupportedMediaType
 	}
+	if result.Verdict.Decision == pipeline.DecisionHit {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
 
-	return filePath, nil
+// GetCapabilities 返回当前环境实际可用的检测能力
+func GetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"capabilities": utils.Capabilities()})
 }